@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"io"
 	"log/slog"
@@ -14,6 +15,13 @@ import (
 // handler defines a function for processing incoming packets.
 type handler = func(client *Client, pk packet.Packet)
 
+// Drainer drains the sessions of a proxy, which is implemented by spectrum.Spectrum.
+type Drainer interface {
+	// Drain stops accepting new sessions and evacuates all active sessions to the proxy at target, or to their
+	// fallback servers if target is empty, before closing the proxy.
+	Drain(ctx context.Context, target string) error
+}
+
 // API represents a service that enables servers to communicate with the proxy over the TCP protocol.
 // It supports operations such as transferring and kicking players, and allows for the registration
 // of custom packets via packet.Register(). Packets can be handled using RegisterHandler().
@@ -21,6 +29,7 @@ type API struct {
 	authentication Authentication
 	handlers       map[uint32]handler
 	registry       *session.Registry
+	drainer        Drainer
 
 	listener net.Listener
 	clients  map[int64]*Client
@@ -63,9 +72,50 @@ func NewAPI(registry *session.Registry, logger *slog.Logger, authentication Auth
 			a.logger.Debug("tried to transfer an unknown player", "username", username, "addr", addr)
 		}
 	})
+	a.RegisterHandler(packet.IDSessionListRequest, func(c *Client, _ packet.Packet) {
+		sessions := a.registry.GetSessions()
+		entries := make([]packet.SessionEntry, 0, len(sessions))
+		for _, s := range sessions {
+			entries = append(entries, sessionEntry(s))
+		}
+
+		if err := c.WritePacket(&packet.SessionList{Sessions: entries}); err != nil {
+			a.logger.Error("failed to write session list", "err", err)
+		}
+	})
+	a.RegisterHandler(packet.IDSessionInfoRequest, func(c *Client, pk packet.Packet) {
+		username := pk.(*packet.SessionInfoRequest).Username
+		info := &packet.SessionInfo{Username: username}
+		if s := a.registry.GetSessionByUsername(username); s != nil {
+			info.Found = true
+			info.Session = sessionEntry(s)
+		}
+
+		if err := c.WritePacket(info); err != nil {
+			a.logger.Error("failed to write session info", "username", username, "err", err)
+		}
+	})
+	a.RegisterHandler(packet.IDDrain, func(_ *Client, pk packet.Packet) {
+		addr := pk.(*packet.Drain).Addr
+		if a.drainer == nil {
+			a.logger.Error("tried to drain without a drainer", "addr", addr)
+			return
+		}
+
+		go func() {
+			if err := a.drainer.Drain(context.Background(), addr); err != nil {
+				a.logger.Error("failed to drain", "addr", addr, "err", err)
+			}
+		}()
+	})
 	return a
 }
 
+// SetDrainer sets the drainer used to handle Drain packets, which are ignored while no drainer is set.
+func (a *API) SetDrainer(drainer Drainer) {
+	a.drainer = drainer
+}
+
 // Listen sets up a net.Listener for incoming connections based on the specified address.
 func (a *API) Listen(addr string) (err error) {
 	listener, err := net.Listen("tcp", addr)
@@ -192,3 +242,16 @@ func (a *API) handle(c *Client, id int64) {
 		a.logger.Error("received an unhandled packet", "addr", addr, "pid", pk.ID())
 	}
 }
+
+// sessionEntry returns the details of the session passed as sent to clients.
+func sessionEntry(s *session.Session) packet.SessionEntry {
+	identityData := s.Client().IdentityData()
+	return packet.SessionEntry{
+		XUID:     identityData.XUID,
+		Username: identityData.DisplayName,
+		Addr:     s.Client().RemoteAddr().String(),
+		Server:   s.ServerAddr(),
+		Latency:  s.Latency(),
+		Uptime:   s.Uptime().Milliseconds(),
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cooldogedev/spectrum/api/packet"
+)
+
+// consoleHelp is the help text of a Console.
+const consoleHelp = `Commands:
+  list                       list the active sessions
+  info <player>              show the details of a player's session
+  send <player> <server>     transfer a player to another server
+  kick <player> [reason]     disconnect a player
+  drain [proxy]              evacuate all players to another proxy, or disconnect them, and shut down
+  help                       show this help
+  exit                       close the console
+`
+
+// Console is an interactive console managing a proxy through a Client connected to its API service, allowing
+// operators to manage the proxy from a terminal without writing client code.
+type Console struct {
+	client *Client
+	in     io.Reader
+	out    io.Writer
+}
+
+// NewConsole creates a new Console reading commands from in and writing their output to out.
+func NewConsole(client *Client, in io.Reader, out io.Writer) *Console {
+	return &Console{client: client, in: in, out: out}
+}
+
+// Run reads and executes commands until in is exhausted, the exit command is used or the connection to the API
+// service fails.
+func (c *Console) Run() error {
+	scanner := bufio.NewScanner(c.in)
+	for {
+		_, _ = fmt.Fprint(c.out, "> ")
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+
+		if err := c.Execute(args[0], args[1:]); err != nil {
+			if _, ok := err.(usageError); !ok {
+				return err
+			}
+			_, _ = fmt.Fprintln(c.out, err)
+		}
+	}
+}
+
+// usageError is returned by Execute for commands that were used incorrectly. Unlike other errors, it does not
+// indicate a failed connection.
+type usageError string
+
+// Error ...
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// Execute executes a single command with the arguments passed.
+func (c *Console) Execute(command string, args []string) error {
+	switch command {
+	case "list":
+		return c.list()
+	case "info":
+		if len(args) != 1 {
+			return usageError("usage: info <player>")
+		}
+		return c.info(args[0])
+	case "send":
+		if len(args) != 2 {
+			return usageError("usage: send <player> <server>")
+		}
+		return c.client.WritePacket(&packet.Transfer{Username: args[0], Addr: args[1]})
+	case "kick":
+		if len(args) < 1 {
+			return usageError("usage: kick <player> [reason]")
+		}
+		return c.client.WritePacket(&packet.Kick{Username: args[0], Reason: strings.Join(args[1:], " ")})
+	case "drain":
+		if len(args) > 1 {
+			return usageError("usage: drain [proxy]")
+		}
+
+		var addr string
+		if len(args) == 1 {
+			addr = args[0]
+		}
+		return c.client.WritePacket(&packet.Drain{Addr: addr})
+	case "help":
+		_, _ = fmt.Fprint(c.out, consoleHelp)
+		return nil
+	}
+	return usageError(fmt.Sprintf("unknown command %q, use help to list commands", command))
+}
+
+// list prints the active sessions.
+func (c *Console) list() error {
+	if err := c.client.WritePacket(&packet.SessionListRequest{}); err != nil {
+		return err
+	}
+
+	pk, err := c.await(packet.IDSessionList)
+	if err != nil {
+		return err
+	}
+
+	sessions := pk.(*packet.SessionList).Sessions
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "USERNAME\tXUID\tSERVER\tLATENCY\tUPTIME")
+	for _, s := range sessions {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%dms\t%s\n", s.Username, s.XUID, s.Server, s.Latency, formatUptime(s.Uptime))
+	}
+	_ = w.Flush()
+	_, _ = fmt.Fprintf(c.out, "%d session(s)\n", len(sessions))
+	return nil
+}
+
+// info prints the details of the session of a player.
+func (c *Console) info(username string) error {
+	if err := c.client.WritePacket(&packet.SessionInfoRequest{Username: username}); err != nil {
+		return err
+	}
+
+	pk, err := c.await(packet.IDSessionInfo)
+	if err != nil {
+		return err
+	}
+
+	info := pk.(*packet.SessionInfo)
+	if !info.Found {
+		_, _ = fmt.Fprintf(c.out, "%s is not online\n", username)
+		return nil
+	}
+
+	s := info.Session
+	_, _ = fmt.Fprintf(c.out, "Username: %s\nXUID: %s\nAddress: %s\nServer: %s\nLatency: %dms\nUptime: %s\n", s.Username, s.XUID, s.Addr, s.Server, s.Latency, formatUptime(s.Uptime))
+	return nil
+}
+
+// await reads packets until a packet with the ID passed was read, discarding others.
+func (c *Console) await(id uint32) (packet.Packet, error) {
+	for {
+		pk, err := c.client.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+
+		if pk.ID() == id {
+			return pk, nil
+		}
+	}
+}
+
+// formatUptime formats an uptime in milliseconds, rounded to seconds.
+func formatUptime(uptime int64) string {
+	return (time.Duration(uptime) * time.Millisecond).Round(time.Second).String()
+}
@@ -0,0 +1,5 @@
+// Package controlpb holds the messages and gRPC stubs of the Control service, which are generated from
+// control.proto. Clients in other languages are generated from the same file.
+package controlpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative control.proto
@@ -0,0 +1,165 @@
+package control
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft"
+)
+
+// eventQueueSize is the amount of events buffered for a subscriber before new events are dropped for it.
+const eventQueueSize = 256
+
+// EventType is the type of an Event. Its values match the SessionEvent.Type enum of controlpb/control.proto.
+type EventType int32
+
+const (
+	// EventLogin is published once a player spawned on the first server.
+	EventLogin EventType = iota + 1
+	// EventTransferStart is published before a player is transferred to another server.
+	EventTransferStart
+	// EventTransferSuccess is published once a player was transferred to another server.
+	EventTransferSuccess
+	// EventTransferFailure is published when transferring a player to another server failed.
+	EventTransferFailure
+	// EventDisconnect is published when a player disconnects from the proxy.
+	EventDisconnect
+	// EventLatency is published every time the latency of a player is reported to the server.
+	EventLatency
+)
+
+// String returns the name of the event type, as used in the JSON encoding of events.
+func (t EventType) String() string {
+	switch t {
+	case EventLogin:
+		return "login"
+	case EventTransferStart:
+		return "transfer_start"
+	case EventTransferSuccess:
+		return "transfer_success"
+	case EventTransferFailure:
+		return "transfer_failure"
+	case EventDisconnect:
+		return "disconnect"
+	case EventLatency:
+		return "latency"
+	}
+	return "unknown"
+}
+
+// MarshalText ...
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Event is a lifecycle event of a session.
+type Event struct {
+	Type     EventType `json:"type"`
+	XUID     string    `json:"xuid"`
+	Username string    `json:"username"`
+	// Origin is the server the player was on, set for transfer events.
+	Origin string `json:"origin,omitempty"`
+	// Target is the server the player logged in to or is transferred to.
+	Target string `json:"target,omitempty"`
+	// Reason is the disconnection message, set for EventDisconnect.
+	Reason string `json:"reason,omitempty"`
+	// Latency is the total latency of the player in milliseconds, set for EventLatency.
+	Latency int64     `json:"latency,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Events distributes the lifecycle events of sessions to subscribers, such as the StreamEvents call of a Server
+// or a WebSocketHandler. Sessions publish their events once the processor returned by Processor was added to them.
+type Events struct {
+	subscribers map[chan Event]struct{}
+	mu          sync.Mutex
+}
+
+// NewEvents creates a new Events without subscribers.
+func NewEvents() *Events {
+	return &Events{subscribers: make(map[chan Event]struct{})}
+}
+
+// Publish publishes an event to all subscribers. Subscribers that fall behind miss events instead of blocking
+// the session that published them.
+func (e *Events) Publish(event Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every event published afterwards, and a function that stops the
+// subscription and must be called once the channel is no longer read from.
+func (e *Events) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventQueueSize)
+	e.mu.Lock()
+	e.subscribers[ch] = struct{}{}
+	e.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			e.mu.Lock()
+			delete(e.subscribers, ch)
+			e.mu.Unlock()
+		})
+	}
+}
+
+// Processor returns a processor publishing the lifecycle events of the session passed, which is added to the
+// session using Session.AddProcessor, usually right after Spectrum.Accept returned it.
+func (e *Events) Processor(s *session.Session) session.Processor {
+	return &eventProcessor{events: e, s: s}
+}
+
+// eventProcessor publishes the lifecycle events of a session.
+type eventProcessor struct {
+	session.NopProcessor
+	events *Events
+	s      *session.Session
+}
+
+// ProcessStartGame ...
+func (p *eventProcessor) ProcessStartGame(_ *session.Context, _ *minecraft.GameData) {
+	p.publish(Event{Type: EventLogin, Target: p.s.ServerAddr()})
+}
+
+// ProcessLatency ...
+func (p *eventProcessor) ProcessLatency(_ *session.Context, latency *int64, _ *int64) {
+	p.publish(Event{Type: EventLatency, Latency: *latency})
+}
+
+// ProcessPreTransfer ...
+func (p *eventProcessor) ProcessPreTransfer(_ *session.Context, origin *string, target *string) {
+	p.publish(Event{Type: EventTransferStart, Origin: *origin, Target: *target})
+}
+
+// ProcessTransferFailure ...
+func (p *eventProcessor) ProcessTransferFailure(_ *session.Context, origin *string, target *string) {
+	p.publish(Event{Type: EventTransferFailure, Origin: *origin, Target: *target})
+}
+
+// ProcessPostTransfer ...
+func (p *eventProcessor) ProcessPostTransfer(_ *session.Context, origin *string, target *string) {
+	p.publish(Event{Type: EventTransferSuccess, Origin: *origin, Target: *target})
+}
+
+// ProcessDisconnection ...
+func (p *eventProcessor) ProcessDisconnection(_ *session.Context, message *string) {
+	p.publish(Event{Type: EventDisconnect, Reason: *message})
+}
+
+// publish fills in the player and time of the event and publishes it.
+func (p *eventProcessor) publish(event Event) {
+	identityData := p.s.Client().IdentityData()
+	event.XUID = identityData.XUID
+	event.Username = identityData.DisplayName
+	event.Time = time.Now()
+	p.events.Publish(event)
+}
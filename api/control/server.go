@@ -0,0 +1,280 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/cooldogedev/spectrum/api"
+	"github.com/cooldogedev/spectrum/api/control/controlpb"
+	"github.com/cooldogedev/spectrum/server"
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the Control service defined in controlpb/control.proto, allowing orchestration services
+// written in any language to transfer and kick players, broadcast messages, mutate the server registry and stream
+// the lifecycle events of sessions. Clients are generated from controlpb/control.proto using protoc.
+type Server struct {
+	controlpb.UnimplementedControlServer
+
+	authentication api.Authentication
+	registry       *session.Registry
+	servers        *server.Registry
+	events         *Events
+
+	srv    *grpc.Server
+	logger *slog.Logger
+}
+
+// NewServer creates a new Server controlling the sessions of the registry passed. servers is the server registry
+// mutated by the service and may be nil, in which case registry methods fail. events is the source of the events
+// streamed by StreamEvents and may be nil, in which case no events are streamed. Requests are authenticated
+// using authentication, if it is not nil.
+func NewServer(registry *session.Registry, servers *server.Registry, events *Events, authentication api.Authentication, logger *slog.Logger) *Server {
+	return &Server{
+		authentication: authentication,
+		registry:       registry,
+		servers:        servers,
+		events:         events,
+		logger:         logger,
+	}
+}
+
+// Listen starts serving the service on the address passed in the background. The options passed are used to
+// create the grpc.Server, such as grpc.Creds to serve the service over TLS.
+func (s *Server) Listen(addr string, opts ...grpc.ServerOption) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.logger.Error("failed to start listening", "addr", addr, "err", err)
+		return err
+	}
+
+	opts = append(opts, grpc.ChainUnaryInterceptor(s.authenticateUnary), grpc.ChainStreamInterceptor(s.authenticateStream))
+	s.srv = grpc.NewServer(opts...)
+	controlpb.RegisterControlServer(s.srv, s)
+	go func() {
+		if err := s.srv.Serve(listener); err != nil {
+			s.logger.Error("failed to serve", "err", err)
+		}
+	}()
+	s.logger.Info("started listening on", "addr", addr)
+	return nil
+}
+
+// Close stops serving the service, ending the streams of all StreamEvents calls.
+func (s *Server) Close() error {
+	if s.srv != nil {
+		s.srv.Stop()
+	}
+	return nil
+}
+
+// authenticateUnary authenticates unary calls.
+func (s *Server) authenticateUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authenticateStream authenticates streaming calls.
+func (s *Server) authenticateStream(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// authenticate authenticates a call using the token in its "authorization" metadata.
+func (s *Server) authenticate(ctx context.Context) error {
+	if s.authentication == nil {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get("authorization"); len(values) > 0 {
+		token = strings.TrimPrefix(values[0], "Bearer ")
+	}
+
+	if !s.authentication.Authenticate(token) {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return nil
+}
+
+// session returns the session of the player with the username passed.
+func (s *Server) session(username string) (*session.Session, error) {
+	if found := s.registry.GetSessionByUsername(username); found != nil {
+		return found, nil
+	}
+	return nil, status.Error(codes.NotFound, fmt.Sprintf("player %s is not online", username))
+}
+
+// serverRegistry returns the server registry, failing if the server has none.
+func (s *Server) serverRegistry() (*server.Registry, error) {
+	if s.servers == nil {
+		return nil, status.Error(codes.FailedPrecondition, "no server registry configured")
+	}
+	return s.servers, nil
+}
+
+// Transfer ...
+func (s *Server) Transfer(_ context.Context, req *controlpb.TransferRequest) (*controlpb.TransferResponse, error) {
+	target, err := s.session(req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := target.Transfer(req.GetAddr()); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &controlpb.TransferResponse{}, nil
+}
+
+// Kick ...
+func (s *Server) Kick(_ context.Context, req *controlpb.KickRequest) (*controlpb.KickResponse, error) {
+	target, err := s.session(req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+	target.Disconnect(req.GetReason())
+	return &controlpb.KickResponse{}, nil
+}
+
+// Broadcast ...
+func (s *Server) Broadcast(_ context.Context, req *controlpb.BroadcastRequest) (*controlpb.BroadcastResponse, error) {
+	sessions := s.registry.GetSessions()
+	if req.GetGroup() != "" {
+		sessions = s.registry.GetGroup(req.GetGroup())
+	}
+
+	resp := &controlpb.BroadcastResponse{}
+	for _, target := range sessions {
+		if target.Client().WritePacket(&packet.Text{TextType: packet.TextTypeRaw, Message: req.GetMessage()}) == nil {
+			resp.Recipients++
+		}
+	}
+	return resp, nil
+}
+
+// ListSessions ...
+func (s *Server) ListSessions(context.Context, *controlpb.ListSessionsRequest) (*controlpb.ListSessionsResponse, error) {
+	sessions := s.registry.GetSessions()
+	resp := &controlpb.ListSessionsResponse{Sessions: make([]*controlpb.Session, 0, len(sessions))}
+	for _, activeSession := range sessions {
+		identityData := activeSession.Client().IdentityData()
+		resp.Sessions = append(resp.Sessions, &controlpb.Session{
+			Xuid:     identityData.XUID,
+			Username: identityData.DisplayName,
+			Addr:     activeSession.Client().RemoteAddr().String(),
+			Server:   activeSession.ServerAddr(),
+			Latency:  activeSession.Latency(),
+			Uptime:   activeSession.Uptime().Milliseconds(),
+		})
+	}
+	return resp, nil
+}
+
+// ListServers ...
+func (s *Server) ListServers(context.Context, *controlpb.ListServersRequest) (*controlpb.ListServersResponse, error) {
+	registry, err := s.serverRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	servers := registry.AllServers()
+	resp := &controlpb.ListServersResponse{Servers: make([]*controlpb.Server, 0, len(servers))}
+	for _, srv := range servers {
+		resp.Servers = append(resp.Servers, &controlpb.Server{
+			Addr:     srv.Addr,
+			Weight:   int32(srv.Weight),
+			Capacity: int32(srv.Capacity),
+			Healthy:  registry.Healthy(srv.Addr),
+		})
+	}
+	return resp, nil
+}
+
+// AddServer ...
+func (s *Server) AddServer(_ context.Context, req *controlpb.AddServerRequest) (*controlpb.AddServerResponse, error) {
+	registry, err := s.serverRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := registry.Add(toServer(req.GetServer())); err != nil {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	return &controlpb.AddServerResponse{}, nil
+}
+
+// UpdateServer ...
+func (s *Server) UpdateServer(_ context.Context, req *controlpb.UpdateServerRequest) (*controlpb.UpdateServerResponse, error) {
+	registry, err := s.serverRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := registry.Update(toServer(req.GetServer())); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &controlpb.UpdateServerResponse{}, nil
+}
+
+// RemoveServer ...
+func (s *Server) RemoveServer(_ context.Context, req *controlpb.RemoveServerRequest) (*controlpb.RemoveServerResponse, error) {
+	registry, err := s.serverRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return &controlpb.RemoveServerResponse{Removed: registry.Remove(req.GetAddr())}, nil
+}
+
+// StreamEvents ...
+func (s *Server) StreamEvents(_ *controlpb.StreamEventsRequest, stream controlpb.Control_StreamEventsServer) error {
+	ctx := stream.Context()
+	if s.events == nil {
+		<-ctx.Done()
+		return nil
+	}
+
+	events, unsubscribe := s.events.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case event := <-events:
+			if err := stream.Send(eventMessage(event)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// toServer converts a Server message to a server.Server. The healthy field of the message is ignored.
+func toServer(m *controlpb.Server) server.Server {
+	return server.Server{Addr: m.GetAddr(), Weight: int(m.GetWeight()), Capacity: int(m.GetCapacity())}
+}
+
+// eventMessage converts an event to a SessionEvent message.
+func eventMessage(event Event) *controlpb.SessionEvent {
+	return &controlpb.SessionEvent{
+		Type:      controlpb.SessionEvent_Type(event.Type),
+		Xuid:      event.XUID,
+		Username:  event.Username,
+		Origin:    event.Origin,
+		Target:    event.Target,
+		Reason:    event.Reason,
+		Latency:   event.Latency,
+		Timestamp: event.Time.UnixMilli(),
+	}
+}
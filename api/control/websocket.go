@@ -0,0 +1,93 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/cooldogedev/spectrum/api"
+)
+
+// websocketWriteTimeout is the maximum duration writing a message may take, after which the client is considered
+// gone.
+const websocketWriteTimeout = 10 * time.Second
+
+// WebSocketHandler is an http.Handler streaming the lifecycle events of sessions to WebSocket clients as JSON
+// text messages, one event per message, for dashboards and moderation tooling. Clients authenticate using the
+// "token" query parameter, since browsers cannot set headers on WebSocket requests, or the Authorization
+// header. Messages sent by clients are ignored.
+type WebSocketHandler struct {
+	events         *Events
+	authentication api.Authentication
+	logger         *slog.Logger
+}
+
+// NewWebSocketHandler creates a new WebSocketHandler streaming the events published to events. Clients are
+// authenticated using authentication, if it is not nil.
+func NewWebSocketHandler(events *Events, authentication api.Authentication, logger *slog.Logger) *WebSocketHandler {
+	return &WebSocketHandler{
+		events:         events,
+		authentication: authentication,
+		logger:         logger,
+	}
+}
+
+// ServeHTTP ...
+func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	if h.authentication != nil && !h.authentication.Authenticate(token) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	// Clients are authenticated using a token rather than cookies, so dashboards served from other origins are
+	// allowed to connect.
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
+	if err != nil {
+		h.logger.Debug("failed to accept websocket client", "err", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	addr := r.RemoteAddr
+	h.logger.Debug("accepted websocket client", "addr", addr)
+	events, unsubscribe := h.events.Subscribe()
+	defer unsubscribe()
+
+	// CloseRead discards messages sent by the client, answering pings and close frames, and cancels the context
+	// once the client is gone.
+	ctx := conn.CloseRead(r.Context())
+	for {
+		select {
+		case event := <-events:
+			payload, err := json.Marshal(event)
+			if err != nil {
+				h.logger.Error("failed to encode event", "err", err)
+				continue
+			}
+
+			if err := h.write(ctx, conn, payload); err != nil {
+				h.logger.Debug("failed to write to websocket client", "addr", addr, "err", err)
+				return
+			}
+		case <-ctx.Done():
+			h.logger.Debug("closed websocket client", "addr", addr)
+			return
+		}
+	}
+}
+
+// write writes a single text message to the connection, failing if it takes longer than websocketWriteTimeout.
+func (h *WebSocketHandler) write(ctx context.Context, conn *websocket.Conn, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, websocketWriteTimeout)
+	defer cancel()
+	return conn.Write(ctx, websocket.MessageText, payload)
+}
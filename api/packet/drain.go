@@ -0,0 +1,26 @@
+package packet
+
+import "bytes"
+
+// Drain is sent by the client to make the proxy stop accepting players and evacuate all of its sessions
+// before shutting down.
+type Drain struct {
+	// Addr is the address of the proxy players are sent to. When empty, players are moved to their fallback
+	// servers instead, and only disconnected if none of them is reachable.
+	Addr string
+}
+
+// ID ...
+func (pk *Drain) ID() uint32 {
+	return IDDrain
+}
+
+// Encode ...
+func (pk *Drain) Encode(buf *bytes.Buffer) {
+	WriteString(buf, pk.Addr)
+}
+
+// Decode ...
+func (pk *Drain) Decode(buf *bytes.Buffer) {
+	pk.Addr = ReadString(buf)
+}
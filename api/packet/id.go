@@ -5,4 +5,9 @@ const (
 	IDConnectionResponse
 	IDKick
 	IDTransfer
+	IDSessionListRequest
+	IDSessionList
+	IDSessionInfoRequest
+	IDSessionInfo
+	IDDrain
 )
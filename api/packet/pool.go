@@ -25,4 +25,9 @@ func init() {
 	Register(IDConnectionResponse, func() Packet { return &ConnectionResponse{} })
 	Register(IDKick, func() Packet { return &Kick{} })
 	Register(IDTransfer, func() Packet { return &Transfer{} })
+	Register(IDSessionListRequest, func() Packet { return &SessionListRequest{} })
+	Register(IDSessionList, func() Packet { return &SessionList{} })
+	Register(IDSessionInfoRequest, func() Packet { return &SessionInfoRequest{} })
+	Register(IDSessionInfo, func() Packet { return &SessionInfo{} })
+	Register(IDDrain, func() Packet { return &Drain{} })
 }
@@ -0,0 +1,42 @@
+package packet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// SessionEntry holds the details of a single session of the proxy.
+type SessionEntry struct {
+	// XUID is the XUID of the player.
+	XUID string
+	// Username is the username of the player.
+	Username string
+	// Addr is the address the player is connected to the proxy from.
+	Addr string
+	// Server is the address of the server the player is currently connected to.
+	Server string
+	// Latency is the total latency of the player in milliseconds.
+	Latency int64
+	// Uptime is the amount of milliseconds that passed since the player connected to the proxy.
+	Uptime int64
+}
+
+// Encode encodes the entry into binary form and writes it to buf.
+func (e *SessionEntry) Encode(buf *bytes.Buffer) {
+	WriteString(buf, e.XUID)
+	WriteString(buf, e.Username)
+	WriteString(buf, e.Addr)
+	WriteString(buf, e.Server)
+	_ = binary.Write(buf, binary.LittleEndian, e.Latency)
+	_ = binary.Write(buf, binary.LittleEndian, e.Uptime)
+}
+
+// Decode decodes binary data from buf into the entry.
+func (e *SessionEntry) Decode(buf *bytes.Buffer) {
+	e.XUID = ReadString(buf)
+	e.Username = ReadString(buf)
+	e.Addr = ReadString(buf)
+	e.Server = ReadString(buf)
+	_ = binary.Read(buf, binary.LittleEndian, &e.Latency)
+	_ = binary.Read(buf, binary.LittleEndian, &e.Uptime)
+}
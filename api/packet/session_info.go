@@ -0,0 +1,61 @@
+package packet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// SessionInfoRequest is sent by the client to request the details of the session of a specific player. The
+// proxy responds with a SessionInfo.
+type SessionInfoRequest struct {
+	// Username is the username of the player.
+	Username string
+}
+
+// ID ...
+func (pk *SessionInfoRequest) ID() uint32 {
+	return IDSessionInfoRequest
+}
+
+// Encode ...
+func (pk *SessionInfoRequest) Encode(buf *bytes.Buffer) {
+	WriteString(buf, pk.Username)
+}
+
+// Decode ...
+func (pk *SessionInfoRequest) Decode(buf *bytes.Buffer) {
+	pk.Username = ReadString(buf)
+}
+
+// SessionInfo is sent by the proxy in response to a SessionInfoRequest.
+type SessionInfo struct {
+	// Username is the username the details were requested for.
+	Username string
+	// Found indicates whether the player has an active session. Session is only set if it does.
+	Found bool
+	// Session holds the details of the player's session.
+	Session SessionEntry
+}
+
+// ID ...
+func (pk *SessionInfo) ID() uint32 {
+	return IDSessionInfo
+}
+
+// Encode ...
+func (pk *SessionInfo) Encode(buf *bytes.Buffer) {
+	WriteString(buf, pk.Username)
+	_ = binary.Write(buf, binary.LittleEndian, pk.Found)
+	if pk.Found {
+		pk.Session.Encode(buf)
+	}
+}
+
+// Decode ...
+func (pk *SessionInfo) Decode(buf *bytes.Buffer) {
+	pk.Username = ReadString(buf)
+	_ = binary.Read(buf, binary.LittleEndian, &pk.Found)
+	if pk.Found {
+		pk.Session.Decode(buf)
+	}
+}
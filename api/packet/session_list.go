@@ -0,0 +1,53 @@
+package packet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// SessionListRequest is sent by the client to request the list of sessions currently active on the proxy.
+// The proxy responds with a SessionList.
+type SessionListRequest struct{}
+
+// ID ...
+func (pk *SessionListRequest) ID() uint32 {
+	return IDSessionListRequest
+}
+
+// Encode ...
+func (pk *SessionListRequest) Encode(*bytes.Buffer) {}
+
+// Decode ...
+func (pk *SessionListRequest) Decode(*bytes.Buffer) {}
+
+// SessionList is sent by the proxy in response to a SessionListRequest, holding every active session.
+type SessionList struct {
+	// Sessions are the sessions currently active on the proxy.
+	Sessions []SessionEntry
+}
+
+// ID ...
+func (pk *SessionList) ID() uint32 {
+	return IDSessionList
+}
+
+// Encode ...
+func (pk *SessionList) Encode(buf *bytes.Buffer) {
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(pk.Sessions)))
+	for i := range pk.Sessions {
+		pk.Sessions[i].Encode(buf)
+	}
+}
+
+// Decode ...
+func (pk *SessionList) Decode(buf *bytes.Buffer) {
+	var length uint32
+	_ = binary.Read(buf, binary.LittleEndian, &length)
+	// Every entry takes at least 32 bytes, which bounds the amount of entries allocated for malformed packets.
+	pk.Sessions = make([]SessionEntry, 0, min(int(length), buf.Len()/32))
+	for range length {
+		var entry SessionEntry
+		entry.Decode(buf)
+		pk.Sessions = append(pk.Sessions, entry)
+	}
+}
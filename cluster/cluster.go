@@ -0,0 +1,284 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+)
+
+// DuplicateLoginPolicy determines how a Cluster resolves a player logging in while they already have a session
+// on any node of the cluster.
+type DuplicateLoginPolicy int
+
+const (
+	// KickExisting disconnects the existing session and lets the new session log in.
+	KickExisting DuplicateLoginPolicy = iota
+	// DenyNew rejects the login of the new session and keeps the existing session.
+	DenyNew
+)
+
+// MessageKickEntry is the type of the messages published by a Cluster to disconnect the session of an entry, which
+// are only handled by the node the session is on.
+const MessageKickEntry = "kick_entry"
+
+// kickEntry is the content of a MessageKickEntry message.
+type kickEntry struct {
+	// Node is the ID of the node the session is on.
+	Node string `json:"node"`
+	XUID string `json:"xuid"`
+	// ID is the ID of the entry of the session, so that a newer session of the same player is never disconnected.
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+const (
+	// defaultEntryTTL is the TTL of the entries of sessions if the cluster was not given one.
+	defaultEntryTTL = 30 * time.Second
+	// directoryTimeout is the maximum duration a single operation on the directory may take.
+	directoryTimeout = 5 * time.Second
+)
+
+// Cluster registers the sessions of a node in a Directory shared by all nodes of the cluster, which allows
+// locating the node and server of any player using Locate and resolving duplicate logins across the cluster.
+// Sessions are registered by the processor returned by Processor, and their entries are refreshed by the
+// cluster until they are closed.
+type Cluster struct {
+	node      *Node
+	directory Directory
+	policy    DuplicateLoginPolicy
+	ttl       time.Duration
+	logger    *slog.Logger
+
+	// entries holds the entries of the local sessions registered in the directory.
+	entries map[*session.Session]Entry
+	nextID  atomic.Uint64
+	mu      sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewCluster creates a new Cluster registering the sessions of the node passed in the directory. The node is used
+// to kick existing sessions on other nodes when the policy is KickExisting, for which it handles MessageKickEntry
+// messages. Entries expire after ttl unless refreshed, which happens every third of it, so that the sessions of
+// nodes that crashed are removed. A ttl of zero uses the default of 30 seconds.
+func NewCluster(node *Node, directory Directory, policy DuplicateLoginPolicy, ttl time.Duration, logger *slog.Logger) *Cluster {
+	if ttl <= 0 {
+		ttl = defaultEntryTTL
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cluster{
+		node:      node,
+		directory: directory,
+		policy:    policy,
+		ttl:       ttl,
+		logger:    logger,
+
+		entries: make(map[*session.Session]Entry),
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	node.Handle(MessageKickEntry, c.handleKickEntry)
+	return c
+}
+
+// Start starts refreshing the entries of the local sessions in the background until Close is called.
+func (c *Cluster) Start() {
+	go func() {
+		ticker := time.NewTicker(c.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.refresh()
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close stops refreshing the entries of the local sessions, which expire afterwards unless released.
+func (c *Cluster) Close() error {
+	c.once.Do(c.cancel)
+	return nil
+}
+
+// Locate returns the entry of the player with the XUID passed, holding the node and server the player is on, and
+// whether the player is online on any node of the cluster.
+func (c *Cluster) Locate(ctx context.Context, xuid string) (Entry, bool, error) {
+	return c.directory.Get(ctx, xuid)
+}
+
+// Processor returns a processor registering the session passed in the directory once it logs in, resolving
+// duplicate logins using the policy of the cluster, and removing it once it disconnects. It is added to the
+// session using Session.AddProcessor, which must happen before Session.Login is called for duplicate logins to be
+// resolved, so opts.AutoLogin must be disabled.
+func (c *Cluster) Processor(s *session.Session) session.Processor {
+	return &clusterProcessor{c: c, s: s}
+}
+
+// claim registers the session in the directory, resolving a duplicate login if the player already has a session.
+// It returns false if the login of the session must be rejected.
+func (c *Cluster) claim(s *session.Session, identityData login.IdentityData) bool {
+	ctx, cancel := context.WithTimeout(c.ctx, directoryTimeout)
+	defer cancel()
+
+	entry := Entry{
+		XUID:     identityData.XUID,
+		Username: identityData.DisplayName,
+		Node:     c.node.ID(),
+		ID:       c.node.ID() + ":" + strconv.FormatUint(c.nextID.Add(1), 10),
+		Since:    time.Now().UnixMilli(),
+	}
+	existing, ok, err := c.directory.Claim(ctx, entry, c.ttl)
+	if err != nil {
+		// An unreachable directory must not lock every player out, so the login proceeds unregistered.
+		c.logger.Error("failed to claim session entry", "xuid", entry.XUID, "err", err)
+		return true
+	}
+
+	if !ok && existing.XUID != "" {
+		if c.policy == DenyNew {
+			c.logger.Debug("denied duplicate login", "xuid", entry.XUID, "node", existing.Node)
+			return false
+		}
+
+		c.kick(ctx, existing)
+	}
+	if !ok {
+		// The existing entry is only replaced if no other session claimed it in the meantime. If the existing entry
+		// disappeared before it could be read, the session claims it if it is still free.
+		replaced, err := c.directory.Replace(ctx, entry, existing.ID, c.ttl)
+		if err != nil {
+			c.logger.Error("failed to replace session entry", "xuid", entry.XUID, "err", err)
+			return true
+		} else if !replaced {
+			c.logger.Debug("session entry was claimed concurrently, logging in unregistered", "xuid", entry.XUID)
+			return true
+		}
+	}
+
+	c.mu.Lock()
+	c.entries[s] = entry
+	c.mu.Unlock()
+	return true
+}
+
+// kick disconnects the existing session of an entry, whether it is on this node or another. Only the node the
+// session is on handles the message, and only disconnects the session if it still has the entry's ID.
+func (c *Cluster) kick(ctx context.Context, existing Entry) {
+	content := kickEntry{Node: existing.Node, XUID: existing.XUID, ID: existing.ID, Reason: "You logged in from another location."}
+	if existing.Node == c.node.ID() {
+		c.kickLocal(content)
+		return
+	}
+
+	if err := c.node.Publish(ctx, MessageKickEntry, content); err != nil {
+		c.logger.Error("failed to kick existing session", "xuid", existing.XUID, "node", existing.Node, "err", err)
+	}
+}
+
+// handleKickEntry handles a MessageKickEntry message published by any node.
+func (c *Cluster) handleKickEntry(message Message) {
+	var content kickEntry
+	if err := json.Unmarshal(message.Data, &content); err != nil || content.Node != c.node.ID() {
+		return
+	}
+	c.kickLocal(content)
+}
+
+// kickLocal disconnects the local session registered with the entry of the kick, if any.
+func (c *Cluster) kickLocal(content kickEntry) {
+	var target *session.Session
+	c.mu.Lock()
+	for s, entry := range c.entries {
+		if entry.XUID == content.XUID && entry.ID == content.ID {
+			target = s
+			break
+		}
+	}
+	c.mu.Unlock()
+	if target != nil {
+		target.Disconnect(content.Reason)
+	}
+}
+
+// release removes the entry of the session from the directory, if it was registered.
+func (c *Cluster) release(s *session.Session) {
+	c.mu.Lock()
+	entry, ok := c.entries[s]
+	delete(c.entries, s)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.ctx), directoryTimeout)
+	defer cancel()
+	if err := c.directory.Release(ctx, entry.XUID, entry.ID); err != nil {
+		c.logger.Error("failed to release session entry", "xuid", entry.XUID, "err", err)
+	}
+}
+
+// refresh stores the entries of all registered local sessions again, extending their TTL and updating the server
+// they are on. Entries replaced by a newer session are no longer refreshed nor released.
+func (c *Cluster) refresh() {
+	c.mu.Lock()
+	entries := make(map[*session.Session]Entry, len(c.entries))
+	for s, entry := range c.entries {
+		entry.Server = s.ServerAddr()
+		entries[s] = entry
+	}
+	c.mu.Unlock()
+
+	for s, entry := range entries {
+		ctx, cancel := context.WithTimeout(c.ctx, directoryTimeout)
+		replaced, err := c.directory.Replace(ctx, entry, entry.ID, c.ttl)
+		cancel()
+		if err != nil {
+			if c.ctx.Err() == nil {
+				c.logger.Error("failed to refresh session entry", "xuid", entry.XUID, "err", err)
+			}
+			continue
+		}
+
+		if !replaced {
+			c.logger.Debug("session entry was replaced by another session", "xuid", entry.XUID)
+			c.mu.Lock()
+			if current, ok := c.entries[s]; ok && current.ID == entry.ID {
+				delete(c.entries, s)
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// clusterProcessor registers a session with a Cluster.
+type clusterProcessor struct {
+	session.NopProcessor
+	c *Cluster
+	s *session.Session
+}
+
+// ProcessLogin ...
+func (p *clusterProcessor) ProcessLogin(ctx *session.Context, identity login.IdentityData, _ login.ClientData) {
+	if !p.c.claim(p.s, identity) {
+		ctx.Cancel()
+	}
+}
+
+// ProcessDisconnection ...
+func (p *clusterProcessor) ProcessDisconnection(_ *session.Context, _ *string) {
+	p.c.release(p.s)
+}
@@ -0,0 +1,127 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Entry is the entry of a session in a Directory.
+type Entry struct {
+	XUID     string `json:"xuid"`
+	Username string `json:"username"`
+	// Node is the ID of the node the session is on.
+	Node string `json:"node"`
+	// Server is the address of the server the session is on.
+	Server string `json:"server"`
+	// ID uniquely identifies the session, so that a node only removes the entries of its own sessions.
+	ID string `json:"id"`
+	// Since is the time the session was registered at in Unix milliseconds.
+	Since int64 `json:"since"`
+}
+
+// Directory is a store shared by the nodes of a cluster holding an entry for every session of the cluster,
+// keyed by XUID. Entries expire unless they are put again within their TTL, so that the sessions of nodes that
+// crashed are eventually removed.
+type Directory interface {
+	// Claim stores the entry passed if no entry with its XUID is stored. Otherwise, the stored entry is returned
+	// along with false.
+	Claim(ctx context.Context, entry Entry, ttl time.Duration) (Entry, bool, error)
+	// Replace stores the entry passed if the stored entry with its XUID has the ID passed or no entry with its XUID
+	// is stored, and returns whether it was stored. Passing the ID of the entry itself refreshes it, unless another
+	// entry replaced it in the meantime.
+	Replace(ctx context.Context, entry Entry, id string, ttl time.Duration) (bool, error)
+	// Get returns the entry with the XUID passed, and whether it is stored.
+	Get(ctx context.Context, xuid string) (Entry, bool, error)
+	// Release removes the entry with the XUID passed if its ID matches the ID passed.
+	Release(ctx context.Context, xuid string, id string) error
+}
+
+// redisReleaseScript removes the entry of a key if its ID matches, which Redis executes atomically.
+var redisReleaseScript = redis.NewScript(`local v = redis.call('GET', KEYS[1])
+if v and cjson.decode(v).id == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+
+// redisReplaceScript sets the entry of a key if it does not exist or its ID matches, which Redis executes atomically.
+var redisReplaceScript = redis.NewScript(`local v = redis.call('GET', KEYS[1])
+if not v or cjson.decode(v).id == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	return 1
+end
+return 0`)
+
+// RedisDirectory implements the Directory interface using Redis, storing every entry as a JSON string under
+// its own key, which expires along with the entry.
+type RedisDirectory struct {
+	redisClient
+	prefix string
+}
+
+// NewRedisDirectory creates a new RedisDirectory using the Redis server of the config passed. Entries are stored
+// under keys starting with prefix, which defaults to "spectrum:session:" if empty.
+func NewRedisDirectory(config RedisConfig, prefix string) *RedisDirectory {
+	if prefix == "" {
+		prefix = "spectrum:session:"
+	}
+	return &RedisDirectory{redisClient: redisClient{client: config.client()}, prefix: prefix}
+}
+
+// Claim ...
+func (d *RedisDirectory) Claim(ctx context.Context, entry Entry, ttl time.Duration) (Entry, bool, error) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	claimed, err := d.client.SetNX(ctx, d.prefix+entry.XUID, value, ttl).Result()
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	if claimed {
+		return entry, true, nil
+	}
+
+	existing, ok, err := d.Get(ctx, entry.XUID)
+	if err != nil || !ok {
+		// The existing entry expired or was released in the meantime, so claiming it again may succeed.
+		return Entry{}, false, err
+	}
+	return existing, false, nil
+}
+
+// Replace ...
+func (d *RedisDirectory) Replace(ctx context.Context, entry Entry, id string, ttl time.Duration) (bool, error) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return false, err
+	}
+
+	return redisReplaceScript.Run(ctx, d.client, []string{d.prefix + entry.XUID}, id, value, ttl.Milliseconds()).Bool()
+}
+
+// Get ...
+func (d *RedisDirectory) Get(ctx context.Context, xuid string) (Entry, bool, error) {
+	value, err := d.client.Get(ctx, d.prefix+xuid).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Entry{}, false, nil
+	} else if err != nil {
+		return Entry{}, false, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return Entry{}, false, err
+	}
+	return entry, true, nil
+}
+
+// Release ...
+func (d *RedisDirectory) Release(ctx context.Context, xuid string, id string) error {
+	return redisReleaseScript.Run(ctx, d.client, []string{d.prefix + xuid}, id).Err()
+}
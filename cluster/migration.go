@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisMigrationStore implements the session.MigrationStore interface using Redis, storing every state as a JSON
+// string under its own key, which expires along with the state. Taking a state uses GETDEL, which requires Redis
+// 6.2 or newer, so that a state is only ever resumed once.
+type RedisMigrationStore struct {
+	redisClient
+	prefix string
+}
+
+// NewRedisMigrationStore creates a new RedisMigrationStore using the Redis server of the config passed. States are
+// stored under keys starting with prefix, which defaults to "spectrum:migration:" if empty.
+func NewRedisMigrationStore(config RedisConfig, prefix string) *RedisMigrationStore {
+	if prefix == "" {
+		prefix = "spectrum:migration:"
+	}
+	return &RedisMigrationStore{redisClient: redisClient{client: config.client()}, prefix: prefix}
+}
+
+// Store ...
+func (m *RedisMigrationStore) Store(ctx context.Context, state session.MigrationState, ttl time.Duration) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return m.client.Set(ctx, m.prefix+state.XUID, value, ttl).Err()
+}
+
+// Take ...
+func (m *RedisMigrationStore) Take(ctx context.Context, xuid string) (session.MigrationState, bool, error) {
+	value, err := m.client.GetDel(ctx, m.prefix+xuid).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return session.MigrationState{}, false, nil
+	} else if err != nil {
+		return session.MigrationState{}, false, err
+	}
+
+	var state session.MigrationState
+	if err := json.Unmarshal(value, &state); err != nil {
+		return session.MigrationState{}, false, err
+	}
+	return state, true, nil
+}
@@ -0,0 +1,331 @@
+// Package cluster connects multiple Spectrum proxies, allowing them to exchange messages such as the locations
+// of players, broadcasts and kicks.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+const (
+	// DefaultChannel is the channel used by nodes that were not given a channel.
+	DefaultChannel = "spectrum:cluster"
+
+	// publishTimeout is the maximum duration publishing a single message may take.
+	publishTimeout = 5 * time.Second
+	// outboxSize is the amount of messages published by session events that may be queued before new messages
+	// are dropped.
+	outboxSize = 256
+	// resubscribeDelay is the delay before subscribing again after the subscription of a node failed.
+	resubscribeDelay = time.Second
+)
+
+// The types of the messages exchanged by nodes.
+const (
+	MessageLocation  = "location"
+	MessageBroadcast = "broadcast"
+	MessageKick      = "kick"
+	MessageChat      = "chat"
+)
+
+// Message is a message exchanged by the nodes of a cluster.
+type Message struct {
+	// Type is the type of the message, which determines the handler it is passed to.
+	Type string `json:"type"`
+	// Node is the ID of the node that published the message.
+	Node string `json:"node"`
+	// Data is the JSON encoded content of the message.
+	Data json.RawMessage `json:"data"`
+}
+
+// Location is the location of a player within the cluster, published by the node the player is connected to.
+type Location struct {
+	XUID     string `json:"xuid"`
+	Username string `json:"username"`
+	// Node is the ID of the node the player is connected to.
+	Node string `json:"node"`
+	// Server is the address of the server the player is on.
+	Server string `json:"server"`
+	// Online is false once the player disconnected from the node.
+	Online bool `json:"online"`
+}
+
+// broadcast is the content of a MessageBroadcast message.
+type broadcast struct {
+	Message string `json:"message"`
+}
+
+// kick is the content of a MessageKick message.
+type kick struct {
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+}
+
+// chat is the content of a MessageChat message.
+type chat struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Message string `json:"message"`
+}
+
+// Node is a single proxy of a cluster. Nodes publish messages to a channel of a PubSub shared by all nodes and
+// handle the messages published by any node, including themselves, which allows broadcasting messages to and
+// kicking players from the whole cluster, as well as messaging players connected to other proxies. Custom
+// messages are exchanged using Publish and Handle.
+type Node struct {
+	id       string
+	channel  string
+	pubsub   PubSub
+	registry *session.Registry
+	logger   *slog.Logger
+
+	handlers  map[string]func(Message)
+	locations map[string]Location
+	mu        sync.RWMutex
+
+	outbox chan Message
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewNode creates a new Node with the unique ID passed, exchanging messages over the channel of the PubSub
+// passed. channel may be empty to use DefaultChannel. Local players are looked up in the registry passed.
+func NewNode(id string, channel string, pubsub PubSub, registry *session.Registry, logger *slog.Logger) *Node {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Node{
+		id:       id,
+		channel:  channel,
+		pubsub:   pubsub,
+		registry: registry,
+		logger:   logger,
+
+		handlers:  make(map[string]func(Message)),
+		locations: make(map[string]Location),
+
+		outbox: make(chan Message, outboxSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	n.handlers[MessageLocation] = n.handleLocation
+	n.handlers[MessageBroadcast] = n.handleBroadcast
+	n.handlers[MessageKick] = n.handleKick
+	n.handlers[MessageChat] = n.handleChat
+	return n
+}
+
+// ID returns the unique ID of the node.
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Start starts handling the messages published to the cluster in the background until Close is called.
+func (n *Node) Start() {
+	go n.subscribe()
+	go n.publishOutbox()
+}
+
+// Close stops handling messages.
+func (n *Node) Close() error {
+	n.once.Do(n.cancel)
+	return nil
+}
+
+// Observe publishes the location of every local player whenever they log in, transfer or disconnect, using the
+// events of the bus passed, which must be set on the sessions using Spectrum.SetEventBus. It returns a function
+// that stops observing the bus.
+func (n *Node) Observe(bus *session.EventBus) func() {
+	unsubscribers := []func(){
+		session.Subscribe(bus, func(event session.SessionStarted) {
+			n.queueLocation(event.Session, event.Server, true)
+		}),
+		session.Subscribe(bus, func(event session.TransferCompleted) {
+			n.queueLocation(event.Session, event.Record.Target, true)
+		}),
+		session.Subscribe(bus, func(event session.SessionClosed) {
+			n.queueLocation(event.Session, "", false)
+		}),
+	}
+	return func() {
+		for _, unsubscribe := range unsubscribers {
+			unsubscribe()
+		}
+	}
+}
+
+// Locate returns the location of the player with the username passed, as last published by the node the player
+// is connected to.
+func (n *Node) Locate(username string) (Location, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	location, ok := n.locations[strings.ToLower(username)]
+	return location, ok
+}
+
+// Broadcast sends a chat message to every player of the cluster.
+func (n *Node) Broadcast(ctx context.Context, message string) error {
+	return n.Publish(ctx, MessageBroadcast, broadcast{Message: message})
+}
+
+// Kick disconnects the player with the username passed from whichever node of the cluster they are connected to.
+func (n *Node) Kick(ctx context.Context, username string, reason string) error {
+	return n.Publish(ctx, MessageKick, kick{Username: username, Reason: reason})
+}
+
+// SendMessage sends a private chat message from one player to the player with the username to, on whichever
+// node of the cluster they are connected to.
+func (n *Node) SendMessage(ctx context.Context, from string, to string, message string) error {
+	return n.Publish(ctx, MessageChat, chat{From: from, To: to, Message: message})
+}
+
+// Publish publishes a message of the type passed with data as its JSON encoded content to all nodes.
+func (n *Node) Publish(ctx context.Context, typ string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return n.publish(ctx, Message{Type: typ, Node: n.id, Data: encoded})
+}
+
+// Handle sets the handler of the messages of the type passed, replacing any previous handler, including those of
+// the built-in message types. Handlers are called on a single goroutine, so they must not block.
+func (n *Node) Handle(typ string, handler func(message Message)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers[typ] = handler
+}
+
+// publish encodes and publishes a message.
+func (n *Node) publish(ctx context.Context, message Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return n.pubsub.Publish(ctx, n.channel, payload)
+}
+
+// queueLocation queues the location of the session passed to be published, dropping it if the outbox is full,
+// so that session events never block on the PubSub.
+func (n *Node) queueLocation(s *session.Session, server string, online bool) {
+	identityData := s.Client().IdentityData()
+	data, _ := json.Marshal(Location{
+		XUID:     identityData.XUID,
+		Username: identityData.DisplayName,
+		Node:     n.id,
+		Server:   server,
+		Online:   online,
+	})
+
+	select {
+	case n.outbox <- Message{Type: MessageLocation, Node: n.id, Data: data}:
+	default:
+		n.logger.Debug("dropped location update", "username", identityData.DisplayName)
+	}
+}
+
+// publishOutbox publishes the queued messages in order until the node is closed.
+func (n *Node) publishOutbox() {
+	for {
+		select {
+		case message := <-n.outbox:
+			ctx, cancel := context.WithTimeout(n.ctx, publishTimeout)
+			if err := n.publish(ctx, message); err != nil && n.ctx.Err() == nil {
+				n.logger.Error("failed to publish message", "type", message.Type, "err", err)
+			}
+			cancel()
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe handles the messages published to the cluster, subscribing again after failures, until the node
+// is closed.
+func (n *Node) subscribe() {
+	for {
+		err := n.pubsub.Subscribe(n.ctx, n.channel, n.handle)
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+		n.logger.Error("cluster subscription failed, subscribing again", "err", err)
+	}
+}
+
+// handle decodes a message and passes it to the handler of its type.
+func (n *Node) handle(payload []byte) {
+	var message Message
+	if err := json.Unmarshal(payload, &message); err != nil {
+		n.logger.Debug("received invalid message", "err", err)
+		return
+	}
+
+	n.mu.RLock()
+	handler, ok := n.handlers[message.Type]
+	n.mu.RUnlock()
+	if ok {
+		handler(message)
+	}
+}
+
+func (n *Node) handleLocation(message Message) {
+	var location Location
+	if err := json.Unmarshal(message.Data, &location); err != nil {
+		return
+	}
+
+	key := strings.ToLower(location.Username)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if location.Online {
+		n.locations[key] = location
+	} else if current, ok := n.locations[key]; ok && current.Node == location.Node {
+		// The player may already have connected to another node, whose location must be kept.
+		delete(n.locations, key)
+	}
+}
+
+func (n *Node) handleBroadcast(message Message) {
+	var content broadcast
+	if err := json.Unmarshal(message.Data, &content); err != nil {
+		return
+	}
+
+	for _, s := range n.registry.GetSessions() {
+		_ = s.Client().WritePacket(&packet.Text{TextType: packet.TextTypeRaw, Message: content.Message})
+	}
+}
+
+func (n *Node) handleKick(message Message) {
+	var content kick
+	if err := json.Unmarshal(message.Data, &content); err != nil {
+		return
+	}
+
+	if s := n.registry.GetSessionByUsername(content.Username); s != nil {
+		s.Disconnect(content.Reason)
+	}
+}
+
+func (n *Node) handleChat(message Message) {
+	var content chat
+	if err := json.Unmarshal(message.Data, &content); err != nil {
+		return
+	}
+
+	if s := n.registry.GetSessionByUsername(content.To); s != nil {
+		_ = s.Client().WritePacket(&packet.Text{TextType: packet.TextTypeWhisper, SourceName: content.From, Message: content.Message})
+	}
+}
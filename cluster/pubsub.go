@@ -0,0 +1,53 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+)
+
+// PubSub is a publish/subscribe messaging system shared by the proxies of a cluster.
+type PubSub interface {
+	// Publish publishes a payload to the channel passed.
+	Publish(ctx context.Context, channel string, payload []byte) error
+	// Subscribe calls handler for every payload published to the channel passed, including payloads published
+	// by the caller itself. It blocks until the context is canceled or the subscription failed.
+	Subscribe(ctx context.Context, channel string, handler func(payload []byte)) error
+}
+
+// RedisPubSub implements the PubSub interface using Redis Pub/Sub. Payloads are published using pooled
+// connections, and every subscription uses a connection of its own.
+type RedisPubSub struct {
+	redisClient
+}
+
+// NewRedisPubSub creates a new RedisPubSub using the Redis server of the config passed.
+func NewRedisPubSub(config RedisConfig) *RedisPubSub {
+	return &RedisPubSub{redisClient: redisClient{client: config.client()}}
+}
+
+// Publish ...
+func (p *RedisPubSub) Publish(ctx context.Context, channel string, payload []byte) error {
+	return p.client.Publish(ctx, channel, payload).Err()
+}
+
+// Subscribe ...
+func (p *RedisPubSub) Subscribe(ctx context.Context, channel string, handler func(payload []byte)) error {
+	pubSub := p.client.Subscribe(ctx, channel)
+	defer pubSub.Close()
+	if _, err := pubSub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubSub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case message, ok := <-messages:
+			if !ok {
+				return errors.New("subscription closed")
+			}
+			handler([]byte(message.Payload))
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package cluster
+
+import (
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisConfig configures the connection to a Redis server.
+type RedisConfig struct {
+	// Addr is the address of the Redis server.
+	Addr string
+	// Username and Password are the credentials used to authenticate with the Redis server. No authentication
+	// takes place if Password is empty.
+	Username, Password string
+	// DB is the index of the database used.
+	DB int
+}
+
+// client returns a new client connecting to the Redis server of the config.
+func (c RedisConfig) client() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: c.Addr, Username: c.Username, Password: c.Password, DB: c.DB})
+}
+
+// redisClient holds the client used to execute commands on a Redis server, whose connections are pooled and
+// shared by all callers.
+type redisClient struct {
+	client *redis.Client
+}
+
+// Close closes the connections to Redis.
+func (c *redisClient) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,43 @@
+// Command spectrum-cli is an interactive console managing a Spectrum proxy through its API service.
+//
+// Usage:
+//
+//	spectrum-cli -addr 127.0.0.1:19133 -token secret
+//
+// Commands may also be passed as arguments to execute a single command, such as:
+//
+//	spectrum-cli -addr 127.0.0.1:19133 -token secret kick Steve "Be nice"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cooldogedev/spectrum/api"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:19133", "address of the API service")
+	token := flag.String("token", "", "token used to authenticate with the API service")
+	flag.Parse()
+
+	client, err := api.Dial(*addr, *token)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to connect:", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	console := api.NewConsole(client, os.Stdin, os.Stdout)
+	if args := flag.Args(); len(args) > 0 {
+		err = console.Execute(args[0], args[1:])
+	} else {
+		err = console.Run()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
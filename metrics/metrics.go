@@ -0,0 +1,19 @@
+// Package metrics provides the counters, gauges and histograms exported by Spectrum. Metrics are registered to
+// Registry, a Prometheus registry that is served by Handler and may be added to other registries using
+// prometheus.Gatherers.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry is the registry the metrics of Spectrum are registered to.
+var Registry = prometheus.NewRegistry()
+
+// Handler returns an http.Handler serving the metrics of Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	factory = promauto.With(Registry)
+
+	packetsForwarded   = factory.NewCounterVec(prometheus.CounterOpts{Name: "spectrum_packets_forwarded_total", Help: "Number of packets forwarded, by the side that sent them."}, []string{"direction"})
+	forwardQueueLength = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "spectrum_forward_queue_length", Help: "Number of packets or batches read but not yet written, by the side that sent them."}, []string{"direction"})
+)
+
+var (
+	// SessionsActive is the amount of sessions that are currently logged in.
+	SessionsActive = factory.NewGauge(prometheus.GaugeOpts{Name: "spectrum_sessions_active", Help: "Number of sessions currently logged in."})
+
+	// ClientPacketsForwarded is the amount of packets sent by clients that were forwarded to servers.
+	ClientPacketsForwarded = packetsForwarded.WithLabelValues("client")
+	// ServerPacketsForwarded is the amount of packets sent by servers that were forwarded to clients.
+	ServerPacketsForwarded = packetsForwarded.WithLabelValues("server")
+	// ClientBatchSize is the amount of packets in the batches read from clients.
+	ClientBatchSize = factory.NewHistogram(prometheus.HistogramOpts{Name: "spectrum_client_batch_size", Help: "Number of packets in batches read from clients.", Buckets: prometheus.ExponentialBuckets(1, 2, 8)})
+	// ClientForwardQueue is the amount of client batches that were read but not yet written to servers.
+	ClientForwardQueue = forwardQueueLength.WithLabelValues("client")
+	// ServerForwardQueue is the amount of server packets that were read but not yet written to clients.
+	ServerForwardQueue = forwardQueueLength.WithLabelValues("server")
+	// PacketsDropped is the amount of server packets that were dropped because the forwarding queue was full.
+	PacketsDropped = factory.NewCounter(prometheus.CounterOpts{Name: "spectrum_packets_dropped_total", Help: "Number of server packets dropped because the forwarding queue was full."})
+
+	// Transfers is the amount of transfers that completed successfully.
+	Transfers = factory.NewCounter(prometheus.CounterOpts{Name: "spectrum_transfers_total", Help: "Number of transfers that completed successfully."})
+	// TransferFailures is the amount of transfers that failed.
+	TransferFailures = factory.NewCounter(prometheus.CounterOpts{Name: "spectrum_transfer_failures_total", Help: "Number of transfers that failed."})
+	// DecodeErrors is the amount of client packets that failed to decode.
+	DecodeErrors = factory.NewCounter(prometheus.CounterOpts{Name: "spectrum_decode_errors_total", Help: "Number of client packets that failed to decode."})
+	// ValidationFailures is the amount of client packets that violated the validation limits.
+	ValidationFailures = factory.NewCounter(prometheus.CounterOpts{Name: "spectrum_validation_failures_total", Help: "Number of client packets that violated the validation limits."})
+	// InventoryRejects is the amount of client inventory transactions and item stack requests that failed the
+	// inventory checks.
+	InventoryRejects = factory.NewCounter(prometheus.CounterOpts{Name: "spectrum_inventory_rejects_total", Help: "Number of client inventory packets that failed the inventory checks."})
+	// Fallbacks is the amount of times a session fell back to another server after losing its server.
+	Fallbacks = factory.NewCounter(prometheus.CounterOpts{Name: "spectrum_fallbacks_total", Help: "Number of times a session fell back to another server."})
+)
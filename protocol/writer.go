@@ -3,6 +3,7 @@ package protocol
 import (
 	"encoding/binary"
 	"io"
+	"net"
 	"sync"
 )
 
@@ -14,6 +15,8 @@ type Writer struct {
 	p []byte
 	// pwf is a reusable byte slice used for writing the length of the packet with flags.
 	pwf []byte
+	// buffers is a reusable slice holding the buffers of a vectored write.
+	buffers net.Buffers
 
 	mu sync.Mutex
 }
@@ -52,3 +55,25 @@ func (w *Writer) WriteWithFlags(flags byte, data []byte) error {
 	_, err := w.w.Write(data)
 	return err
 }
+
+// WriteBuffersWithFlags writes a packet made up of the buffers passed with the flags passed, without copying the
+// buffers into a single buffer first. The buffers are written using a single vectored write if the underlying
+// io.Writer supports it, such as a TCP connection. The buffers are not retained once it returns, so that the
+// caller may reuse them.
+func (w *Writer) WriteBuffersWithFlags(flags byte, buffers net.Buffers) error {
+	var size int
+	for _, buf := range buffers {
+		size += len(buf)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	binary.BigEndian.PutUint32(w.pwf, uint32(size+1))
+	w.pwf[4] = flags
+	w.buffers = append(append(w.buffers[:0], w.pwf), buffers...)
+	defer clear(w.buffers)
+
+	vector := w.buffers
+	_, err := vector.WriteTo(w.w)
+	return err
+}
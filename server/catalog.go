@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Catalog is a source of servers maintained outside of the proxy, such as the service catalog of a service mesh.
+type Catalog interface {
+	// Servers returns the servers currently listed by the catalog. Servers that failed their health checks in the
+	// catalog must not be returned.
+	Servers(ctx context.Context) ([]Server, error)
+}
+
+// CatalogWatcher periodically loads the servers of a Catalog and keeps a Registry in sync with them. Any
+// discovery strategy using the registry, such as RoundRobinDiscovery, then routes sessions to the servers
+// listed by the catalog.
+type CatalogWatcher struct {
+	catalog  Catalog
+	registry *Registry
+	interval time.Duration
+	logger   *slog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewCatalogWatcher creates a new CatalogWatcher loading the servers of the catalog into the registry every
+// interval. Watching starts once Start is called.
+func NewCatalogWatcher(catalog Catalog, registry *Registry, interval time.Duration, logger *slog.Logger) *CatalogWatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CatalogWatcher{
+		catalog:  catalog,
+		registry: registry,
+		interval: interval,
+		logger:   logger,
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start starts watching the catalog in the background until Close is called.
+func (w *CatalogWatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			if err := w.Load(w.ctx); err != nil && w.ctx.Err() == nil {
+				w.logger.Error("failed to load servers from catalog", "err", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-w.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Load loads the servers of the catalog once and syncs the registry with them. The registry is left untouched if
+// loading fails, so that an unreachable catalog does not remove every server.
+func (w *CatalogWatcher) Load(ctx context.Context) error {
+	servers, err := w.catalog.Servers(ctx)
+	if err != nil {
+		return err
+	}
+	w.registry.Sync(servers)
+	return nil
+}
+
+// Close stops watching the catalog. The registry keeps the servers it holds.
+func (w *CatalogWatcher) Close() error {
+	w.once.Do(w.cancel)
+	return nil
+}
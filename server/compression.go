@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CompressionSnappy is the name of the snappy compression, which every server supports and which is used
+	// until another compression was negotiated.
+	CompressionSnappy = "snappy"
+	// CompressionZstd is the name of the zstd compression, which compresses large batches, such as chunks,
+	// considerably better at a similar CPU cost.
+	CompressionZstd = "zstd"
+)
+
+// maxDecompressedSize is the maximum size of a single decompressed packet or batch.
+const maxDecompressedSize = 64 * 1024 * 1024
+
+// compression compresses the payloads of packets sent over the spectrum protocol. Compressed payloads are
+// flagged with flagPacketCompressed and the flags of the compression.
+type compression interface {
+	// name returns the name the compression is negotiated with.
+	name() string
+	// flags returns the flags set in addition to flagPacketCompressed on payloads compressed with the compression.
+	flags() byte
+	// compress compresses the payload passed.
+	compress(payload []byte) []byte
+	// decompress decompresses the payload passed.
+	decompress(payload []byte) ([]byte, error)
+}
+
+// snappyCompression implements the snappy compression.
+type snappyCompression struct{}
+
+// name ...
+func (snappyCompression) name() string {
+	return CompressionSnappy
+}
+
+// flags ...
+func (snappyCompression) flags() byte {
+	return 0
+}
+
+// compress ...
+func (snappyCompression) compress(payload []byte) []byte {
+	return snappy.Encode(nil, payload)
+}
+
+// decompress ...
+func (snappyCompression) decompress(payload []byte) ([]byte, error) {
+	length, err := snappy.DecodedLen(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if length > maxDecompressedSize {
+		return nil, fmt.Errorf("decompressed size %d exceeds maximum of %d", length, maxDecompressedSize)
+	}
+	return snappy.Decode(nil, payload)
+}
+
+// zstdCompression implements the zstd compression, optionally using a dictionary shared with the server.
+type zstdCompression struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// zstdKey identifies a zstd compression by its level and the path of its dictionary.
+type zstdKey struct {
+	level      int
+	dictionary string
+}
+
+// cacheDecoder decompresses the session caches held compressed by the proxy for servers that do not support
+// packet.FeatureCacheCompression.
+var cacheDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecompressedSize))
+
+// zstdCompressions holds the zstd compressions created so far by their zstdKey, so that the encoders and
+// decoders, which are safe for concurrent use, are shared by all connections.
+var zstdCompressions sync.Map
+
+// newZstdCompression returns the zstd compression using the zstd level passed and the dictionary at the path
+// passed. A level of zero uses the default level and an empty path uses no dictionary.
+func newZstdCompression(level int, dictionary string) (*zstdCompression, error) {
+	key := zstdKey{level: level, dictionary: dictionary}
+	if c, ok := zstdCompressions.Load(key); ok {
+		return c.(*zstdCompression), nil
+	}
+
+	encoderOpts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	if level != 0 {
+		encoderOpts = append(encoderOpts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+	decoderOpts := []zstd.DOption{zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecompressedSize)}
+	if dictionary != "" {
+		dict, err := os.ReadFile(dictionary)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd dictionary: %w", err)
+		}
+		encoderOpts = append(encoderOpts, zstd.WithEncoderDict(dict))
+		decoderOpts = append(decoderOpts, zstd.WithDecoderDicts(dict))
+	}
+
+	encoder, err := zstd.NewWriter(nil, encoderOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+
+	decoder, err := zstd.NewReader(nil, decoderOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+
+	c, _ := zstdCompressions.LoadOrStore(key, &zstdCompression{encoder: encoder, decoder: decoder})
+	return c.(*zstdCompression), nil
+}
+
+// name ...
+func (*zstdCompression) name() string {
+	return CompressionZstd
+}
+
+// flags ...
+func (*zstdCompression) flags() byte {
+	return flagPacketZstd
+}
+
+// compress ...
+func (c *zstdCompression) compress(payload []byte) []byte {
+	return c.encoder.EncodeAll(payload, nil)
+}
+
+// decompress ...
+func (c *zstdCompression) decompress(payload []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(payload, nil)
+}
@@ -9,12 +9,14 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/cooldogedev/spectrum/protocol"
 	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
-	"github.com/golang/snappy"
 	"github.com/sandertv/gophertunnel/minecraft"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 )
@@ -23,9 +25,10 @@ const (
 	flagPacketDecode byte = 1 << iota
 	flagPacketCompressed
 	flagPacketIsBatch
+	flagPacketZstd
 
-	compressionThreshold int = 256
-	maxBatchPooledSize   int = 1024 * 1024 // 1MB
+	defaultCompressionThreshold int = 256
+	maxBatchPooledSize          int = 1024 * 1024 // 1MB
 )
 
 var (
@@ -61,15 +64,36 @@ type Conn struct {
 
 	runtimeID uint64
 	uniqueID  int64
+	// features holds the features of the spectrum protocol enabled for the connection, which is set once the
+	// ConnectionResponse packet was handled.
+	features uint32
 
 	syncProtocol bool
 	cache        []byte
+	cacheVersion uint64
+	cacheSlots   []spectrumpacket.CacheSlot
+	metadata     map[string]string
+	token        []byte
+	payload      []byte
+	registries   []spectrumpacket.RegistryHash
+
+	// compression is the compression negotiated with the server, which is used for writing once negotiated is
+	// set. Until then, snappy is used.
+	compression compression
+	negotiated  atomic.Bool
+	zstd        *zstdCompression
+	threshold   int
 
 	gameData minecraft.GameData
-	shieldID int32
+	// shieldID is the runtime ID of the shield in the item registry of the server, which is updated by every
+	// ItemRegistry packet the server sends decoded.
+	shieldID atomic.Int32
 
 	protocol minecraft.Protocol
 	pool     packet.Pool
+	// decode holds the IDs of the packets decoded or not decoded once the player spawned, or nil if every packet
+	// the server marks as to be decoded is decoded. It may be replaced while packets are read.
+	decode atomic.Pointer[decodeFilter]
 
 	deferredPackets []any
 	expectedIds     []uint32
@@ -105,6 +129,8 @@ func NewConn(conn io.ReadWriteCloser, client *minecraft.Conn, logger *slog.Logge
 		protocol: proto,
 		pool:     proto.Packets(false),
 
+		threshold: defaultCompressionThreshold,
+
 		connected: make(chan struct{}),
 		spawned:   make(chan struct{}),
 	}
@@ -145,7 +171,9 @@ func (c *Conn) ReadPacket() (any, error) {
 	return c.ReadPacket()
 }
 
-// WriteBatch writes the provided packets to the underlying connection.
+// WriteBatch writes the provided packets to the underlying connection. Batches small enough to be written
+// uncompressed are written straight from the payloads passed without copying them. The payloads are not
+// retained once it returns.
 func (c *Conn) WriteBatch(payloads [][]byte) error {
 	select {
 	case <-c.ctx.Done():
@@ -158,6 +186,14 @@ func (c *Conn) WriteBatch(payloads [][]byte) error {
 		return nil
 	}
 
+	size := 4 * len(payloads)
+	for _, payload := range payloads {
+		size += len(payload)
+	}
+	if size <= c.threshold {
+		return c.writeBatchVectored(payloads)
+	}
+
 	buf := batchPool.Get().(*bytes.Buffer)
 	defer func() {
 		if buf.Cap() == maxBatchPooledSize {
@@ -174,10 +210,37 @@ func (c *Conn) WriteBatch(payloads [][]byte) error {
 		buf.Write(payload)
 	}
 
-	if buf.Len() > compressionThreshold {
-		return c.writer.WriteWithFlags(flagPacketCompressed|flagPacketIsBatch, snappy.Encode(nil, buf.Bytes()))
+	return c.write(flagPacketIsBatch, buf.Bytes())
+}
+
+// WriteEncodedBatch writes a batch that was already encoded into a single buffer, in which every packet is prefixed
+// with its length as a 32-bit little-endian integer, like the batches written by WriteBatch. The batch is not
+// retained once it returns.
+func (c *Conn) WriteEncodedBatch(batch []byte) error {
+	select {
+	case <-c.ctx.Done():
+		return context.Cause(c.ctx)
+	default:
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return c.write(flagPacketIsBatch, batch)
+}
+
+// writeBatchVectored writes a batch that is not compressed straight from the payloads passed, which are only
+// referenced by the vectored write instead of being copied into a single buffer first. The payloads may be reused
+// by the caller once it returns.
+func (c *Conn) writeBatchVectored(payloads [][]byte) error {
+	lengths := make([]byte, 4*len(payloads))
+	buffers := make(net.Buffers, 0, 2*len(payloads))
+	for i, payload := range payloads {
+		lenBuf := lengths[i*4 : i*4+4]
+		binary.LittleEndian.PutUint32(lenBuf, uint32(len(payload)))
+		buffers = append(buffers, lenBuf, payload)
 	}
-	return c.writer.WriteWithFlags(flagPacketIsBatch, buf.Bytes())
+	return c.writer.WriteBuffersWithFlags(flagPacketIsBatch, buffers)
 }
 
 // WritePacket encodes and writes the provided packet to the underlying connection.
@@ -200,20 +263,13 @@ func (c *Conn) WritePacket(pk packet.Packet) error {
 	if err := header.Write(buf); err != nil {
 		return err
 	}
-	pk.Marshal(c.protocol.NewWriter(buf, c.shieldID))
-
-	if buf.Len() > compressionThreshold {
-		return c.writer.WriteWithFlags(flagPacketCompressed, snappy.Encode(nil, buf.Bytes()))
-	}
-	return c.writer.WriteWithFlags(0, buf.Bytes())
+	pk.Marshal(c.protocol.NewWriter(buf, c.shieldID.Load()))
+	return c.write(0, buf.Bytes())
 }
 
 // Write writes provided byte slice to the underlying connection.
 func (c *Conn) Write(p []byte) (int, error) {
-	if len(p) > compressionThreshold {
-		return len(p), c.writer.WriteWithFlags(flagPacketCompressed, snappy.Encode(nil, p))
-	}
-	return len(p), c.writer.WriteWithFlags(0, p)
+	return len(p), c.write(0, p)
 }
 
 // DoConnect sends a ConnectionRequest packet to initiate the connection sequence.
@@ -244,10 +300,100 @@ func (c *Conn) DoConnect() error {
 	if err != nil {
 		return err
 	}
+
+	if len(c.metadata) > 0 {
+		if err := c.writeHandshakeMetadata(); err != nil {
+			return err
+		}
+	}
 	c.logger.Debug("sent connection_request, expecting connection_response")
 	return nil
 }
 
+// SetHandshakeMetadata sets the metadata sent to the server in a HandshakeMetadata packet during DoConnect.
+// No HandshakeMetadata packet is sent if the metadata is empty.
+func (c *Conn) SetHandshakeMetadata(metadata map[string]string) {
+	c.metadata = metadata
+}
+
+// SetCacheVersion sets the version of the cache reported to servers supporting packet.FeatureCacheVersion.
+func (c *Conn) SetCacheVersion(version uint64) {
+	c.cacheVersion = version
+}
+
+// SetCacheSlots sets the named cache slots sent to servers supporting packet.FeatureCacheSlots.
+func (c *Conn) SetCacheSlots(slots []spectrumpacket.CacheSlot) {
+	c.cacheSlots = slots
+}
+
+// SetToken sets the token the proxy authenticates itself with if the server supports FeatureToken.
+func (c *Conn) SetToken(token []byte) {
+	c.token = token
+}
+
+// SetRegistries sets the hashes of the registry packets cached by the proxy, which are declared to servers
+// supporting packet.FeatureCachedRegistries.
+func (c *Conn) SetRegistries(registries []spectrumpacket.RegistryHash) {
+	c.registries = registries
+}
+
+// SetTransferPayload sets the payload forwarded to the server if it supports packet.FeatureTransferPayload, which
+// the server the player transferred from attached to the transfer.
+func (c *Conn) SetTransferPayload(payload []byte) {
+	c.payload = payload
+}
+
+// SetCompression sets the compression offered to servers supporting packet.FeatureCompression. The compression is
+// used for writing once the server sent a packet compressed with it, which servers that do not support it never
+// do, so snappy keeps being used for those. dictionary is the path of the zstd dictionary shared with the server,
+// which may be empty to use no dictionary, and level is the zstd level, which may be zero to use the default
+// level. Snappy is always supported and need not be set.
+func (c *Conn) SetCompression(name string, level int, dictionary string) error {
+	switch name {
+	case "", CompressionSnappy:
+		c.compression = nil
+	case CompressionZstd:
+		compression, err := newZstdCompression(level, dictionary)
+		if err != nil {
+			return err
+		}
+		c.compression = compression
+		c.zstd = compression
+	default:
+		return fmt.Errorf("unknown compression %q", name)
+	}
+	return nil
+}
+
+// SetCompressionThreshold sets the size in bytes a payload written to the server must exceed to be compressed.
+// Smaller payloads, such as batches only holding movement, are written uncompressed, as compressing them costs
+// CPU without reducing their size notably. Values of zero or less use the default of 256 bytes.
+func (c *Conn) SetCompressionThreshold(threshold int) {
+	if threshold <= 0 {
+		threshold = defaultCompressionThreshold
+	}
+	c.threshold = threshold
+}
+
+// SetDecode sets the IDs of the game packets that are decoded once the player spawned, or, if exclude is true, the
+// IDs of the game packets that are not decoded. Packets that are not decoded are returned as raw payloads even if
+// the server marks them as to be decoded. Spectrum packets and the packets of the connection sequence are always
+// decoded. A nil set decodes every packet the server marks as to be decoded. It may be called while packets are
+// read.
+func (c *Conn) SetDecode(ids map[uint32]struct{}, exclude bool) {
+	if ids == nil {
+		c.decode.Store(nil)
+		return
+	}
+	c.decode.Store(&decodeFilter{ids: ids, exclude: exclude})
+}
+
+// decodeFilter is the set of packet IDs set using SetDecode.
+type decodeFilter struct {
+	ids     map[uint32]struct{}
+	exclude bool
+}
+
 // OnConnect invokes the provided function once the connection sequence is complete or has failed.
 func (c *Conn) OnConnect(fn func(error)) {
 	c.onConnect = fn
@@ -265,8 +411,42 @@ func (c *Conn) WaitConnect(ctx context.Context) error {
 	}
 }
 
+// Prepare reads and handles packets until the connection sequence has completed, deferring any other packets read
+// meanwhile so that ReadPacket returns them once the player spawned. It allows completing the connection sequence
+// before ReadPacket is called, such as while the player is still playing on another server. The connection is
+// closed if the context is canceled first. Prepare must not be called concurrently with ReadPacket.
+func (c *Conn) Prepare(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		_ = c.CloseWithError(context.Cause(ctx))
+	})
+	defer stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return context.Cause(c.ctx)
+		case <-c.connected:
+			return nil
+		default:
+		}
+
+		p, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		if pk, ok := p.(packet.Packet); ok {
+			if err := c.handlePacket(pk); err != nil {
+				return fmt.Errorf("failed to handle packet %v: %w", pk.ID(), err)
+			}
+		} else {
+			c.deferPacket(p)
+		}
+	}
+}
+
 // DoSpawn sends a SetLocalPlayerAsInitialised packet to spawn the player in the server
-// and signals that packets can now be read.
+// and signals that packets can now be read. Servers that did not negotiate FeatureClientCache are sent the
+// ClientCacheStatus packet first.
 func (c *Conn) DoSpawn() error {
 	select {
 	case <-c.ctx.Done():
@@ -275,8 +455,10 @@ func (c *Conn) DoSpawn() error {
 	}
 	close(c.spawned)
 
-	if err := c.WritePacket(&packet.ClientCacheStatus{Enabled: c.client.ClientCacheEnabled()}); err != nil {
-		return err
+	if c.features&spectrumpacket.FeatureClientCache == 0 {
+		if err := c.WritePacket(&packet.ClientCacheStatus{Enabled: c.client.ClientCacheEnabled()}); err != nil {
+			return err
+		}
 	}
 	return c.WritePacket(&packet.SetLocalPlayerAsInitialised{EntityRuntimeID: c.runtimeID})
 }
@@ -286,9 +468,25 @@ func (c *Conn) GameData() minecraft.GameData {
 	return c.gameData
 }
 
-// ShieldID returns the shield id set for the connection by the StartGame packet.
+// Features returns the features of the spectrum protocol enabled for the connection, which are the features both
+// the proxy and the server support. It returns zero until the server sent the ConnectionResponse packet.
+func (c *Conn) Features() uint32 {
+	return c.features
+}
+
+// ShieldID returns the runtime ID of the shield in the most recent item registry sent by the server.
 func (c *Conn) ShieldID() int32 {
-	return c.shieldID
+	return c.shieldID.Load()
+}
+
+// updateShieldID updates the shield ID of the connection using the item registry passed.
+func (c *Conn) updateShieldID(pk *packet.ItemRegistry) {
+	for _, item := range pk.Items {
+		if item.Name == "minecraft:shield" {
+			c.shieldID.Store(int32(item.RuntimeID))
+			return
+		}
+	}
 }
 
 // Context returns the connection's context. The context is canceled when the connection is closed,
@@ -299,12 +497,13 @@ func (c *Conn) Context() context.Context {
 
 // Close closes the underlying connection.
 func (c *Conn) Close() error {
-	c.CloseWithError(errors.New("closed by application"))
-	return nil
+	return c.CloseWithError(errors.New("closed by application"))
 }
 
-// CloseWithError closes the underlying connection.
-func (c *Conn) CloseWithError(err error) {
+// CloseWithError closes the underlying connection using the provided error as the cause of the
+// connection's context. It returns the error encountered while closing the underlying connection,
+// if any. Calls after the first one have no effect and return nil.
+func (c *Conn) CloseWithError(err error) (closeErr error) {
 	c.once.Do(func() {
 		var connected bool
 		select {
@@ -317,8 +516,9 @@ func (c *Conn) CloseWithError(err error) {
 			c.onConnect(err)
 		}
 		c.cancelFunc(err)
-		_ = c.conn.Close()
+		closeErr = c.conn.Close()
 	})
+	return
 }
 
 // read reads a packet from the connection, handling decompression and decoding as necessary.
@@ -337,7 +537,7 @@ func (c *Conn) read() (pk any, err error) {
 
 	var decompressed []byte
 	if isCompressed {
-		decompressed, err = snappy.Decode(nil, payload[1:])
+		decompressed, err = c.decompress(flags, payload[1:])
 		if err != nil {
 			return nil, err
 		}
@@ -345,7 +545,7 @@ func (c *Conn) read() (pk any, err error) {
 		decompressed = payload[1:]
 	}
 
-	if !isDecodeNeeded {
+	if !isDecodeNeeded && !alwaysDecoded(decompressed) {
 		return decompressed, nil
 	}
 
@@ -362,16 +562,115 @@ func (c *Conn) read() (pk any, err error) {
 		return nil, err
 	}
 
+	if !c.decoded(header.PacketID) {
+		return decompressed, nil
+	}
+
 	factory, ok := c.pool[header.PacketID]
 	if !ok {
 		fmt.Printf("unknown packet ID %v\n", header.PacketID)
 		return nil, fmt.Errorf("unknown packet ID %v", header.PacketID)
 	}
 	pk = factory()
-	pk.(packet.Packet).Marshal(c.protocol.NewReader(buf, c.shieldID, false))
+	if header.PacketID >= spectrumpacket.IDConnectionRequest {
+		pk.(packet.Packet).Marshal(spectrumpacket.NewReader(buf, c.shieldID.Load()))
+		return pk, nil
+	}
+	pk.(packet.Packet).Marshal(c.protocol.NewReader(buf, c.shieldID.Load(), false))
+	if registry, ok := pk.(*packet.ItemRegistry); ok {
+		c.updateShieldID(registry)
+	}
 	return pk, nil
 }
 
+// decoded returns whether a packet with the ID passed that the server marked as to be decoded is decoded, which is
+// the case for every packet until the player spawned and for the packets passing the decode filter afterwards.
+func (c *Conn) decoded(id uint32) bool {
+	filter := c.decode.Load()
+	if filter == nil || id >= spectrumpacket.IDConnectionRequest || id == packet.IDStartGame || id == packet.IDItemRegistry {
+		return true
+	}
+
+	select {
+	case <-c.spawned:
+		_, ok := filter.ids[id]
+		return ok != filter.exclude
+	default:
+		return true
+	}
+}
+
+// alwaysDecoded returns whether the packet in the payload passed is decoded even if the server did not mark it as to
+// be decoded, which is the case for the StartGame and ItemRegistry packets the game data and shield ID are read from.
+func alwaysDecoded(payload []byte) bool {
+	header, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return false
+	}
+	id := uint32(header & 0x3ff)
+	return id == packet.IDStartGame || id == packet.IDItemRegistry
+}
+
+// write writes the payload passed with the flags passed, compressing it with the current compression if it
+// exceeds the threshold of the connection.
+func (c *Conn) write(flags byte, payload []byte) error {
+	if len(payload) <= c.threshold {
+		return c.writer.WriteWithFlags(flags, payload)
+	}
+
+	var codec compression = snappyCompression{}
+	if c.negotiated.Load() {
+		codec = c.compression
+	}
+	return c.writer.WriteWithFlags(flags|flagPacketCompressed|codec.flags(), codec.compress(payload))
+}
+
+// decompress decompresses a payload read from the server using the compression indicated by its flags. The
+// first payload compressed with the compression offered to the server completes the negotiation.
+func (c *Conn) decompress(flags byte, payload []byte) ([]byte, error) {
+	var codec compression = snappyCompression{}
+	if flags&flagPacketZstd != 0 {
+		if c.zstd == nil {
+			return nil, errors.New("received zstd compressed packet without offering zstd")
+		}
+		codec = c.zstd
+	}
+
+	if c.compression != nil && codec.name() == c.compression.name() && c.negotiated.CompareAndSwap(false, true) {
+		c.logger.Debug("negotiated compression", "compression", codec.name())
+	}
+	return codec.decompress(payload)
+}
+
+// writeHandshakeMetadata validates the connection's metadata against the size limits of the HandshakeMetadata
+// packet and writes it to the server.
+func (c *Conn) writeHandshakeMetadata() error {
+	if len(c.metadata) > spectrumpacket.MaxHandshakeMetadataEntries {
+		return fmt.Errorf("handshake metadata has %d entries, maximum is %d", len(c.metadata), spectrumpacket.MaxHandshakeMetadataEntries)
+	}
+
+	entries := make([]spectrumpacket.MetadataEntry, 0, len(c.metadata))
+	for key, value := range c.metadata {
+		if len(key) > spectrumpacket.MaxHandshakeMetadataKeyLength {
+			return fmt.Errorf("handshake metadata key %q exceeds %d bytes", key, spectrumpacket.MaxHandshakeMetadataKeyLength)
+		}
+
+		if len(value) > spectrumpacket.MaxHandshakeMetadataValueLength {
+			return fmt.Errorf("handshake metadata value of %q exceeds %d bytes", key, spectrumpacket.MaxHandshakeMetadataValueLength)
+		}
+		entries = append(entries, spectrumpacket.MetadataEntry{Key: key, Value: value})
+	}
+
+	slices.SortFunc(entries, func(a, b spectrumpacket.MetadataEntry) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	if err := c.WritePacket(&spectrumpacket.HandshakeMetadata{Entries: entries}); err != nil {
+		return err
+	}
+	c.logger.Debug("sent handshake_metadata", "metadata", c.metadata)
+	return nil
+}
+
 // deferPacket defers a packet to be returned later in ReadPacket().
 func (c *Conn) deferPacket(pk any) {
 	c.deferredPackets = append(c.deferredPackets, pk)
@@ -425,9 +724,87 @@ func (c *Conn) handleConnectionResponse(pk *spectrumpacket.ConnectionResponse) e
 	c.expect(packet.IDStartGame)
 	c.runtimeID = pk.RuntimeID
 	c.uniqueID = pk.UniqueID
+	if pk.Features == 0 {
+		return nil
+	}
+
+	c.features = pk.Features & c.supportedFeatures()
+	features := &spectrumpacket.ConnectionFeatures{Features: c.features}
+	if c.features&spectrumpacket.FeatureToken != 0 {
+		features.Token = c.token
+	}
+	if c.features&spectrumpacket.FeatureCompression != 0 {
+		features.Compressions = []string{c.compression.name()}
+	}
+	if c.features&spectrumpacket.FeatureTransferPayload != 0 {
+		features.TransferPayload = c.payload
+	}
+	if c.features&spectrumpacket.FeatureCachedRegistries != 0 {
+		features.Registries = c.registries
+	}
+	if c.features&spectrumpacket.FeatureCacheVersion != 0 {
+		features.CacheVersion = c.cacheVersion
+	}
+	if c.features&spectrumpacket.FeatureCacheSlots != 0 {
+		slots, err := c.negotiatedCacheSlots()
+		if err != nil {
+			return err
+		}
+		features.CacheSlots = slots
+	}
+	if err := c.WritePacket(features); err != nil {
+		return err
+	}
+	c.logger.Debug("sent connection_features", "features", c.features)
+
+	// The client cache status is sent before the server sends any chunks, so that chunks are sent using the blob
+	// cache if the client supports it, just like a client does right after logging in. Other servers are sent it
+	// by DoSpawn.
+	if c.features&spectrumpacket.FeatureClientCache != 0 {
+		return c.WritePacket(&packet.ClientCacheStatus{Enabled: c.client.ClientCacheEnabled()})
+	}
 	return nil
 }
 
+// supportedFeatures returns the features of the spectrum protocol the connection supports, which excludes the
+// features it has nothing to send for, such as FeatureToken if no token was set.
+func (c *Conn) supportedFeatures() uint32 {
+	features := spectrumpacket.FeatureTransferPayload | spectrumpacket.FeatureClientCache | spectrumpacket.FeatureCacheVersion |
+		spectrumpacket.FeatureCacheCompression | spectrumpacket.FeatureCacheHash | spectrumpacket.FeatureCacheSlots
+	if c.token != nil {
+		features |= spectrumpacket.FeatureToken
+	}
+	if c.compression != nil {
+		features |= spectrumpacket.FeatureCompression
+	}
+	if c.registries != nil {
+		features |= spectrumpacket.FeatureCachedRegistries
+	}
+	return features
+}
+
+// negotiatedCacheSlots returns the cache slots of the connection, which are decompressed if the server does not
+// support packet.FeatureCacheCompression.
+func (c *Conn) negotiatedCacheSlots() ([]spectrumpacket.CacheSlot, error) {
+	if c.features&spectrumpacket.FeatureCacheCompression != 0 {
+		return c.cacheSlots, nil
+	}
+
+	slots := slices.Clone(c.cacheSlots)
+	for i, slot := range slots {
+		if !slot.Compressed {
+			continue
+		}
+
+		cache, err := cacheDecoder.DecodeAll(slot.Cache, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress cache slot %s: %w", slot.Name, err)
+		}
+		slots[i].Cache, slots[i].Compressed = cache, false
+	}
+	return slots, nil
+}
+
 // handleStartGame handles the StartGame packet.
 func (c *Conn) handleStartGame(pk *packet.StartGame) error {
 	// Check if the conn's protocol is expecting the item registry. Otherwise, go straight to updating the chunk radius properly.
@@ -482,12 +859,6 @@ func (c *Conn) handleItemRegistry(pk *packet.ItemRegistry) error {
 	c.logger.Debug("received item_registry, expecting chunk_radius_updated")
 	c.expect(packet.IDChunkRadiusUpdated)
 	c.gameData.Items = pk.Items
-	for _, item := range pk.Items {
-		if item.Name == "minecraft:shield" {
-			c.shieldID = int32(item.RuntimeID)
-		}
-	}
-
 	if err := c.WritePacket(&packet.RequestChunkRadius{ChunkRadius: 16}); err != nil {
 		return err
 	}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+)
+
+// consistentHashReplicas is the amount of points a server with a weight of 1 is placed on the ring with. More
+// points spread players more evenly across servers.
+const consistentHashReplicas = 128
+
+// ConsistentHashDiscovery implements the FallbackChainDiscovery interface by hashing the XUID of players onto a
+// ring of the servers of a Registry, so that a player joining again lands on the same server, such as a server
+// hosting the player's own world. When servers are registered or removed, only the players whose position on the
+// ring is affected are routed to a different server. Players without an XUID are hashed by their identity UUID.
+type ConsistentHashDiscovery struct {
+	registry        *Registry
+	fallbackServers []string
+
+	servers []Server
+	ring    []ringPoint
+	mu      sync.Mutex
+}
+
+// ringPoint is a point of a server on the ring of a ConsistentHashDiscovery.
+type ringPoint struct {
+	hash uint64
+	addr string
+}
+
+// NewConsistentHashDiscovery creates a new ConsistentHashDiscovery routing players to the servers of the registry
+// passed. Servers are placed on the ring proportionally to their weights. The fallback servers are tried in order
+// when the server of a session fails. Without fallback servers, the servers following the player's server on the
+// ring are tried instead, so that the player keeps being routed consistently.
+func NewConsistentHashDiscovery(registry *Registry, fallbackServers ...string) *ConsistentHashDiscovery {
+	return &ConsistentHashDiscovery{
+		registry:        registry,
+		fallbackServers: fallbackServers,
+	}
+}
+
+// Discover ...
+func (d *ConsistentHashDiscovery) Discover(conn *minecraft.Conn) (string, error) {
+	addrs := d.walk(conn, 1)
+	if len(addrs) == 0 {
+		return "", errors.New("no servers registered")
+	}
+	return addrs[0], nil
+}
+
+// DiscoverFallback ...
+func (d *ConsistentHashDiscovery) DiscoverFallback(conn *minecraft.Conn) (string, error) {
+	if len(d.fallbackServers) > 0 {
+		return d.fallbackServers[0], nil
+	}
+	return d.Discover(conn)
+}
+
+// DiscoverFallbacks ...
+func (d *ConsistentHashDiscovery) DiscoverFallbacks(conn *minecraft.Conn) ([]string, error) {
+	if len(d.fallbackServers) > 0 {
+		return d.fallbackServers, nil
+	}
+
+	addrs := d.walk(conn, -1)
+	if len(addrs) == 0 {
+		return nil, errors.New("no servers registered")
+	}
+	return addrs, nil
+}
+
+// walk returns up to n distinct servers in the order they follow the player on the ring, or all of them if n
+// is negative.
+func (d *ConsistentHashDiscovery) walk(conn *minecraft.Conn, n int) []string {
+	identityData := conn.IdentityData()
+	key := identityData.XUID
+	if key == "" {
+		key = identityData.Identity
+	}
+	hash := hashKey(key)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rebuild()
+	if len(d.ring) == 0 {
+		return nil
+	}
+
+	if n < 0 {
+		n = len(d.servers)
+	}
+
+	start, _ := slices.BinarySearchFunc(d.ring, hash, func(point ringPoint, hash uint64) int {
+		return cmp.Compare(point.hash, hash)
+	})
+
+	addrs := make([]string, 0, n)
+	for i := 0; i < len(d.ring) && len(addrs) < n; i++ {
+		addr := d.ring[(start+i)%len(d.ring)].addr
+		if !slices.Contains(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// rebuild rebuilds the ring if the servers of the registry changed since it was last built.
+func (d *ConsistentHashDiscovery) rebuild() {
+	servers := d.registry.Servers()
+	if d.ring != nil && slices.Equal(servers, d.servers) {
+		return
+	}
+
+	d.servers = servers
+	d.ring = make([]ringPoint, 0, len(servers)*consistentHashReplicas)
+	for _, srv := range servers {
+		for i := range srv.weight() * consistentHashReplicas {
+			d.ring = append(d.ring, ringPoint{hash: hashKey(srv.Addr + "#" + strconv.Itoa(i)), addr: srv.Addr})
+		}
+	}
+	slices.SortFunc(d.ring, func(a, b ringPoint) int {
+		return cmp.Compare(a.hash, b.hash)
+	})
+}
+
+// hashKey hashes the key passed onto the ring.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
+}
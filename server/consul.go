@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// ConsulCatalog implements the Catalog interface using the health API of a Consul agent. It lists the instances
+// of a service that pass all of their health checks, so instances registered with a TTL check disappear once they
+// stop refreshing it. The weight of an instance is taken from its passing weight, and its capacity from the
+// "capacity" service meta key, if present.
+type ConsulCatalog struct {
+	client  *api.Client
+	service string
+}
+
+// NewConsulCatalog creates a new ConsulCatalog listing the instances of the service passed using the Consul
+// client passed, which may be created using api.NewClient.
+func NewConsulCatalog(client *api.Client, service string) *ConsulCatalog {
+	return &ConsulCatalog{client: client, service: service}
+}
+
+// Servers ...
+func (c *ConsulCatalog) Servers(ctx context.Context) ([]Server, error) {
+	entries, _, err := c.client.Health().Service(c.service, "", true, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]Server, 0, len(entries))
+	for _, entry := range entries {
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+
+		capacity, _ := strconv.Atoi(entry.Service.Meta["capacity"])
+		servers = append(servers, Server{
+			Addr:     net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)),
+			Weight:   entry.Service.Weights.Passing,
+			Capacity: capacity,
+		})
+	}
+	return servers, nil
+}
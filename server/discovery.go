@@ -1,6 +1,10 @@
 package server
 
-import "github.com/sandertv/gophertunnel/minecraft"
+import (
+	"errors"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+)
 
 // Discovery defines an interface for discovering servers based on a player's connection.
 type Discovery interface {
@@ -10,17 +14,42 @@ type Discovery interface {
 	DiscoverFallback(conn *minecraft.Conn) (string, error)
 }
 
-// StaticDiscovery implements the Discovery interface with static server addresses.
+// FallbackChainDiscovery may be implemented by a Discovery to provide an ordered chain of fallback servers
+// rather than a single one. When the server of a session fails, each server of the chain is tried in order
+// until the session was transferred to one of them, and the session is only closed once all of them failed.
+type FallbackChainDiscovery interface {
+	Discovery
+	// DiscoverFallbacks determines the fallback servers, in the order they are tried in.
+	DiscoverFallbacks(conn *minecraft.Conn) ([]string, error)
+}
+
+// ConnectionObserver may be implemented by a Discovery to be notified when sessions connect to and disconnect
+// from servers, allowing it to take the load of servers into account. A session is connected to a server once it
+// spawned on it, and disconnected once it spawned on another server or was closed.
+type ConnectionObserver interface {
+	// ServerConnected is called when a session connected to the server with the address passed.
+	ServerConnected(addr string)
+	// ServerDisconnected is called when a session disconnected from the server with the address passed.
+	ServerDisconnected(addr string)
+}
+
+// StaticDiscovery implements the FallbackChainDiscovery interface with static server addresses.
 type StaticDiscovery struct {
-	server         string
-	fallbackServer string
+	server          string
+	fallbackServers []string
 }
 
 // NewStaticDiscovery creates a new StaticDiscovery with the given server addresses.
 func NewStaticDiscovery(server string, fallbackServer string) *StaticDiscovery {
+	return NewStaticChainDiscovery(server, fallbackServer)
+}
+
+// NewStaticChainDiscovery creates a new StaticDiscovery with the given server address and a chain of fallback
+// server addresses, which are tried in order.
+func NewStaticChainDiscovery(server string, fallbackServers ...string) *StaticDiscovery {
 	return &StaticDiscovery{
-		server:         server,
-		fallbackServer: fallbackServer,
+		server:          server,
+		fallbackServers: fallbackServers,
 	}
 }
 
@@ -31,5 +60,16 @@ func (s *StaticDiscovery) Discover(_ *minecraft.Conn) (string, error) {
 
 // DiscoverFallback ...
 func (s *StaticDiscovery) DiscoverFallback(_ *minecraft.Conn) (string, error) {
-	return s.fallbackServer, nil
+	if len(s.fallbackServers) == 0 {
+		return "", errors.New("no fallback servers configured")
+	}
+	return s.fallbackServers[0], nil
+}
+
+// DiscoverFallbacks ...
+func (s *StaticDiscovery) DiscoverFallbacks(_ *minecraft.Conn) ([]string, error) {
+	if len(s.fallbackServers) == 0 {
+		return nil, errors.New("no fallback servers configured")
+	}
+	return s.fallbackServers, nil
 }
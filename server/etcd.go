@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// EtcdCatalog implements the Catalog interface using an etcd v3 cluster. It lists the keys under a prefix, each
+// holding a server of the form {"addr": "10.0.0.1:19133", "weight": 1, "capacity": 100}. Servers are expected to
+// attach their key to a lease they keep alive, so that etcd deletes it once they stop doing so.
+type EtcdCatalog struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// NewEtcdCatalog creates a new EtcdCatalog listing the servers under the prefix passed using the etcd client
+// passed, which may be created using clientv3.New.
+func NewEtcdCatalog(client *clientv3.Client, prefix string) *EtcdCatalog {
+	return &EtcdCatalog{client: client, prefix: prefix}
+}
+
+// etcdServer is the value of a key listed by an EtcdCatalog.
+type etcdServer struct {
+	Addr     string `json:"addr"`
+	Weight   int    `json:"weight"`
+	Capacity int    `json:"capacity"`
+}
+
+// Servers ...
+func (c *EtcdCatalog) Servers(ctx context.Context) ([]Server, error) {
+	resp, err := c.client.Get(ctx, c.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]Server, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var entry etcdServer
+		if err := json.Unmarshal(kv.Value, &entry); err != nil || entry.Addr == "" {
+			continue
+		}
+		servers = append(servers, Server{Addr: entry.Addr, Weight: entry.Weight, Capacity: entry.Capacity})
+	}
+	return servers, nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum/transport"
+)
+
+// healthCheckFailures is the amount of consecutive failed health checks after which a server is marked unhealthy.
+const healthCheckFailures = 2
+
+// HealthChecker periodically checks the servers of a Registry by dialing them using a transport, marking servers
+// that failed healthCheckFailures checks in a row unhealthy and servers that passed a check healthy again.
+// Unhealthy servers are excluded from discovery, and sessions given the registry refuse to transfer to them.
+type HealthChecker struct {
+	registry  *Registry
+	transport transport.Transport
+	interval  time.Duration
+	timeout   time.Duration
+	logger    *slog.Logger
+
+	failures map[string]int
+	mu       sync.Mutex
+
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewHealthChecker creates a new HealthChecker checking the servers of the registry passed every interval, failing
+// checks that take longer than timeout. The checks start running once Start is called.
+func NewHealthChecker(registry *Registry, transport transport.Transport, interval time.Duration, timeout time.Duration, logger *slog.Logger) *HealthChecker {
+	return &HealthChecker{
+		registry:  registry,
+		transport: transport,
+		interval:  interval,
+		timeout:   timeout,
+		logger:    logger,
+
+		failures: make(map[string]int),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Start starts checking the servers in the background until Close is called.
+func (h *HealthChecker) Start() {
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			h.Check()
+			select {
+			case <-ticker.C:
+			case <-h.closed:
+				return
+			}
+		}
+	}()
+}
+
+// Check checks all servers of the registry once, blocking until all checks completed.
+func (h *HealthChecker) Check() {
+	var wg sync.WaitGroup
+	for _, srv := range h.registry.AllServers() {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			h.report(addr, h.check(addr))
+		}(srv.Addr)
+	}
+	wg.Wait()
+}
+
+// Close stops checking the servers.
+func (h *HealthChecker) Close() error {
+	h.once.Do(func() {
+		close(h.closed)
+	})
+	return nil
+}
+
+// check checks the server with the address passed by dialing it.
+func (h *HealthChecker) check(addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	conn, err := h.transport.Dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// report updates the health of the server with the address passed after a check that failed with err, or
+// passed if err is nil.
+func (h *HealthChecker) report(addr string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		if h.failures[addr] >= healthCheckFailures {
+			h.logger.Info("server recovered", "addr", addr)
+		}
+		delete(h.failures, addr)
+		h.registry.SetHealthy(addr, true)
+		return
+	}
+
+	h.failures[addr]++
+	h.logger.Debug("health check failed", "addr", addr, "err", err)
+	if h.failures[addr] == healthCheckFailures {
+		h.logger.Warn("server is unhealthy", "addr", addr, "err", err)
+		h.registry.SetHealthy(addr, false)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+)
+
+// LatencySource provides the estimated round-trip time between the proxy and a server, such as the
+// transport.Latency transport.
+type LatencySource interface {
+	// RTT returns the estimated round-trip time to the server with the address passed, and whether an estimate
+	// is available.
+	RTT(addr string) (time.Duration, bool)
+}
+
+// LatencyDiscovery implements the FallbackChainDiscovery interface by routing every session to the server of a
+// Registry with the lowest round-trip time from the proxy, which suits proxies fronting servers in multiple
+// regions. Servers without an estimate are only used if no server has one. Unhealthy servers are excluded by the
+// registry.
+type LatencyDiscovery struct {
+	registry        *Registry
+	source          LatencySource
+	fallbackServers []string
+}
+
+// NewLatencyDiscovery creates a new LatencyDiscovery routing sessions to the servers of the registry passed using
+// the round-trip times provided by source. The fallback servers are tried in order when the server of a session
+// fails. Without fallback servers, the servers of the registry are tried from the lowest to the highest
+// round-trip time instead.
+func NewLatencyDiscovery(registry *Registry, source LatencySource, fallbackServers ...string) *LatencyDiscovery {
+	return &LatencyDiscovery{
+		registry:        registry,
+		source:          source,
+		fallbackServers: fallbackServers,
+	}
+}
+
+// Discover ...
+func (d *LatencyDiscovery) Discover(_ *minecraft.Conn) (string, error) {
+	addrs := d.sorted()
+	if len(addrs) == 0 {
+		return "", errors.New("no servers registered")
+	}
+	return addrs[0], nil
+}
+
+// DiscoverFallback ...
+func (d *LatencyDiscovery) DiscoverFallback(conn *minecraft.Conn) (string, error) {
+	if len(d.fallbackServers) > 0 {
+		return d.fallbackServers[0], nil
+	}
+	return d.Discover(conn)
+}
+
+// DiscoverFallbacks ...
+func (d *LatencyDiscovery) DiscoverFallbacks(_ *minecraft.Conn) ([]string, error) {
+	if len(d.fallbackServers) > 0 {
+		return d.fallbackServers, nil
+	}
+
+	addrs := d.sorted()
+	if len(addrs) == 0 {
+		return nil, errors.New("no servers registered")
+	}
+	return addrs, nil
+}
+
+// sorted returns the addresses of the servers of the registry from the lowest to the highest round-trip time,
+// followed by the servers without an estimate in the order they were registered in.
+func (d *LatencyDiscovery) sorted() []string {
+	type entry struct {
+		addr     string
+		rtt      time.Duration
+		measured bool
+	}
+
+	servers := d.registry.Servers()
+	entries := make([]entry, len(servers))
+	for i, srv := range servers {
+		rtt, ok := d.source.RTT(srv.Addr)
+		entries[i] = entry{addr: srv.Addr, rtt: rtt, measured: ok}
+	}
+
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		switch {
+		case a.measured != b.measured:
+			if a.measured {
+				return -1
+			}
+			return 1
+		case a.rtt < b.rtt:
+			return -1
+		case a.rtt > b.rtt:
+			return 1
+		}
+		return 0
+	})
+
+	addrs := make([]string, len(entries))
+	for i, e := range entries {
+		addrs[i] = e.addr
+	}
+	return addrs
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+)
+
+// LeastConnectionsDiscovery implements the FallbackChainDiscovery and ConnectionObserver interfaces by routing
+// sessions to the server of a Registry with the lowest load, which is the amount of sessions connected to it
+// through the proxy relative to its weight, so a server with a weight of 2 receives sessions until it holds twice
+// as many as a server with a weight of 1. Ties are broken by the order the servers were registered in. Servers that
+// reached their capacity are skipped. Sessions are only counted once they spawned on a server, so logins arriving
+// at the same time may be routed to the same server.
+type LeastConnectionsDiscovery struct {
+	registry        *Registry
+	fallbackServers []string
+
+	connections map[string]int
+	mu          sync.Mutex
+}
+
+// NewLeastConnectionsDiscovery creates a new LeastConnectionsDiscovery routing sessions to the servers of the
+// registry passed. The fallback servers are tried in order when the server of a session fails. Without fallback
+// servers, the servers of the registry are tried from the least to the most loaded instead.
+func NewLeastConnectionsDiscovery(registry *Registry, fallbackServers ...string) *LeastConnectionsDiscovery {
+	return &LeastConnectionsDiscovery{
+		registry:        registry,
+		fallbackServers: fallbackServers,
+		connections:     make(map[string]int),
+	}
+}
+
+// Connections returns the amount of sessions connected to the server with the address passed.
+func (d *LeastConnectionsDiscovery) Connections(addr string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.connections[addr]
+}
+
+// Discover ...
+func (d *LeastConnectionsDiscovery) Discover(_ *minecraft.Conn) (string, error) {
+	servers := d.sorted()
+	if len(servers) == 0 {
+		return "", errors.New("no servers available")
+	}
+	return servers[0], nil
+}
+
+// DiscoverFallback ...
+func (d *LeastConnectionsDiscovery) DiscoverFallback(conn *minecraft.Conn) (string, error) {
+	if len(d.fallbackServers) > 0 {
+		return d.fallbackServers[0], nil
+	}
+	return d.Discover(conn)
+}
+
+// DiscoverFallbacks ...
+func (d *LeastConnectionsDiscovery) DiscoverFallbacks(_ *minecraft.Conn) ([]string, error) {
+	if len(d.fallbackServers) > 0 {
+		return d.fallbackServers, nil
+	}
+
+	servers := d.sorted()
+	if len(servers) == 0 {
+		return nil, errors.New("no servers available")
+	}
+	return servers, nil
+}
+
+// ServerConnected ...
+func (d *LeastConnectionsDiscovery) ServerConnected(addr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.connections[addr]++
+}
+
+// ServerDisconnected ...
+func (d *LeastConnectionsDiscovery) ServerDisconnected(addr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.connections[addr] <= 1 {
+		delete(d.connections, addr)
+		return
+	}
+	d.connections[addr]--
+}
+
+// sorted returns the addresses of the registered servers below their capacity from the least to the most loaded.
+func (d *LeastConnectionsDiscovery) sorted() []string {
+	servers := d.registry.Servers()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	servers = slices.DeleteFunc(servers, func(srv Server) bool {
+		return srv.Capacity > 0 && d.connections[srv.Addr] >= srv.Capacity
+	})
+	slices.SortStableFunc(servers, func(a, b Server) int {
+		// Compare connections per weight without dividing: a/wa < b/wb is equivalent to a*wb < b*wa.
+		return cmp.Compare(d.connections[a.Addr]*b.weight(), d.connections[b.Addr]*a.weight())
+	})
+
+	addrs := make([]string, len(servers))
+	for i, srv := range servers {
+		addrs[i] = srv.Addr
+	}
+	return addrs
+}
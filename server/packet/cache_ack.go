@@ -0,0 +1,29 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// CacheAck is sent by the proxy in response to every UpdateCache packet if FeatureCacheHash is enabled,
+// acknowledging whether the update was applied. Servers may send the full cache again if an update was not applied, instead of assuming the proxy
+// holds the cache they sent.
+type CacheAck struct {
+	// Version is the version of the cache the proxy holds after handling the update.
+	Version uint64
+	// Applied specifies whether the update was applied. Updates are not applied if a delta was made against
+	// another version, a patch was out of range, the hash of the updated cache did not match or a processor
+	// cancelled the update.
+	Applied bool
+	// Slot is the name of the cache slot the update was for, which is empty for the default cache.
+	Slot string
+}
+
+// ID ...
+func (pk *CacheAck) ID() uint32 {
+	return IDCacheAck
+}
+
+// Marshal ...
+func (pk *CacheAck) Marshal(io protocol.IO) {
+	io.Varuint64(&pk.Version)
+	io.Bool(&pk.Applied)
+	io.String(&pk.Slot)
+}
@@ -0,0 +1,30 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// CacheSlot is a named cache held by the proxy for a session in addition to its default cache, which servers
+// update using an UpdateCache packet with the slot's name.
+type CacheSlot struct {
+	// Name is the name of the slot.
+	Name string
+	// Cache is the cache held in the slot, which is compressed using zstd if Compressed is true.
+	Cache []byte
+	// Compressed specifies whether Cache is compressed using zstd. It is only present if FeatureCacheCompression
+	// is enabled.
+	Compressed bool
+	// Version is the version of the cache set by the server that last updated the slot. It is only present if
+	// FeatureCacheVersion is enabled.
+	Version uint64
+}
+
+// marshal reads or writes the slot, leaving out the fields of the features that are not enabled.
+func (x *CacheSlot) marshal(io protocol.IO, features uint32) {
+	io.String(&x.Name)
+	io.ByteSlice(&x.Cache)
+	if features&FeatureCacheCompression != 0 {
+		io.Bool(&x.Compressed)
+	}
+	if features&FeatureCacheVersion != 0 {
+		io.Varuint64(&x.Version)
+	}
+}
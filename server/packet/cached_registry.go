@@ -0,0 +1,39 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// CachedRegistry is sent by the server in place of a CreativeContent, AvailableCommands or BiomeDefinitionList
+// packet whose hash equals the hash the proxy declared in the ConnectionFeatures packet. The proxy sends the client
+// its cached copy of the packet instead, so that the server does not have to send it again on every transfer.
+type CachedRegistry struct {
+	// PacketID is the ID of the packet the proxy should send from its cache.
+	PacketID uint32
+	// Hash is the hash of the packet, which must equal the hash the proxy declared for it.
+	Hash uint64
+}
+
+// ID ...
+func (pk *CachedRegistry) ID() uint32 {
+	return IDCachedRegistry
+}
+
+// Marshal ...
+func (pk *CachedRegistry) Marshal(io protocol.IO) {
+	io.Varuint32(&pk.PacketID)
+	io.Uint64(&pk.Hash)
+}
+
+// RegistryHash is the hash of a registry packet cached by the proxy, declared in the ConnectionFeatures packet.
+// The hash is the 64-bit FNV-1a hash of the encoded packet, including its header.
+type RegistryHash struct {
+	// PacketID is the ID of the cached packet.
+	PacketID uint32
+	// Hash is the hash of the cached packet.
+	Hash uint64
+}
+
+// Marshal ...
+func (x *RegistryHash) Marshal(io protocol.IO) {
+	io.Varuint32(&x.PacketID)
+	io.Uint64(&x.Hash)
+}
@@ -0,0 +1,63 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// ConnectionFeatures is sent by the proxy in response to a ConnectionResponse packet advertising features. It holds
+// the features the proxy enabled, which are the features both sides support, along with the fields of these
+// features. Servers advertising features must wait for it before sending the StartGame packet. It is never sent to
+// servers that do not advertise any features.
+type ConnectionFeatures struct {
+	// Features holds the features enabled for the connection.
+	Features uint32
+	// Token is the token the proxy authenticates itself with, provided by a server.TokenProvider. It is only
+	// present if FeatureToken is enabled.
+	Token []byte
+	// Compressions holds the names of the compressions the proxy supports in addition to snappy, in order of
+	// preference. A server supporting one of them compresses the packets it sends with it, after which the proxy
+	// uses it as well. It is only present if FeatureCompression is enabled.
+	Compressions []string
+	// TransferPayload is the payload the server the player transferred from attached to the transfer, which is
+	// empty if the player did not transfer or no payload was attached. It is only present if
+	// FeatureTransferPayload is enabled.
+	TransferPayload []byte
+	// Registries holds the hashes of the registry packets the proxy cached for the player. The server sends a
+	// CachedRegistry packet instead of a registry packet with the same hash. It is only present if
+	// FeatureCachedRegistries is enabled.
+	Registries []RegistryHash
+	// CacheVersion is the version of the cache sent in the ConnectionRequest packet, set by the server that last
+	// updated it using an UpdateCache packet. It is only present if FeatureCacheVersion is enabled.
+	CacheVersion uint64
+	// CacheSlots holds the named cache slots of the session, sorted by name. It is only present if
+	// FeatureCacheSlots is enabled.
+	CacheSlots []CacheSlot
+}
+
+// ID ...
+func (pk *ConnectionFeatures) ID() uint32 {
+	return IDConnectionFeatures
+}
+
+// Marshal ...
+func (pk *ConnectionFeatures) Marshal(io protocol.IO) {
+	io.Varuint32(&pk.Features)
+	if pk.Features&FeatureToken != 0 {
+		io.ByteSlice(&pk.Token)
+	}
+	if pk.Features&FeatureCompression != 0 {
+		protocol.FuncSlice(io, &pk.Compressions, io.String)
+	}
+	if pk.Features&FeatureTransferPayload != 0 {
+		io.ByteSlice(&pk.TransferPayload)
+	}
+	if pk.Features&FeatureCachedRegistries != 0 {
+		protocol.Slice(io, &pk.Registries)
+	}
+	if pk.Features&FeatureCacheVersion != 0 {
+		io.Varuint64(&pk.CacheVersion)
+	}
+	if pk.Features&FeatureCacheSlots != 0 {
+		protocol.FuncSlice(io, &pk.CacheSlots, func(slot *CacheSlot) {
+			slot.marshal(io, pk.Features)
+		})
+	}
+}
@@ -11,6 +11,9 @@ type ConnectionResponse struct {
 	RuntimeID uint64
 	// UniqueID is the deterministic unique ID of the player.
 	UniqueID int64
+	// Features holds the features of the protocol the server supports. It is zero for servers that do not know
+	// about features, which leave it out.
+	Features uint32
 }
 
 // ID ...
@@ -22,4 +25,7 @@ func (pk *ConnectionResponse) ID() uint32 {
 func (pk *ConnectionResponse) Marshal(io protocol.IO) {
 	io.Varuint64(&pk.RuntimeID)
 	io.Varint64(&pk.UniqueID)
+	optional(io, func() {
+		io.Varuint32(&pk.Features)
+	})
 }
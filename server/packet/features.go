@@ -0,0 +1,32 @@
+package packet
+
+// Features are optional extensions of the spectrum protocol, which are only used on a connection if both the proxy
+// and the server support them. Servers advertise the features they support in the ConnectionResponse packet, after
+// which the proxy enables the features it supports as well using a ConnectionFeatures packet. Servers and proxies
+// that do not know about features never use any of them.
+const (
+	// FeatureToken authenticates the proxy using the token sent in the ConnectionFeatures packet.
+	FeatureToken uint32 = 1 << iota
+	// FeatureCompression offers the compressions listed in the ConnectionFeatures packet to the server.
+	FeatureCompression
+	// FeatureTransferPayload forwards the payload a server attached to a Transfer packet to the server the player
+	// transferred to in the ConnectionFeatures packet.
+	FeatureTransferPayload
+	// FeatureClientCache sends the server the ClientCacheStatus of the client after the ConnectionFeatures packet,
+	// so that the server sends chunks using the client blob cache if the client supports it.
+	FeatureClientCache
+	// FeatureCachedRegistries declares the hashes of the registry packets cached by the proxy in the
+	// ConnectionFeatures packet, which the server may answer with CachedRegistry packets.
+	FeatureCachedRegistries
+	// FeatureCacheVersion reports the version of the session cache in the ConnectionFeatures packet and allows
+	// UpdateCache packets to hold a version and deltas against a previous version.
+	FeatureCacheVersion
+	// FeatureCacheCompression allows UpdateCache packets to hold caches compressed using zstd.
+	FeatureCacheCompression
+	// FeatureCacheHash allows UpdateCache packets to hold the hash of the updated cache, and makes the proxy
+	// acknowledge every UpdateCache packet using a CacheAck packet.
+	FeatureCacheHash
+	// FeatureCacheSlots sends the named cache slots of the session in the ConnectionFeatures packet and allows
+	// UpdateCache packets to update them.
+	FeatureCacheSlots
+)
@@ -0,0 +1,45 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+const (
+	// MaxHandshakeMetadataEntries is the maximum amount of entries a HandshakeMetadata packet may hold.
+	MaxHandshakeMetadataEntries = 32
+	// MaxHandshakeMetadataKeyLength is the maximum length of a HandshakeMetadata entry's key in bytes.
+	MaxHandshakeMetadataKeyLength = 64
+	// MaxHandshakeMetadataValueLength is the maximum length of a HandshakeMetadata entry's value in bytes.
+	MaxHandshakeMetadataValueLength = 256
+)
+
+// HandshakeMetadata is sent by the proxy directly after the ConnectionRequest packet when the proxy is
+// configured with handshake metadata, such as the proxy's version, region or a trace ID used for request
+// correlation. It is never sent otherwise, so servers that do not expect it are unaffected unless the
+// proxy is configured to send metadata.
+type HandshakeMetadata struct {
+	// Entries holds the key-value pairs of the metadata, sorted by key.
+	Entries []MetadataEntry
+}
+
+// ID ...
+func (pk *HandshakeMetadata) ID() uint32 {
+	return IDHandshakeMetadata
+}
+
+// Marshal ...
+func (pk *HandshakeMetadata) Marshal(io protocol.IO) {
+	protocol.Slice(io, &pk.Entries)
+}
+
+// MetadataEntry is a single key-value pair of a HandshakeMetadata packet.
+type MetadataEntry struct {
+	// Key is the key of the entry.
+	Key string
+	// Value is the value of the entry.
+	Value string
+}
+
+// Marshal ...
+func (x *MetadataEntry) Marshal(io protocol.IO) {
+	io.String(&x.Key)
+	io.String(&x.Value)
+}
@@ -7,4 +7,8 @@ const (
 	IDLatency
 	IDTransfer
 	IDUpdateCache
+	IDHandshakeMetadata
+	IDCachedRegistry
+	IDCacheAck
+	IDConnectionFeatures
 )
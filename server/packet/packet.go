@@ -5,10 +5,14 @@ import "github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 func init() {
 	packet.RegisterPacketFromClient(IDConnectionRequest, func() packet.Packet { return &ConnectionRequest{} })
 	packet.RegisterPacketFromClient(IDLatency, func() packet.Packet { return &Latency{} })
+	packet.RegisterPacketFromClient(IDHandshakeMetadata, func() packet.Packet { return &HandshakeMetadata{} })
+	packet.RegisterPacketFromClient(IDCacheAck, func() packet.Packet { return &CacheAck{} })
+	packet.RegisterPacketFromClient(IDConnectionFeatures, func() packet.Packet { return &ConnectionFeatures{} })
 
 	packet.RegisterPacketFromServer(IDConnectionResponse, func() packet.Packet { return &ConnectionResponse{} })
 	packet.RegisterPacketFromServer(IDFlush, func() packet.Packet { return &Flush{} })
 	packet.RegisterPacketFromServer(IDLatency, func() packet.Packet { return &Latency{} })
 	packet.RegisterPacketFromServer(IDTransfer, func() packet.Packet { return &Transfer{} })
 	packet.RegisterPacketFromServer(IDUpdateCache, func() packet.Packet { return &UpdateCache{} })
+	packet.RegisterPacketFromServer(IDCachedRegistry, func() packet.Packet { return &CachedRegistry{} })
 }
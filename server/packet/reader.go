@@ -0,0 +1,29 @@
+package packet
+
+import (
+	"bytes"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// reader is a protocol.Reader that knows the amount of bytes left in the packet it reads.
+type reader struct {
+	*protocol.Reader
+	buf *bytes.Buffer
+}
+
+// NewReader returns a reader for a spectrum packet held by the buffer passed. Unlike readers created using
+// protocol.NewReader, it skips the optional fields of a packet if the packet ends before them, which is the case
+// for packets written by peers using an older version of the protocol.
+func NewReader(buf *bytes.Buffer, shieldID int32) protocol.IO {
+	return &reader{Reader: protocol.NewReader(buf, shieldID, false), buf: buf}
+}
+
+// optional reads or writes the fields handled by fn, which were appended to a packet in a later version of the
+// protocol. Readers created using NewReader skip them if no bytes are left in the packet.
+func optional(io protocol.IO, fn func()) {
+	if r, ok := io.(*reader); ok && r.buf.Len() == 0 {
+		return
+	}
+	fn()
+}
@@ -6,6 +6,10 @@ import "github.com/sandertv/gophertunnel/minecraft/protocol"
 type Transfer struct {
 	// Addr is the address of the new server.
 	Addr string
+	// Payload is an arbitrary payload forwarded to the new server in the ConnectionFeatures packet if it supports
+	// FeatureTransferPayload, such as the ID of a party or the seed of a minigame the player joins. It may be
+	// empty, and is left out by servers using an older version of the protocol.
+	Payload []byte
 }
 
 // ID ...
@@ -16,4 +20,7 @@ func (pk *Transfer) ID() uint32 {
 // Marshal ...
 func (pk *Transfer) Marshal(io protocol.IO) {
 	io.String(&pk.Addr)
+	optional(io, func() {
+		io.ByteSlice(&pk.Payload)
+	})
 }
@@ -10,7 +10,34 @@ type UpdateCache struct {
 	// data fetching (e.g., pre-cached player data or session information).
 	// If present, it should be handled by the receiving server to optimize its
 	// internal operations or to forward the data as needed.
+	// It is empty if Delta is true.
 	Cache []byte
+	// Features holds the features the other fields of the update belong to, which must be enabled for the
+	// connection. It is zero for servers that do not know about features, which only send Cache.
+	Features uint32
+	// Compressed specifies whether Cache is compressed using zstd. Proxies keep compressed caches compressed in
+	// memory and decompress them when they are used. It is only present if FeatureCacheCompression is set.
+	Compressed bool
+	// Hash is the 64-bit FNV-1a hash of the decompressed cache after the update, which the proxy verifies before
+	// applying the update unless it is zero. Compressed caches are not verified. It is only present if
+	// FeatureCacheHash is set.
+	Hash uint64
+	// Version is the version of the cache after the update, which the proxy reports to the servers it connects
+	// to in the ConnectionFeatures packet. It is only present if FeatureCacheVersion is set.
+	Version uint64
+	// Delta specifies whether the update holds Patches against the cache at BaseVersion instead of the full cache.
+	// The proxy drops delta updates against a version other than the one it holds. It is only present if
+	// FeatureCacheVersion is set.
+	Delta bool
+	// BaseVersion is the version of the cache the patches apply to if Delta is true.
+	BaseVersion uint64
+	// Patches holds the changes made to the cache at BaseVersion if Delta is true, sorted by offset. Patches must
+	// not overlap.
+	Patches []CachePatch
+	// Slot is the name of the cache slot updated, which is empty for the default cache that is sent in the Cache
+	// field of the ConnectionRequest packet. Named slots are sent in the CacheSlots field of the ConnectionFeatures
+	// packet and are removed by updating them with an empty cache. It is only present if FeatureCacheSlots is set.
+	Slot string
 }
 
 // ID ...
@@ -21,4 +48,39 @@ func (pk *UpdateCache) ID() uint32 {
 // Marshal ...
 func (pk *UpdateCache) Marshal(io protocol.IO) {
 	io.ByteSlice(&pk.Cache)
+	optional(io, func() {
+		io.Varuint32(&pk.Features)
+		if pk.Features&FeatureCacheVersion != 0 {
+			io.Varuint64(&pk.Version)
+			io.Bool(&pk.Delta)
+			io.Varuint64(&pk.BaseVersion)
+			protocol.Slice(io, &pk.Patches)
+		}
+		if pk.Features&FeatureCacheCompression != 0 {
+			io.Bool(&pk.Compressed)
+		}
+		if pk.Features&FeatureCacheHash != 0 {
+			io.Uint64(&pk.Hash)
+		}
+		if pk.Features&FeatureCacheSlots != 0 {
+			io.String(&pk.Slot)
+		}
+	})
+}
+
+// CachePatch replaces a range of bytes of a cache with new data.
+type CachePatch struct {
+	// Offset is the offset of the first byte replaced in the base cache.
+	Offset uint32
+	// Length is the amount of bytes replaced, which may be zero to insert data.
+	Length uint32
+	// Data is the data the range is replaced with, which may be empty to remove the range.
+	Data []byte
+}
+
+// Marshal ...
+func (x *CachePatch) Marshal(io protocol.IO) {
+	io.Varuint32(&x.Offset)
+	io.Varuint32(&x.Length)
+	io.ByteSlice(&x.Data)
 }
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"math/rand/v2"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+)
+
+// RandomDiscovery implements the FallbackChainDiscovery interface by routing every session to a random server
+// of a Registry, with the chance of a server being picked proportional to its weight.
+type RandomDiscovery struct {
+	registry        *Registry
+	fallbackServers []string
+}
+
+// NewRandomDiscovery creates a new RandomDiscovery routing sessions to the servers of the registry passed. The
+// fallback servers are tried in order when the server of a session fails. Without fallback servers, the servers
+// of the registry are tried in a random order weighted the same way instead.
+func NewRandomDiscovery(registry *Registry, fallbackServers ...string) *RandomDiscovery {
+	return &RandomDiscovery{
+		registry:        registry,
+		fallbackServers: fallbackServers,
+	}
+}
+
+// Discover ...
+func (d *RandomDiscovery) Discover(_ *minecraft.Conn) (string, error) {
+	servers := d.registry.Servers()
+	if len(servers) == 0 {
+		return "", errors.New("no servers registered")
+	}
+	return servers[pickWeighted(servers)].Addr, nil
+}
+
+// DiscoverFallback ...
+func (d *RandomDiscovery) DiscoverFallback(conn *minecraft.Conn) (string, error) {
+	if len(d.fallbackServers) > 0 {
+		return d.fallbackServers[0], nil
+	}
+	return d.Discover(conn)
+}
+
+// DiscoverFallbacks ...
+func (d *RandomDiscovery) DiscoverFallbacks(_ *minecraft.Conn) ([]string, error) {
+	if len(d.fallbackServers) > 0 {
+		return d.fallbackServers, nil
+	}
+
+	servers := d.registry.Servers()
+	if len(servers) == 0 {
+		return nil, errors.New("no servers registered")
+	}
+
+	addrs := make([]string, 0, len(servers))
+	for len(servers) > 0 {
+		i := pickWeighted(servers)
+		addrs = append(addrs, servers[i].Addr)
+		servers = append(servers[:i], servers[i+1:]...)
+	}
+	return addrs, nil
+}
+
+// pickWeighted returns the index of a random server in servers, with the chance of a server being picked
+// proportional to its weight.
+func pickWeighted(servers []Server) int {
+	var total int
+	for _, srv := range servers {
+		total += srv.weight()
+	}
+
+	n := rand.IntN(total)
+	for i, srv := range servers {
+		if n -= srv.weight(); n < 0 {
+			return i
+		}
+	}
+	return len(servers) - 1
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisConfig configures a RedisWatcher.
+type RedisConfig struct {
+	// Addr is the address of the Redis server.
+	Addr string
+	// Username and Password are the credentials used to authenticate with the Redis server. No authentication
+	// takes place if Password is empty.
+	Username, Password string
+	// DB is the index of the database holding Key.
+	DB int
+	// Key is the key of the hash holding the servers. Every field of the hash is the address of a server, with a
+	// value of the form {"weight": 1, "capacity": 100, "heartbeat": 1700000000}, where heartbeat is the Unix time
+	// in seconds the server last refreshed its entry at.
+	Key string
+	// Channel is the channel servers publish to after changing their entry, which makes the watcher reload the
+	// servers immediately. When empty, servers are only reloaded every Interval.
+	Channel string
+	// Interval is the interval at which the servers are reloaded. It defaults to five seconds.
+	Interval time.Duration
+	// TTL is the duration after its last heartbeat after which a server is considered gone, such as after it
+	// crashed without removing its entry. Zero disables expiry.
+	TTL time.Duration
+}
+
+// options returns the options of the client connecting to the Redis server.
+func (c RedisConfig) options() *redis.Options {
+	return &redis.Options{Addr: c.Addr, Username: c.Username, Password: c.Password, DB: c.DB}
+}
+
+// redisServer is the value of a field of the hash watched by a RedisWatcher.
+type redisServer struct {
+	Weight    int   `json:"weight"`
+	Capacity  int   `json:"capacity"`
+	Heartbeat int64 `json:"heartbeat"`
+}
+
+// RedisWatcher keeps a Registry in sync with a Redis hash of servers, so that servers can register themselves
+// on boot and disappear once they shut down or stop refreshing their entry, without changing the configuration
+// of the proxy. Any discovery strategy using the registry, such as RoundRobinDiscovery, then routes sessions to
+// the servers found in Redis.
+type RedisWatcher struct {
+	config   RedisConfig
+	client   *redis.Client
+	registry *Registry
+	logger   *slog.Logger
+
+	reload chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// NewRedisWatcher creates a new RedisWatcher keeping the registry passed in sync with Redis. Watching starts
+// once Start is called.
+func NewRedisWatcher(config RedisConfig, registry *Registry, logger *slog.Logger) *RedisWatcher {
+	if config.Interval <= 0 {
+		config.Interval = time.Second * 5
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RedisWatcher{
+		config:   config,
+		client:   redis.NewClient(config.options()),
+		registry: registry,
+		logger:   logger,
+
+		reload: make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start starts watching Redis in the background until Close is called.
+func (w *RedisWatcher) Start() {
+	go w.poll()
+	if w.config.Channel != "" {
+		go w.subscribe()
+	}
+}
+
+// Close stops watching Redis and closes the connections to it. The registry keeps the servers it holds.
+func (w *RedisWatcher) Close() (err error) {
+	w.once.Do(func() {
+		w.cancel()
+		err = w.client.Close()
+	})
+	return err
+}
+
+// Load loads the servers from Redis once and syncs the registry with them.
+func (w *RedisWatcher) Load(ctx context.Context) error {
+	fields, err := w.client.HGetAll(ctx, w.config.Key).Result()
+	if err != nil {
+		return err
+	}
+
+	servers := make([]Server, 0, len(fields))
+	for _, addr := range slices.Sorted(maps.Keys(fields)) {
+		var entry redisServer
+		if err := json.Unmarshal([]byte(fields[addr]), &entry); err != nil {
+			w.logger.Debug("invalid server entry", "addr", addr, "err", err)
+			continue
+		}
+
+		if w.config.TTL > 0 && time.Since(time.Unix(entry.Heartbeat, 0)) > w.config.TTL {
+			continue
+		}
+		servers = append(servers, Server{Addr: addr, Weight: entry.Weight, Capacity: entry.Capacity})
+	}
+	w.registry.Sync(servers)
+	return nil
+}
+
+// poll reloads the servers every interval, or when a change was published, until the watcher is closed.
+func (w *RedisWatcher) poll() {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(w.ctx, w.config.Interval)
+		if err := w.Load(ctx); err != nil && w.ctx.Err() == nil {
+			w.logger.Error("failed to load servers from redis", "err", err)
+		}
+		cancel()
+
+		select {
+		case <-ticker.C:
+		case <-w.reload:
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe subscribes to the channel servers publish changes to and requests a reload for every message until
+// the watcher is closed. The client resubscribes after connection failures by itself.
+func (w *RedisWatcher) subscribe() {
+	pubSub := w.client.Subscribe(w.ctx, w.config.Channel)
+	defer pubSub.Close()
+
+	messages := pubSub.Channel()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case _, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			select {
+			case w.reload <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
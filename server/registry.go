@@ -0,0 +1,255 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/cooldogedev/spectrum/transport"
+)
+
+// registryEventBuffer is the amount of events buffered for a subscriber of a Registry.
+const registryEventBuffer = 64
+
+// Server is a server registered in a Registry.
+type Server struct {
+	// Addr is the address the server is dialed with.
+	Addr string
+	// Weight is the share of sessions the server receives relative to the other servers, allowing servers with
+	// more capacity to receive more sessions. A server with a weight of 4 receives four times as many sessions as
+	// a server with a weight of 1. Weights of zero or less are treated as 1.
+	Weight int
+	// Capacity is the maximum amount of sessions the server holds, after which LeastConnectionsDiscovery no longer
+	// routes sessions to it. Zero means the capacity is unlimited.
+	Capacity int
+	// Transport is the transport the server is dialed with, allowing transports to be mixed, such as QUIC for
+	// servers across lossy WAN links. When nil, the transport of the proxy is used.
+	Transport transport.Transport
+}
+
+// keepTransport sets the transport of the server to that of the previous entry of the server if it has none, so
+// that updates from sources unaware of transports, such as Redis, keep the transport configured for the server.
+func (s *Server) keepTransport(previous Server) {
+	if s.Transport == nil {
+		s.Transport = previous.Transport
+	}
+}
+
+// weight returns the weight of the server, treating weights of zero or less as 1.
+func (s Server) weight() int {
+	return max(s.Weight, 1)
+}
+
+// RegistryEventType is the type of a change made to a Registry.
+type RegistryEventType int
+
+const (
+	// ServerAdded is the type of the event emitted when a server was added to a Registry.
+	ServerAdded RegistryEventType = iota
+	// ServerRemoved is the type of the event emitted when a server was removed from a Registry.
+	ServerRemoved
+	// ServerUpdated is the type of the event emitted when a server of a Registry was updated.
+	ServerUpdated
+)
+
+// RegistryEvent describes a change made to a Registry.
+type RegistryEvent struct {
+	// Type is the type of the change.
+	Type RegistryEventType
+	// Server is the server that was added, removed or updated. For removed servers, it holds the server as it was
+	// before it was removed.
+	Server Server
+}
+
+// Registry holds the servers discovery strategies, such as RoundRobinDiscovery, choose from. Servers may be
+// added, removed and updated at any time, and changes are emitted to subscribers. Servers may also be marked
+// unhealthy, for example by a HealthChecker, which excludes them from discovery until they are marked healthy again.
+type Registry struct {
+	servers     []Server
+	unhealthy   map[string]struct{}
+	subscribers map[chan RegistryEvent]struct{}
+	mu          sync.RWMutex
+}
+
+// NewRegistry creates a new Registry holding the servers passed.
+func NewRegistry(servers ...Server) *Registry {
+	return &Registry{
+		servers:     servers,
+		unhealthy:   make(map[string]struct{}),
+		subscribers: make(map[chan RegistryEvent]struct{}),
+	}
+}
+
+// Add adds the server passed to the registry. It returns an error if a server with the same address is
+// already registered.
+func (r *Registry) Add(srv Server) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.index(srv.Addr) != -1 {
+		return fmt.Errorf("server %s is already registered", srv.Addr)
+	}
+	r.servers = append(r.servers, srv)
+	r.emit(RegistryEvent{Type: ServerAdded, Server: srv})
+	return nil
+}
+
+// Remove removes the server with the address passed from the registry. It returns false if no such server
+// is registered.
+func (r *Registry) Remove(addr string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.index(addr)
+	if i == -1 {
+		return false
+	}
+
+	srv := r.servers[i]
+	r.servers = slices.Delete(r.servers, i, i+1)
+	delete(r.unhealthy, addr)
+	r.emit(RegistryEvent{Type: ServerRemoved, Server: srv})
+	return true
+}
+
+// Update replaces the registered server with the same address as the server passed, such as to change its
+// weight. It returns an error if no such server is registered.
+func (r *Registry) Update(srv Server) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.index(srv.Addr)
+	if i == -1 {
+		return fmt.Errorf("server %s is not registered", srv.Addr)
+	}
+	srv.keepTransport(r.servers[i])
+	r.servers[i] = srv
+	r.emit(RegistryEvent{Type: ServerUpdated, Server: srv})
+	return nil
+}
+
+// Sync replaces the servers of the registry with the servers passed, adding, updating and removing servers so
+// that the registry holds exactly the servers passed, emitting an event for every change. It is used to keep the
+// registry in sync with an external source of servers, such as Redis.
+func (r *Registry) Sync(servers []Server) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, srv := range slices.Clone(r.servers) {
+		if !slices.ContainsFunc(servers, func(other Server) bool { return other.Addr == srv.Addr }) {
+			i := r.index(srv.Addr)
+			r.servers = slices.Delete(r.servers, i, i+1)
+			delete(r.unhealthy, srv.Addr)
+			r.emit(RegistryEvent{Type: ServerRemoved, Server: srv})
+		}
+	}
+
+	for _, srv := range servers {
+		i := r.index(srv.Addr)
+		if i != -1 {
+			srv.keepTransport(r.servers[i])
+		}
+
+		switch {
+		case i == -1:
+			r.servers = append(r.servers, srv)
+			r.emit(RegistryEvent{Type: ServerAdded, Server: srv})
+		case r.servers[i] != srv:
+			r.servers[i] = srv
+			r.emit(RegistryEvent{Type: ServerUpdated, Server: srv})
+		}
+	}
+}
+
+// Registered returns whether a server with the address passed is registered.
+func (r *Registry) Registered(addr string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.index(addr) != -1
+}
+
+// Subscribe returns a channel the changes made to the registry are emitted to, and a function that stops
+// emitting changes to the channel and closes it. Events are dropped for subscribers that fall behind by more
+// than 64 events, so the channel should be drained promptly.
+func (r *Registry) Subscribe() (<-chan RegistryEvent, func()) {
+	ch := make(chan RegistryEvent, registryEventBuffer)
+	r.mu.Lock()
+	r.subscribers[ch] = struct{}{}
+	r.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			r.mu.Lock()
+			delete(r.subscribers, ch)
+			r.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Servers returns the healthy servers of the registry in the order they were registered in.
+func (r *Registry) Servers() []Server {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	servers := make([]Server, 0, len(r.servers))
+	for _, srv := range r.servers {
+		if _, ok := r.unhealthy[srv.Addr]; !ok {
+			servers = append(servers, srv)
+		}
+	}
+	return servers
+}
+
+// AllServers returns all servers of the registry, including unhealthy ones, in the order they were registered in.
+func (r *Registry) AllServers() []Server {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.servers)
+}
+
+// Transport returns the transport of the server with the address passed, or nil if the server is not registered
+// or has no transport.
+func (r *Registry) Transport(addr string) transport.Transport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if i := r.index(addr); i != -1 {
+		return r.servers[i].Transport
+	}
+	return nil
+}
+
+// Healthy returns whether the server with the address passed is healthy. Servers that are not registered are
+// considered healthy.
+func (r *Registry) Healthy(addr string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.unhealthy[addr]
+	return !ok
+}
+
+// SetHealthy marks the server with the address passed healthy or unhealthy.
+func (r *Registry) SetHealthy(addr string, healthy bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if healthy {
+		delete(r.unhealthy, addr)
+		return
+	}
+	r.unhealthy[addr] = struct{}{}
+}
+
+// index returns the index of the server with the address passed, or -1 if no such server is registered. The
+// registry must be locked.
+func (r *Registry) index(addr string) int {
+	return slices.IndexFunc(r.servers, func(srv Server) bool {
+		return srv.Addr == addr
+	})
+}
+
+// emit emits the event passed to all subscribers, dropping it for subscribers whose buffer is full. The registry
+// must be locked.
+func (r *Registry) emit(event RegistryEvent) {
+	for ch := range r.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+)
+
+// RoundRobinDiscovery implements the FallbackChainDiscovery interface by distributing sessions across the
+// servers of a Registry in turn, such as a set of lobbies. Servers receive sessions proportionally to their
+// weights, spread out evenly rather than in bursts.
+type RoundRobinDiscovery struct {
+	registry        *Registry
+	fallbackServers []string
+
+	current map[string]int
+	mu      sync.Mutex
+}
+
+// NewRoundRobinDiscovery creates a new RoundRobinDiscovery distributing sessions across the servers of the
+// registry passed. The fallback servers are tried in order when the server of a session fails. Without fallback
+// servers, the servers of the registry are tried in turn instead, starting with the server that would be
+// discovered next.
+func NewRoundRobinDiscovery(registry *Registry, fallbackServers ...string) *RoundRobinDiscovery {
+	return &RoundRobinDiscovery{
+		registry:        registry,
+		fallbackServers: fallbackServers,
+		current:         make(map[string]int),
+	}
+}
+
+// Discover ...
+func (d *RoundRobinDiscovery) Discover(_ *minecraft.Conn) (string, error) {
+	servers := d.registry.Servers()
+	if len(servers) == 0 {
+		return "", errors.New("no servers registered")
+	}
+	return servers[d.next(servers)].Addr, nil
+}
+
+// DiscoverFallback ...
+func (d *RoundRobinDiscovery) DiscoverFallback(conn *minecraft.Conn) (string, error) {
+	if len(d.fallbackServers) > 0 {
+		return d.fallbackServers[0], nil
+	}
+	return d.Discover(conn)
+}
+
+// DiscoverFallbacks ...
+func (d *RoundRobinDiscovery) DiscoverFallbacks(_ *minecraft.Conn) ([]string, error) {
+	if len(d.fallbackServers) > 0 {
+		return d.fallbackServers, nil
+	}
+
+	servers := d.registry.Servers()
+	if len(servers) == 0 {
+		return nil, errors.New("no servers registered")
+	}
+
+	start := d.next(servers)
+	addrs := make([]string, 0, len(servers))
+	for i := range servers {
+		addrs = append(addrs, servers[(start+i)%len(servers)].Addr)
+	}
+	return addrs, nil
+}
+
+// next returns the index of the server in servers that receives the next session, using smooth weighted
+// round-robin: every server accumulates its weight on each pick, and the server with the highest accumulated
+// weight is picked and has the total weight subtracted.
+func (d *RoundRobinDiscovery) next(servers []Server) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.current) > len(servers) {
+		clear(d.current)
+	}
+
+	best, total := 0, 0
+	for i, srv := range servers {
+		total += srv.weight()
+		d.current[srv.Addr] += srv.weight()
+		if d.current[srv.Addr] > d.current[servers[best].Addr] {
+			best = i
+		}
+	}
+	d.current[servers[best].Addr] -= total
+	return best
+}
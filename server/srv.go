@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SRVCatalog implements the Catalog interface by resolving the SRV records of a name, so that servers can be
+// rotated by updating DNS. Only the records with the lowest priority are used, as is the case for SRV records
+// in general, and the weight of a record becomes the weight of its server. Combined with a CatalogWatcher, the
+// name is resolved again every interval.
+type SRVCatalog struct {
+	service string
+	proto   string
+	name    string
+
+	resolver *net.Resolver
+}
+
+// NewSRVCatalog creates a new SRVCatalog resolving the SRV records of _service._proto.name, such as
+// _minecraft._tcp.example.com. If service and proto are empty, name is resolved directly. resolver may be nil
+// to use the default resolver.
+func NewSRVCatalog(service string, proto string, name string, resolver *net.Resolver) *SRVCatalog {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &SRVCatalog{
+		service:  service,
+		proto:    proto,
+		name:     name,
+		resolver: resolver,
+	}
+}
+
+// Servers ...
+func (c *SRVCatalog) Servers(ctx context.Context) ([]Server, error) {
+	_, records, err := c.resolver.LookupSRV(ctx, c.service, c.proto, c.name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The records are sorted by priority, so the records with the lowest priority come first.
+	servers := make([]Server, 0, len(records))
+	for _, record := range records {
+		if record.Priority != records[0].Priority {
+			break
+		}
+
+		// A target of "." indicates that the service is not available at the name.
+		if record.Target == "." {
+			continue
+		}
+
+		servers = append(servers, Server{
+			Addr:   net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))),
+			Weight: int(record.Weight),
+		})
+	}
+	return servers, nil
+}
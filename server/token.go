@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+)
+
+// TokenProvider provides the tokens the proxy presents to servers supporting packet.FeatureToken in the
+// ConnectionFeatures packet, allowing servers to verify that a connection originates from the proxy rather than from any process that can reach
+// them. Token is called every time a server is dialed, so implementations may rotate their keys at any time.
+type TokenProvider interface {
+	// Token returns the token presented to the server at the address passed for the player with the identity
+	// data passed.
+	Token(addr string, identityData login.IdentityData) ([]byte, error)
+}
+
+// HMACTokenProvider implements the TokenProvider interface using tokens signed with HMAC-SHA256. A token binds
+// the server address and the XUID of the player to an expiry time, and holds the ID of the key it was signed
+// with, so that servers may accept both the old and the new key while keys are rotated. Tokens are verified
+// by servers using VerifyHMACToken.
+type HMACTokenProvider struct {
+	keyID string
+	key   []byte
+	ttl   time.Duration
+	mu    sync.RWMutex
+}
+
+// NewHMACTokenProvider creates a new HMACTokenProvider signing tokens valid for ttl using the key passed.
+func NewHMACTokenProvider(keyID string, key []byte, ttl time.Duration) *HMACTokenProvider {
+	return &HMACTokenProvider{keyID: keyID, key: key, ttl: ttl}
+}
+
+// Rotate replaces the key tokens are signed with. Tokens signed afterwards hold the new key ID.
+func (p *HMACTokenProvider) Rotate(keyID string, key []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keyID = keyID
+	p.key = key
+}
+
+// Token ...
+func (p *HMACTokenProvider) Token(addr string, identityData login.IdentityData) ([]byte, error) {
+	p.mu.RLock()
+	keyID, key := p.keyID, p.key
+	p.mu.RUnlock()
+	if len(keyID) > 255 {
+		return nil, fmt.Errorf("key ID exceeds 255 bytes")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(byte(len(keyID)))
+	buf.WriteString(keyID)
+	_ = binary.Write(buf, binary.BigEndian, time.Now().Add(p.ttl).Unix())
+	return append(buf.Bytes(), signToken(key, buf.Bytes(), addr, identityData.XUID)...), nil
+}
+
+// VerifyHMACToken verifies a token created by an HMACTokenProvider for the server address and XUID passed,
+// looking up the key the token was signed with by its ID in keys. It returns an error if the key is unknown,
+// the signature is invalid or the token expired.
+func VerifyHMACToken(token []byte, keys map[string][]byte, addr string, xuid string) error {
+	if len(token) < 1 {
+		return errors.New("token is empty")
+	}
+
+	keyIDLen := int(token[0])
+	if len(token) != 1+keyIDLen+8+sha256.Size {
+		return errors.New("token has an invalid length")
+	}
+
+	key, ok := keys[string(token[1:1+keyIDLen])]
+	if !ok {
+		return errors.New("token is signed with an unknown key")
+	}
+
+	payload, signature := token[:1+keyIDLen+8], token[1+keyIDLen+8:]
+	if !hmac.Equal(signature, signToken(key, payload, addr, xuid)) {
+		return errors.New("token has an invalid signature")
+	}
+
+	if expiry := int64(binary.BigEndian.Uint64(payload[1+keyIDLen:])); time.Now().Unix() > expiry {
+		return errors.New("token expired")
+	}
+	return nil
+}
+
+// signToken signs the payload of a token, bound to the server address and XUID passed, using the key passed.
+func signToken(key []byte, payload []byte, addr string, xuid string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	mac.Write([]byte(addr))
+	mac.Write([]byte{0})
+	mac.Write([]byte(xuid))
+	return mac.Sum(nil)
+}
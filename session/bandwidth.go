@@ -0,0 +1,120 @@
+package session
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bandwidth holds the amount of bytes transferred by a session.
+type Bandwidth struct {
+	// ClientBytes is the amount of bytes read from the client, measured as the size of the decompressed packets,
+	// since minecraft.Conn does not expose the size of the batches on the wire.
+	ClientBytes uint64
+	// ServerBytesIn is the amount of bytes read from servers on the wire.
+	ServerBytesIn uint64
+	// ServerBytesOut is the amount of bytes written to servers on the wire.
+	ServerBytesOut uint64
+}
+
+// bandwidth holds the counters returned by Session.Bandwidth.
+type bandwidth struct {
+	clientBytes    atomic.Uint64
+	serverBytesIn  atomic.Uint64
+	serverBytesOut atomic.Uint64
+}
+
+// Bandwidth returns the amount of bytes transferred by the session since it was created.
+func (s *Session) Bandwidth() Bandwidth {
+	return Bandwidth{
+		ClientBytes:    s.bandwidth.clientBytes.Load(),
+		ServerBytesIn:  s.bandwidth.serverBytesIn.Load(),
+		ServerBytesOut: s.bandwidth.serverBytesOut.Load(),
+	}
+}
+
+// meteredConn wraps the connection to a server, counting the bytes read from and written to it and throttling
+// reads to opts.ServerBandwidthLimit.
+type meteredConn struct {
+	io.ReadWriteCloser
+	s *Session
+}
+
+// Read ...
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 {
+		c.s.bandwidth.serverBytesIn.Add(uint64(n))
+		if c.s.serverThrottle != nil {
+			if err := c.s.serverThrottle.wait(c.s.ctx, n); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, err
+}
+
+// Write ...
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	c.s.bandwidth.serverBytesOut.Add(uint64(n))
+	return n, err
+}
+
+// tokenBucket limits the rate at which bytes are read to a fixed amount of bytes per second, allowing bursts
+// of up to one second worth of bytes.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// newTokenBucket creates a new, full tokenBucket allowing rate bytes per second.
+func newTokenBucket(rate int64) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// wait takes n bytes from the bucket, blocking until the bucket refilled enough to cover them. Reads larger than
+// the bucket put it into debt rather than blocking forever, delaying the reads that follow instead.
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// take takes n tokens from the bucket without blocking, returning false and taking none if the bucket does not
+// hold enough tokens.
+func (b *tokenBucket) take(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
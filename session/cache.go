@@ -0,0 +1,181 @@
+package session
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
+
+	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxCacheSize is the maximum size of a decompressed session cache.
+const maxCacheSize = 16 * 1024 * 1024
+
+var (
+	// cacheEncoder and cacheDecoder compress and decompress session caches. Both are safe for concurrent use.
+	cacheEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	cacheDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxCacheSize))
+)
+
+// cacheState is the cache of a session along with the version set by the server that last updated it.
+type cacheState struct {
+	// data is the cache, which is compressed using zstd if compressed is true.
+	data       []byte
+	compressed bool
+	version    uint64
+}
+
+// decompressed returns the decompressed cache.
+func (c *cacheState) decompressed() ([]byte, error) {
+	if !c.compressed {
+		return c.data, nil
+	}
+	return cacheDecoder.DecodeAll(c.data, nil)
+}
+
+// cacheSlot returns the state of the cache slot with the name passed, where an empty name is the default cache.
+// An empty state is returned if the slot does not exist.
+func (s *Session) cacheSlot(name string) *cacheState {
+	if name == "" {
+		return s.cache.Load()
+	}
+	if slot, ok := (*s.cacheSlots.Load())[name]; ok {
+		return slot
+	}
+	return &cacheState{}
+}
+
+// cacheSlotList returns the named cache slots of the session, sorted by name.
+func (s *Session) cacheSlotList() []spectrumpacket.CacheSlot {
+	slots := *s.cacheSlots.Load()
+	list := make([]spectrumpacket.CacheSlot, 0, len(slots))
+	for name, slot := range slots {
+		list = append(list, spectrumpacket.CacheSlot{Name: name, Cache: slot.data, Compressed: slot.compressed, Version: slot.version})
+	}
+	slices.SortFunc(list, func(a, b spectrumpacket.CacheSlot) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+// updateCache applies an UpdateCache packet sent by the server to the session cache and acknowledges it to the
+// server using a CacheAck packet if the server supports spectrumpacket.FeatureCacheHash.
+func (s *Session) updateCache(pk *spectrumpacket.UpdateCache) {
+	s.cacheMu.Lock()
+	applied := s.applyCacheUpdate(pk)
+	version := s.cacheSlot(pk.Slot).version
+	s.cacheMu.Unlock()
+	if s.Server().Features()&spectrumpacket.FeatureCacheHash == 0 {
+		return
+	}
+
+	if err := s.Server().WritePacket(&spectrumpacket.CacheAck{Version: version, Applied: applied, Slot: pk.Slot}); err != nil {
+		s.logger.Debug("failed to acknowledge cache update", "err", err)
+	}
+}
+
+// applyCacheUpdate applies an UpdateCache packet to the session cache, returning whether it was applied. Delta
+// updates are applied to the cache they were made against, and dropped if the session holds another version.
+// Updates are dropped if the hash of the updated cache does not match. s.cacheMu must be held.
+func (s *Session) applyCacheUpdate(pk *spectrumpacket.UpdateCache) bool {
+	if !pk.Delta {
+		if pk.Hash != 0 && !pk.Compressed && cacheHash(pk.Cache) != pk.Hash {
+			s.logger.Warn("dropped cache with mismatching hash", "version", pk.Version)
+			return false
+		}
+		return s.storeCache(pk.Slot, pk.Cache, pk.Compressed, pk.Version)
+	}
+
+	current := s.cacheSlot(pk.Slot)
+	if current.version != pk.BaseVersion {
+		s.logger.Warn("dropped cache delta against another version", "version", current.version, "base", pk.BaseVersion)
+		return false
+	}
+
+	base, err := current.decompressed()
+	if err != nil {
+		s.logger.Error("failed to decompress cache", "err", err)
+		return false
+	}
+
+	patched, err := applyCachePatches(base, pk.Patches)
+	if err != nil {
+		s.logger.Warn("dropped invalid cache delta", "err", err)
+		return false
+	}
+	if pk.Hash != 0 && cacheHash(patched) != pk.Hash {
+		s.logger.Warn("dropped cache delta with mismatching hash", "version", pk.Version, "base", pk.BaseVersion)
+		return false
+	}
+	return s.storeCache(pk.Slot, patched, false, pk.Version)
+}
+
+// cacheHash returns the 64-bit FNV-1a hash of the cache passed.
+func cacheHash(cache []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(cache)
+	return h.Sum64()
+}
+
+// storeCache stores the cache in the slot with the name passed along with its version, returning whether it was
+// stored. Named slots updated with an empty cache are removed. The default cache is passed to the ProcessCache hook
+// first and not stored if the hook cancelled the update, for which compressed caches are decompressed if the
+// session has a processor. Uncompressed caches are compressed if opts.CompressCache is enabled. s.cacheMu must be
+// held.
+func (s *Session) storeCache(name string, cache []byte, compressed bool, version uint64) bool {
+	if _, ok := s.hooks().(NopProcessor); !ok && name == "" {
+		if compressed {
+			decompressed, err := cacheDecoder.DecodeAll(cache, nil)
+			if err != nil {
+				s.logger.Warn("dropped cache that failed to decompress", "err", err)
+				return false
+			}
+			cache, compressed = decompressed, false
+		}
+
+		ctx := NewContext()
+		s.hooks().ProcessCache(ctx, &cache)
+		if ctx.Cancelled() {
+			return false
+		}
+	}
+
+	if s.opts.CompressCache && !compressed && len(cache) > 0 {
+		cache, compressed = cacheEncoder.EncodeAll(cache, nil), true
+	}
+
+	state := &cacheState{data: cache, compressed: compressed, version: version}
+	if name == "" {
+		s.cache.Store(state)
+		return true
+	}
+
+	slots := maps.Clone(*s.cacheSlots.Load())
+	if len(cache) == 0 {
+		delete(slots, name)
+	} else {
+		slots[name] = state
+	}
+	s.cacheSlots.Store(&slots)
+	return true
+}
+
+// applyCachePatches applies the patches passed, which must be sorted by offset and must not overlap, to the cache
+// and returns the patched cache. The cache passed is not modified.
+func applyCachePatches(cache []byte, patches []spectrumpacket.CachePatch) ([]byte, error) {
+	patched := make([]byte, 0, len(cache))
+	var offset int
+	for _, patch := range patches {
+		start, end := int(patch.Offset), int(patch.Offset)+int(patch.Length)
+		if start < offset || end > len(cache) {
+			return nil, fmt.Errorf("patch of %d bytes at offset %d out of range", patch.Length, patch.Offset)
+		}
+		patched = append(patched, cache[offset:start]...)
+		patched = append(patched, patch.Data...)
+		offset = end
+	}
+	return append(patched, cache[offset:]...), nil
+}
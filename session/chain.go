@@ -0,0 +1,215 @@
+package session
+
+import (
+	"slices"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/resource"
+)
+
+// chainEntry is a single processor of a processorChain.
+type chainEntry struct {
+	processor Processor
+	priority  int
+	subs      subscriptions
+}
+
+// processorChain is a Processor that runs the hooks of multiple processors in order of their priority.
+// Every processor of the chain is called with the same context, so cancellation or modification by one
+// processor is visible to the processors after it. Processors are called even if the context was already
+// cancelled by an earlier processor, allowing them to observe or revert the cancellation.
+// A processorChain is never modified once created, instead a new chain is created when a processor is added.
+type processorChain struct {
+	entries []chainEntry
+}
+
+// Ensure that processorChain satisfies the Processor and PacketSubscriber interfaces.
+var (
+	_ Processor        = &processorChain{}
+	_ PacketSubscriber = &processorChain{}
+)
+
+// with returns a copy of the chain with the processor added. Processors with a higher priority run first,
+// processors with the same priority run in the order they were added.
+func (c *processorChain) with(processor Processor, priority int) *processorChain {
+	entries := append(slices.Clone(c.entries), chainEntry{
+		processor: processor,
+		priority:  priority,
+		subs:      newSubscriptions(processor),
+	})
+	slices.SortStableFunc(entries, func(a, b chainEntry) int {
+		return b.priority - a.priority
+	})
+	return &processorChain{entries: entries}
+}
+
+// SubscribedClientPackets returns the union of the client packets the processors of the chain subscribed to.
+func (c *processorChain) SubscribedClientPackets() []uint32 {
+	return c.union(func(subs subscriptions) map[uint32]struct{} { return subs.client })
+}
+
+// SubscribedServerPackets returns the union of the server packets the processors of the chain subscribed to.
+func (c *processorChain) SubscribedServerPackets() []uint32 {
+	return c.union(func(subs subscriptions) map[uint32]struct{} { return subs.server })
+}
+
+// ProcessLogin ...
+func (c *processorChain) ProcessLogin(ctx *Context, identity login.IdentityData, client login.ClientData) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessLogin(ctx, identity, client)
+	}
+}
+
+// ProcessResourcePacks ...
+func (c *processorChain) ProcessResourcePacks(ctx *Context, packs *[]*resource.Pack) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessResourcePacks(ctx, packs)
+	}
+}
+
+// ProcessStartGame ...
+func (c *processorChain) ProcessStartGame(ctx *Context, data *minecraft.GameData) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessStartGame(ctx, data)
+	}
+}
+
+// ProcessServer ...
+func (c *processorChain) ProcessServer(ctx *PacketContext) {
+	for _, entry := range c.entries {
+		if subscribedServer(entry.subs.server, ctx) {
+			entry.processor.ProcessServer(ctx)
+		}
+	}
+}
+
+// ProcessClient ...
+func (c *processorChain) ProcessClient(batch []*PacketContext) {
+	for _, entry := range c.entries {
+		if batch := subscribedBatch(entry.subs.client, batch); len(batch) > 0 {
+			entry.processor.ProcessClient(batch)
+		}
+	}
+}
+
+// ProcessServerBatch ...
+func (c *processorChain) ProcessServerBatch(batch []*PacketContext) {
+	for _, entry := range c.entries {
+		if batch := subscribedServerBatch(entry.subs.server, batch); len(batch) > 0 {
+			entry.processor.ProcessServerBatch(batch)
+		}
+	}
+}
+
+// ProcessServerSent ...
+func (c *processorChain) ProcessServerSent(ctx *PacketContext, latency time.Duration) {
+	for _, entry := range c.entries {
+		if subscribedServer(entry.subs.server, ctx) {
+			entry.processor.ProcessServerSent(ctx, latency)
+		}
+	}
+}
+
+// ProcessClientSent ...
+func (c *processorChain) ProcessClientSent(batch []*PacketContext, latency time.Duration) {
+	for _, entry := range c.entries {
+		if batch := subscribedBatch(entry.subs.client, batch); len(batch) > 0 {
+			entry.processor.ProcessClientSent(batch, latency)
+		}
+	}
+}
+
+// ProcessLatency ...
+func (c *processorChain) ProcessLatency(ctx *Context, latency *int64, timestamp *int64) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessLatency(ctx, latency, timestamp)
+	}
+}
+
+// ProcessFlush ...
+func (c *processorChain) ProcessFlush(ctx *Context) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessFlush(ctx)
+	}
+}
+
+// ProcessPreTransfer ...
+func (c *processorChain) ProcessPreTransfer(ctx *Context, origin *string, target *string) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessPreTransfer(ctx, origin, target)
+	}
+}
+
+// ProcessTransferFailure ...
+func (c *processorChain) ProcessTransferFailure(ctx *Context, origin *string, target *string) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessTransferFailure(ctx, origin, target)
+	}
+}
+
+// ProcessTransferRejected ...
+func (c *processorChain) ProcessTransferRejected(ctx *Context, target string, err error) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessTransferRejected(ctx, target, err)
+	}
+}
+
+// ProcessPostTransfer ...
+func (c *processorChain) ProcessPostTransfer(ctx *Context, origin *string, target *string) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessPostTransfer(ctx, origin, target)
+	}
+}
+
+// ProcessDimensionChange ...
+func (c *processorChain) ProcessDimensionChange(ctx *Context, from int32, to int32) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessDimensionChange(ctx, from, to)
+	}
+}
+
+// ProcessCache ...
+func (c *processorChain) ProcessCache(ctx *Context, new *[]byte) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessCache(ctx, new)
+	}
+}
+
+// ProcessDisconnection ...
+func (c *processorChain) ProcessDisconnection(ctx *Context, message *string) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessDisconnection(ctx, message)
+	}
+}
+
+// ProcessProtocolMismatch ...
+func (c *processorChain) ProcessProtocolMismatch(ctx *Context, failures int, err error) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessProtocolMismatch(ctx, failures, err)
+	}
+}
+
+// ProcessServerRemoved ...
+func (c *processorChain) ProcessServerRemoved(ctx *Context, addr string) {
+	for _, entry := range c.entries {
+		entry.processor.ProcessServerRemoved(ctx, addr)
+	}
+}
+
+// union returns the union of the packet sets returned by set for every processor of the chain, or nil if
+// any of the processors subscribed to every packet.
+func (c *processorChain) union(set func(subs subscriptions) map[uint32]struct{}) []uint32 {
+	ids := make([]uint32, 0)
+	for _, entry := range c.entries {
+		s := set(entry.subs)
+		if s == nil {
+			return nil
+		}
+		for id := range s {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
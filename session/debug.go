@@ -0,0 +1,62 @@
+package session
+
+// DebugState is a snapshot of the internal state of a session, meant for diagnosing sessions that are stuck.
+type DebugState struct {
+	// XUID is the XUID of the session's client.
+	XUID string `json:"xuid"`
+	// Username is the display name of the session's client.
+	Username string `json:"username"`
+	// Server is the address of the server the session is currently connected to.
+	Server string `json:"server"`
+	// Latency is the total latency of the session in milliseconds.
+	Latency int64 `json:"latency"`
+	// TimeInCurrentServer is the amount of milliseconds the session spent on its current server.
+	TimeInCurrentServer int64 `json:"time_in_current_server"`
+	// InFallback is whether the session is currently falling back to another server.
+	InFallback bool `json:"in_fallback"`
+	// Goroutines is the amount of goroutines currently running for the session, including the read loops,
+	// the latency loop and the workers started by opts.AsyncProcessorWorkers.
+	Goroutines int32 `json:"goroutines"`
+	// ClientQueue and ServerQueue are the amount of client batches and server packets that were read but not
+	// yet written. They are only non-zero if opts.AsyncProcessorWorkers is set.
+	ClientQueue int `json:"client_queue"`
+	ServerQueue int `json:"server_queue"`
+	// ObserverQueue is the amount of client batches queued for the function set using ObserveRawClientBatch.
+	ObserverQueue int `json:"observer_queue"`
+}
+
+// DebugState returns a snapshot of the internal state of the session.
+func (s *Session) DebugState() DebugState {
+	s.serverMu.RLock()
+	serverAddr := s.serverAddr
+	s.serverMu.RUnlock()
+
+	identityData := s.Client().IdentityData()
+	state := DebugState{
+		XUID:                identityData.XUID,
+		Username:            identityData.DisplayName,
+		Server:              serverAddr,
+		Latency:             s.Latency(),
+		TimeInCurrentServer: s.TimeInCurrentServer().Milliseconds(),
+		InFallback:          s.inFallback.Load(),
+		Goroutines:          s.goroutines.Load(),
+	}
+	if f := s.clientForwarder.Load(); f != nil {
+		state.ClientQueue = f.queued()
+	}
+	if f := s.serverForwarder.Load(); f != nil {
+		state.ServerQueue = f.queued()
+	}
+	if observer := s.batchObserver.Load(); observer != nil {
+		state.ObserverQueue = len(observer.queue)
+	}
+	return state
+}
+
+// trackGoroutine counts a goroutine started for the session until the function returned is called.
+func (s *Session) trackGoroutine() func() {
+	s.goroutines.Add(1)
+	return func() {
+		s.goroutines.Add(-1)
+	}
+}
@@ -0,0 +1,129 @@
+package session
+
+import (
+	"maps"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+const (
+	// DecodeAllow decodes only the packets in the decode list.
+	DecodeAllow = "allow"
+	// DecodeDeny decodes every packet except those in the decode list.
+	DecodeDeny = "deny"
+	// DecodeAll decodes every packet, ignoring the decode list.
+	DecodeAll = "all"
+)
+
+// SetClientDecode replaces the IDs of the client packets that are decoded by the proxy, which are initially those
+// in opts.ClientDecode. The IDs are interpreted according to opts.ClientDecodeMode. It may be called at any time, such as by a processor that only needs inventory packets
+// decoded while the player is flagged, and applies from the next batch read from the client on.
+func (s *Session) SetClientDecode(ids []uint32) {
+	set := make(map[uint32]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	s.clientDecodeIDs.Store(&set)
+}
+
+// SetServerDecode replaces the IDs of the server packets that are decoded by the proxy once the player spawned,
+// which are initially those in opts.ServerDecode. The IDs are interpreted according to opts.ServerDecodeMode. A nil
+// slice decodes every packet the server marks as to be
+// decoded. It may be called at any time and applies to the current server connection immediately and to the
+// connections of later transfers.
+func (s *Session) SetServerDecode(ids []uint32) {
+	var set map[uint32]struct{}
+	if ids != nil {
+		set = make(map[uint32]struct{}, len(ids))
+		for _, id := range ids {
+			set[id] = struct{}{}
+		}
+	}
+	s.serverDecodeIDs.Store(&set)
+	s.refreshServerDecode()
+}
+
+// refreshServerDecode applies the server packet IDs returned by serverDecode to the current server connection.
+func (s *Session) refreshServerDecode() {
+	if conn := s.Server(); conn != nil {
+		conn.SetDecode(s.serverDecode())
+	}
+}
+
+// clientDecode returns the client decode list of the session, which is interpreted according to
+// opts.ClientDecodeMode.
+func (s *Session) clientDecode() map[uint32]struct{} {
+	if ids := s.clientDecodeIDs.Load(); ids != nil {
+		return *ids
+	}
+	return s.opts.ClientDecode
+}
+
+// decodesClient returns whether client packets with the ID passed are decoded according to the client decode list
+// and opts.ClientDecodeMode, regardless of the processor's subscriptions.
+func (s *Session) decodesClient(decode map[uint32]struct{}, id uint32) bool {
+	if s.opts.EnableAllClientDecode {
+		return true
+	}
+
+	_, ok := decode[id]
+	switch s.opts.ClientDecodeMode {
+	case DecodeAll:
+		return true
+	case DecodeDeny:
+		return !ok
+	default:
+		return ok
+	}
+}
+
+// decodesAnyClient returns whether any client packets may be decoded according to the client decode list and
+// opts.ClientDecodeMode.
+func (s *Session) decodesAnyClient() bool {
+	switch {
+	case s.opts.EnableAllClientDecode:
+		return true
+	case s.opts.ClientDecodeMode == DecodeAll || s.opts.ClientDecodeMode == DecodeDeny:
+		return true
+	default:
+		return len(s.clientDecode()) > 0
+	}
+}
+
+// serverDecode returns the server packet IDs passed to server.Conn.SetDecode, along with whether they are the IDs of
+// the packets that are not decoded, according to the server decode list and opts.ServerDecodeMode. The packets the
+// session needs decoded itself are always decoded. A nil set is returned if every packet is decoded.
+func (s *Session) serverDecode() (map[uint32]struct{}, bool) {
+	decode := s.opts.ServerDecode
+	if ids := s.serverDecodeIDs.Load(); ids != nil {
+		decode = *ids
+	}
+	if decode == nil || s.opts.ServerDecodeMode == DecodeAll {
+		return nil, false
+	}
+
+	required := map[uint32]struct{}{packet.IDStartGame: {}, packet.IDItemRegistry: {}}
+	if !s.opts.DisableTracker {
+		maps.Copy(required, trackedPackets)
+	}
+	if s.entities != nil {
+		maps.Copy(required, serverEntityPackets)
+	}
+	if set := s.filters.Load(); set != nil {
+		for id := range set.server {
+			if s.filterDecodes(false, id) {
+				required[id] = struct{}{}
+			}
+		}
+	}
+
+	ids := maps.Clone(decode)
+	if s.opts.ServerDecodeMode == DecodeDeny {
+		for id := range required {
+			delete(ids, id)
+		}
+		return ids, true
+	}
+	maps.Copy(ids, required)
+	return ids, false
+}
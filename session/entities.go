@@ -0,0 +1,259 @@
+package session
+
+import (
+	"sync"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// entityIDs translates the entity IDs used by the server the session is on to IDs that are unique on the client
+// across transfers, and back. Every entity of a server is assigned a new client ID the first time it is seen, and
+// client IDs are never reused, so an entity of a new server can never share its ID with an entity the client still
+// holds from a previous server. The player itself keeps the IDs it was given by the first server.
+type entityIDs struct {
+	runtime idTable[uint64]
+	unique  idTable[int64]
+	// runtimeIDs holds the runtime ID of every entity added by the server by its unique ID, so that both mappings
+	// are removed once the entity is removed.
+	runtimeIDs map[int64]uint64
+	mu         sync.Mutex
+}
+
+// newEntityIDs creates an empty entityIDs.
+func newEntityIDs() *entityIDs {
+	return &entityIDs{
+		runtime:    newIDTable[uint64](),
+		unique:     newIDTable[int64](),
+		runtimeIDs: make(map[int64]uint64),
+	}
+}
+
+// reset forgets the IDs of the previous server and maps the IDs of the player on the server, found in the game data
+// of the server, to the IDs of the player on the client.
+func (e *entityIDs) reset(server, client minecraft.GameData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.runtime.reset(server.EntityRuntimeID, client.EntityRuntimeID)
+	e.unique.reset(server.EntityUniqueID, client.EntityUniqueID)
+	clear(e.runtimeIDs)
+}
+
+// toClient rewrites the entity IDs of a packet sent by the server to the IDs used on the client.
+func (e *entityIDs) toClient(pk packet.Packet) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	runtime, unique := e.runtime.client, e.unique.client
+	switch pk := pk.(type) {
+	case *packet.ActorEvent:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.AddActor:
+		e.runtimeIDs[pk.EntityUniqueID] = pk.EntityRuntimeID
+		pk.EntityUniqueID, pk.EntityRuntimeID = unique(pk.EntityUniqueID), runtime(pk.EntityRuntimeID)
+		translateLinks(pk.EntityLinks, unique)
+	case *packet.AddItemActor:
+		e.runtimeIDs[pk.EntityUniqueID] = pk.EntityRuntimeID
+		pk.EntityUniqueID, pk.EntityRuntimeID = unique(pk.EntityUniqueID), runtime(pk.EntityRuntimeID)
+	case *packet.AddPainting:
+		e.runtimeIDs[pk.EntityUniqueID] = pk.EntityRuntimeID
+		pk.EntityUniqueID, pk.EntityRuntimeID = unique(pk.EntityUniqueID), runtime(pk.EntityRuntimeID)
+	case *packet.AddPlayer:
+		e.runtimeIDs[pk.AbilityData.EntityUniqueID] = pk.EntityRuntimeID
+		pk.AbilityData.EntityUniqueID, pk.EntityRuntimeID = unique(pk.AbilityData.EntityUniqueID), runtime(pk.EntityRuntimeID)
+		translateLinks(pk.EntityLinks, unique)
+	case *packet.Animate:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.BossEvent:
+		pk.BossEntityUniqueID, pk.PlayerUniqueID = unique(pk.BossEntityUniqueID), unique(pk.PlayerUniqueID)
+	case *packet.MobArmourEquipment:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.MobEffect:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.MobEquipment:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.MoveActorAbsolute:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.MoveActorDelta:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.MovePlayer:
+		pk.EntityRuntimeID, pk.RiddenEntityRuntimeID = runtime(pk.EntityRuntimeID), runtime(pk.RiddenEntityRuntimeID)
+	case *packet.PlayerList:
+		for i := range pk.Entries {
+			pk.Entries[i].EntityUniqueID = unique(pk.Entries[i].EntityUniqueID)
+		}
+	case *packet.RemoveActor:
+		id := pk.EntityUniqueID
+		pk.EntityUniqueID = unique(id)
+		e.unique.forget(id)
+		if runtimeID, ok := e.runtimeIDs[id]; ok {
+			e.runtime.forget(runtimeID)
+			delete(e.runtimeIDs, id)
+		}
+	case *packet.SetActorData:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.SetActorLink:
+		pk.EntityLink.RiddenEntityUniqueID = unique(pk.EntityLink.RiddenEntityUniqueID)
+		pk.EntityLink.RiderEntityUniqueID = unique(pk.EntityLink.RiderEntityUniqueID)
+	case *packet.SetActorMotion:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.SetScore:
+		for i, entry := range pk.Entries {
+			if entry.IdentityType != protocol.ScoreboardIdentityFakePlayer {
+				pk.Entries[i].EntityUniqueID = unique(entry.EntityUniqueID)
+			}
+		}
+	case *packet.TakeItemActor:
+		pk.ItemEntityRuntimeID, pk.TakerEntityRuntimeID = runtime(pk.ItemEntityRuntimeID), runtime(pk.TakerEntityRuntimeID)
+	case *packet.UpdateAbilities:
+		pk.AbilityData.EntityUniqueID = unique(pk.AbilityData.EntityUniqueID)
+	case *packet.UpdateAttributes:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	}
+}
+
+// toServer rewrites the entity IDs of a packet sent by the client to the IDs used on the server, returning false if
+// the packet holds no entity IDs.
+func (e *entityIDs) toServer(pk packet.Packet) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	runtime := e.runtime.server
+	switch pk := pk.(type) {
+	case *packet.ActorEvent:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.ActorPickRequest:
+		pk.EntityUniqueID = e.unique.server(pk.EntityUniqueID)
+	case *packet.Animate:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.Interact:
+		pk.TargetEntityRuntimeID = runtime(pk.TargetEntityRuntimeID)
+	case *packet.InventoryTransaction:
+		data, ok := pk.TransactionData.(*protocol.UseItemOnEntityTransactionData)
+		if !ok {
+			return false
+		}
+		data.TargetEntityRuntimeID = runtime(data.TargetEntityRuntimeID)
+	case *packet.MobEquipment:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.MovePlayer:
+		pk.EntityRuntimeID, pk.RiddenEntityRuntimeID = runtime(pk.EntityRuntimeID), runtime(pk.RiddenEntityRuntimeID)
+	case *packet.PlayerAction:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	case *packet.Respawn:
+		pk.EntityRuntimeID = runtime(pk.EntityRuntimeID)
+	default:
+		return false
+	}
+	return true
+}
+
+// translateLinks rewrites the entity IDs of the links passed using the function passed.
+func translateLinks(links []protocol.EntityLink, unique func(int64) int64) {
+	for i := range links {
+		links[i].RiddenEntityUniqueID = unique(links[i].RiddenEntityUniqueID)
+		links[i].RiderEntityUniqueID = unique(links[i].RiderEntityUniqueID)
+	}
+}
+
+// clientEntityPackets holds the IDs of the client packets holding entity IDs, which must be decoded to be
+// translated by entityIDs.toServer.
+var clientEntityPackets = map[uint32]struct{}{
+	packet.IDActorEvent:           {},
+	packet.IDActorPickRequest:     {},
+	packet.IDAnimate:              {},
+	packet.IDInteract:             {},
+	packet.IDInventoryTransaction: {},
+	packet.IDMobEquipment:         {},
+	packet.IDMovePlayer:           {},
+	packet.IDPlayerAction:         {},
+	packet.IDRespawn:              {},
+}
+
+// serverEntityPackets holds the IDs of the server packets holding entity IDs, which must be decoded to be
+// translated by entityIDs.toClient.
+var serverEntityPackets = map[uint32]struct{}{
+	packet.IDActorEvent:         {},
+	packet.IDAddActor:           {},
+	packet.IDAddItemActor:       {},
+	packet.IDAddPainting:        {},
+	packet.IDAddPlayer:          {},
+	packet.IDAnimate:            {},
+	packet.IDBossEvent:          {},
+	packet.IDMobArmourEquipment: {},
+	packet.IDMobEffect:          {},
+	packet.IDMobEquipment:       {},
+	packet.IDMoveActorAbsolute:  {},
+	packet.IDMoveActorDelta:     {},
+	packet.IDMovePlayer:         {},
+	packet.IDPlayerList:         {},
+	packet.IDRemoveActor:        {},
+	packet.IDSetActorData:       {},
+	packet.IDSetActorLink:       {},
+	packet.IDSetActorMotion:     {},
+	packet.IDSetScore:           {},
+	packet.IDTakeItemActor:      {},
+	packet.IDUpdateAbilities:    {},
+	packet.IDUpdateAttributes:   {},
+}
+
+// idTable maps the IDs of one kind of entity ID between a server and the client.
+type idTable[T int64 | uint64] struct {
+	// serverSelf and clientSelf are the IDs of the player on the server and the client.
+	serverSelf, clientSelf T
+	// next is the last client ID that was assigned.
+	next     T
+	toClient map[T]T
+	toServer map[T]T
+}
+
+// newIDTable creates an empty idTable.
+func newIDTable[T int64 | uint64]() idTable[T] {
+	return idTable[T]{toClient: make(map[T]T), toServer: make(map[T]T)}
+}
+
+// reset forgets all mappings and maps the ID of the player on the server to the ID of the player on the client.
+// Assigned client IDs are never assigned again, even after a reset.
+func (t *idTable[T]) reset(serverSelf, clientSelf T) {
+	t.serverSelf, t.clientSelf = serverSelf, clientSelf
+	t.next = max(t.next, clientSelf)
+	clear(t.toClient)
+	clear(t.toServer)
+}
+
+// client returns the client ID of the server ID passed, assigning a new client ID if it has none yet. Zero is never
+// translated, since it is used for no entity.
+func (t *idTable[T]) client(id T) T {
+	if id == 0 {
+		return 0
+	}
+	if id == t.serverSelf {
+		return t.clientSelf
+	}
+	if clientID, ok := t.toClient[id]; ok {
+		return clientID
+	}
+
+	t.next++
+	t.toClient[id] = t.next
+	t.toServer[t.next] = id
+	return t.next
+}
+
+// server returns the server ID of the client ID passed, or the ID itself if it is not mapped.
+func (t *idTable[T]) server(id T) T {
+	if id == t.clientSelf {
+		return t.serverSelf
+	}
+	if serverID, ok := t.toServer[id]; ok {
+		return serverID
+	}
+	return id
+}
+
+// forget removes the mapping of the server ID passed.
+func (t *idTable[T]) forget(id T) {
+	if clientID, ok := t.toClient[id]; ok {
+		delete(t.toClient, id)
+		delete(t.toServer, clientID)
+	}
+}
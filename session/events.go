@@ -0,0 +1,83 @@
+package session
+
+import (
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// SessionStarted is published once a session logged in and spawned on its first server.
+type SessionStarted struct {
+	Session *Session
+	// Server is the address of the server the session spawned on.
+	Server string
+}
+
+// TransferCompleted is published once a session completed a server change, including fallbacks.
+type TransferCompleted struct {
+	Session *Session
+	// Record is the record of the server change added to the transfer history of the session.
+	Record TransferRecord
+}
+
+// SessionClosed is published once a session was closed.
+type SessionClosed struct {
+	Session *Session
+	// Cause is the error the session was closed with, which is also the cause of the session's context.
+	Cause error
+}
+
+// EventBus distributes the lifecycle events of sessions, such as SessionStarted, TransferCompleted and
+// SessionClosed, to handlers subscribed using Subscribe. Unlike processors, which are set per session and revolve
+// around packets, a single bus observes the lifecycle of every session it was set on using Session.SetEventBus or
+// Spectrum.SetEventBus.
+type EventBus struct {
+	handlers map[reflect.Type][]*eventHandler
+	mu       sync.RWMutex
+}
+
+// eventHandler is a handler subscribed to an EventBus.
+type eventHandler struct {
+	fn func(event any)
+}
+
+// NewEventBus creates a new EventBus without handlers.
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: make(map[reflect.Type][]*eventHandler)}
+}
+
+// Subscribe subscribes the handler passed to the events of type E published to the bus, returning a function
+// that unsubscribes it. Handlers are called synchronously on the goroutine publishing the event, in the order
+// they were subscribed in, so they must not block.
+func Subscribe[E any](bus *EventBus, handler func(event E)) (unsubscribe func()) {
+	t := reflect.TypeFor[E]()
+	h := &eventHandler{fn: func(event any) {
+		handler(event.(E))
+	}}
+
+	bus.mu.Lock()
+	bus.handlers[t] = append(bus.handlers[t], h)
+	bus.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			bus.mu.Lock()
+			defer bus.mu.Unlock()
+			// The handlers are cloned since Publish may still be iterating over them.
+			bus.handlers[t] = slices.DeleteFunc(slices.Clone(bus.handlers[t]), func(other *eventHandler) bool {
+				return other == h
+			})
+		})
+	}
+}
+
+// Publish calls the handlers subscribed to the type of the event passed.
+func (b *EventBus) Publish(event any) {
+	b.mu.RLock()
+	handlers := b.handlers[reflect.TypeOf(event)]
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h.fn(event)
+	}
+}
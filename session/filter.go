@@ -0,0 +1,379 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/cooldogedev/spectrum/util"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+const (
+	// FilterDrop drops the packets matched by a filter rule.
+	FilterDrop = "drop"
+	// FilterLog logs the packets matched by a filter rule and forwards them.
+	FilterLog = "log"
+	// FilterRateLimit forwards the packets matched by a filter rule up to the rule's rate and drops the others.
+	FilterRateLimit = "rate_limit"
+)
+
+// FilterRule is a packet filter rule of a session, which drops, logs or rate-limits the packets it matches without
+// requiring a processor. Rules are either built programmatically or compiled from configuration using
+// CompileFilterRule.
+type FilterRule struct {
+	// Name is the name of the rule, which is logged for the packets it matches.
+	Name string
+	// Client specifies whether the rule applies to packets sent by the client rather than by the server.
+	Client bool
+	// ID is the ID of the packets the rule applies to.
+	ID uint32
+	// Action is what is done with the packets matched, either FilterDrop, FilterLog or FilterRateLimit.
+	Action string
+	// Rate is the maximum amount of matched packets per second that are forwarded if Action is FilterRateLimit.
+	Rate int64
+	// Match restricts the rule to the packets it returns true for, if set. Rules with Match only match decoded
+	// packets, which is why the client packets they apply to are always decoded. Server packets are only decoded
+	// if the server marks them as to be decoded.
+	Match func(pk packet.Packet) bool
+}
+
+// CompileFilterRule compiles a filter rule from configuration. Its field conditions are validated against the
+// type of the packets it applies to and compiled into the Match function of the rule.
+func CompileFilterRule(config util.FilterRule) (FilterRule, error) {
+	rule := FilterRule{Name: config.Name, ID: config.ID, Action: config.Action, Rate: config.Rate}
+	var pool packet.Pool
+	switch config.Direction {
+	case "client":
+		rule.Client, pool = true, packet.NewClientPool()
+	case "server":
+		pool = packet.NewServerPool()
+	default:
+		return FilterRule{}, fmt.Errorf("unknown direction %q", config.Direction)
+	}
+
+	if len(config.Fields) == 0 {
+		return rule, validateFilterRule(rule)
+	}
+
+	factory, ok := pool[config.ID]
+	if !ok {
+		return FilterRule{}, fmt.Errorf("unknown %s packet with id %d", config.Direction, config.ID)
+	}
+
+	conditions := make([]func(v reflect.Value) bool, 0, len(config.Fields))
+	for _, field := range config.Fields {
+		condition, err := compileFieldCondition(reflect.TypeOf(factory()).Elem(), field)
+		if err != nil {
+			return FilterRule{}, fmt.Errorf("field %s: %w", field.Field, err)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	rule.Match = func(pk packet.Packet) bool {
+		v := reflect.ValueOf(pk).Elem()
+		for _, condition := range conditions {
+			if !condition(v) {
+				return false
+			}
+		}
+		return true
+	}
+	return rule, validateFilterRule(rule)
+}
+
+// validateFilterRule returns an error if the action or rate of the rule is invalid.
+func validateFilterRule(rule FilterRule) error {
+	switch rule.Action {
+	case FilterDrop, FilterLog:
+		return nil
+	case FilterRateLimit:
+		if rule.Rate <= 0 {
+			return errors.New("rate must be positive")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+}
+
+// compileFieldCondition compiles a condition on a field of the packet struct type passed into a function reporting
+// whether a packet struct value meets it.
+func compileFieldCondition(t reflect.Type, condition util.FieldCondition) (func(v reflect.Value) bool, error) {
+	var index []int
+	for _, name := range strings.Split(condition.Field, ".") {
+		if t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("%s is not a struct", t)
+		}
+
+		field, ok := t.FieldByName(name)
+		if !ok || !field.IsExported() {
+			return nil, fmt.Errorf("%s has no field %s", t, name)
+		}
+		index = append(index, field.Index...)
+		t = field.Type
+	}
+
+	get := func(v reflect.Value) reflect.Value {
+		return v.FieldByIndex(index)
+	}
+	switch condition.Op {
+	case "len_lt", "len_gt":
+		switch t.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		default:
+			return nil, fmt.Errorf("%s has no length", t)
+		}
+
+		n, err := strconv.Atoi(condition.Value)
+		if err != nil {
+			return nil, err
+		}
+		if condition.Op == "len_lt" {
+			return func(v reflect.Value) bool { return get(v).Len() < n }, nil
+		}
+		return func(v reflect.Value) bool { return get(v).Len() > n }, nil
+	case "contains":
+		if t.Kind() != reflect.String {
+			return nil, fmt.Errorf("%s is not a string", t)
+		}
+		return func(v reflect.Value) bool { return strings.Contains(get(v).String(), condition.Value) }, nil
+	case "eq", "ne", "lt", "gt":
+		compare, err := compareField(t, condition.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		ordered := condition.Op == "lt" || condition.Op == "gt"
+		if ordered && (t.Kind() == reflect.String || t.Kind() == reflect.Bool) {
+			return nil, fmt.Errorf("%s is not a number", t)
+		}
+		return func(v reflect.Value) bool {
+			switch c := compare(get(v)); condition.Op {
+			case "eq":
+				return c == 0
+			case "ne":
+				return c != 0
+			case "lt":
+				return c < 0
+			default:
+				return c > 0
+			}
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", condition.Op)
+	}
+}
+
+// compareField returns a function comparing a field of the type passed with the value passed, parsed according to
+// the kind of the type. It returns a negative number if the field is smaller, zero if they are equal and a positive
+// number if the field is greater.
+func compareField(t reflect.Type, value string) (func(v reflect.Value) int, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return func(v reflect.Value) int { return strings.Compare(v.String(), value) }, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) int {
+			if v.Bool() == b {
+				return 0
+			}
+			return 1
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) int { return compareOrdered(v.Int(), n) }, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) int { return compareOrdered(v.Uint(), n) }, nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) int { return compareOrdered(v.Float(), f) }, nil
+	default:
+		return nil, fmt.Errorf("%s cannot be compared", t)
+	}
+}
+
+// compareOrdered compares a and b, returning -1, 0 or 1.
+func compareOrdered[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// filterSet holds the filter rules of a session by the ID of the packets they apply to.
+type filterSet struct {
+	client map[uint32][]*activeFilterRule
+	server map[uint32][]*activeFilterRule
+}
+
+// activeFilterRule is a filter rule of a session, along with the bucket limiting the rate of the packets it
+// matches if it is a FilterRateLimit rule.
+type activeFilterRule struct {
+	FilterRule
+	bucket *tokenBucket
+}
+
+// SetFilterRules replaces the filter rules of the session, which are initially compiled from opts.FilterRules. A
+// nil slice removes all rules. An error is returned if any of the rules is invalid, in which case the rules of the
+// session are left unchanged.
+func (s *Session) SetFilterRules(rules []FilterRule) error {
+	if len(rules) == 0 {
+		s.filters.Store(nil)
+		s.refreshServerDecode()
+		return nil
+	}
+
+	set := &filterSet{client: make(map[uint32][]*activeFilterRule), server: make(map[uint32][]*activeFilterRule)}
+	for _, rule := range rules {
+		if err := validateFilterRule(rule); err != nil {
+			return fmt.Errorf("filter rule %q: %w", rule.Name, err)
+		}
+
+		active := &activeFilterRule{FilterRule: rule}
+		if rule.Action == FilterRateLimit {
+			active.bucket = newTokenBucket(rule.Rate)
+		}
+		if rule.Client {
+			set.client[rule.ID] = append(set.client[rule.ID], active)
+		} else {
+			set.server[rule.ID] = append(set.server[rule.ID], active)
+		}
+	}
+	s.filters.Store(set)
+	s.refreshServerDecode()
+	return nil
+}
+
+// setConfiguredFilterRules compiles the rules of opts.FilterRules and sets them as the filter rules of the
+// session. Invalid rules are logged and ignored.
+func (s *Session) setConfiguredFilterRules() {
+	rules := make([]FilterRule, 0, len(s.opts.FilterRules))
+	for _, config := range s.opts.FilterRules {
+		rule, err := CompileFilterRule(config)
+		if err != nil {
+			s.logger.Error("invalid filter rule", "rule", config.Name, "err", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	_ = s.SetFilterRules(rules)
+}
+
+// filter applies the filter rules of the session to a packet, returning false if the packet is dropped. pk is nil
+// if the packet was not decoded, in which case rules with a Match function do not match it. If matchOnly is set,
+// only the rules with a Match function are applied, since the client pipeline applies the other rules before the
+// packet is decoded.
+func (s *Session) filter(client bool, id uint32, pk packet.Packet, matchOnly bool) bool {
+	set := s.filters.Load()
+	if set == nil {
+		return true
+	}
+
+	rules := set.server[id]
+	direction := "server"
+	if client {
+		rules, direction = set.client[id], "client"
+	}
+
+	for _, rule := range rules {
+		if matchOnly && rule.Match == nil {
+			continue
+		}
+		if rule.Match != nil && (pk == nil || !rule.Match(pk)) {
+			continue
+		}
+
+		switch rule.Action {
+		case FilterDrop:
+			return false
+		case FilterLog:
+			s.logger.Info("packet matched filter rule", "rule", rule.Name, "direction", direction, "id", id)
+		case FilterRateLimit:
+			if !rule.bucket.take(1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// filtersClient returns whether the session has filter rules for client packets.
+func (s *Session) filtersClient() bool {
+	set := s.filters.Load()
+	return set != nil && len(set.client) > 0
+}
+
+// filterDecodes returns whether packets with the ID passed must be decoded for the filter rules of the session.
+func (s *Session) filterDecodes(client bool, id uint32) bool {
+	set := s.filters.Load()
+	if set == nil {
+		return false
+	}
+
+	rules := set.server[id]
+	if client {
+		rules = set.client[id]
+	}
+	for _, rule := range rules {
+		if rule.Match != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// filterPacketIDs applies the filter rules of the session without a Match function to the packets of the batch,
+// dropping the packets the rules drop before they are decoded.
+func filterPacketIDs(p *clientPipeline, batch []*PacketContext) ([]*PacketContext, error) {
+	if !p.s.filtersClient() {
+		return batch, nil
+	}
+
+	kept := batch[:0]
+	for _, ctx := range batch {
+		if !p.s.filter(true, ctx.id, nil, false) {
+			ReturnPacketContext(ctx)
+			continue
+		}
+		kept = append(kept, ctx)
+	}
+	return kept, nil
+}
+
+// filterPackets applies the filter rules of the session with a Match function to the decoded packets of the
+// batch, dropping the packets the rules drop.
+func filterPackets(p *clientPipeline, batch []*PacketContext) ([]*PacketContext, error) {
+	if !p.s.filtersClient() {
+		return batch, nil
+	}
+
+	kept := batch[:0]
+	for _, ctx := range batch {
+		if !p.s.filter(true, ctx.id, ctx.decoded, true) {
+			ReturnPacketContext(ctx)
+			continue
+		}
+		kept = append(kept, ctx)
+	}
+	return kept, nil
+}
@@ -0,0 +1,104 @@
+package session
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum/tracing"
+)
+
+// flushCoalescer coalesces the client flushes requested by the server within opts.FlushCoalesceWindow into a
+// single flush, which is done once the window that started with the first request elapsed.
+type flushCoalescer struct {
+	s       *Session
+	window  time.Duration
+	pending bool
+	mu      sync.Mutex
+}
+
+// request schedules a flush of the client at the end of the current window, starting a new window if no flush
+// is scheduled yet.
+func (c *flushCoalescer) request() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending {
+		return
+	}
+
+	c.pending = true
+	time.AfterFunc(c.window, func() {
+		c.mu.Lock()
+		c.pending = false
+		c.mu.Unlock()
+		if c.s.ctx.Err() != nil {
+			return
+		}
+		if err := c.s.flushClient(); err != nil {
+			c.s.logger.Debug("coalesced flush failed", "err", err)
+		}
+	})
+}
+
+// flushClient flushes the buffer of the client, ending the span of the first flush after a transfer if there is
+// one.
+func (s *Session) flushClient() error {
+	err := s.Client().Flush()
+	if span := s.firstFlush.Swap(nil); span != nil {
+		tracing.End(*span, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to flush client's buffer: %w", err)
+	}
+	return nil
+}
+
+// clientBatcher batches the server packets written to the client into a single batch, flushing the client once
+// opts.ClientBatchSize bytes were written since the last flush or opts.ClientBatchDelay elapsed since the first
+// packet of the batch was written, whichever comes first.
+type clientBatcher struct {
+	s       *Session
+	size    int
+	delay   time.Duration
+	pending int
+	timer   *time.Timer
+	mu      sync.Mutex
+}
+
+// written records that a packet of n bytes was written to the client, flushing the batch if it reached the batch
+// size or scheduling a flush after the batch delay if this is the first packet of the batch. Packets the server
+// sent decoded are recorded with zero bytes, since their encoded size is unknown to the session.
+func (b *clientBatcher) written(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending += n
+	if b.size > 0 && b.pending >= b.size {
+		b.flushLocked()
+		return
+	}
+	if b.delay > 0 && b.timer == nil {
+		b.timer = time.AfterFunc(b.delay, b.flush)
+	}
+}
+
+// flush flushes the current batch to the client.
+func (b *clientBatcher) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+}
+
+// flushLocked flushes the current batch to the client. b.mu must be held.
+func (b *clientBatcher) flushLocked() {
+	b.pending = 0
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.s.ctx.Err() != nil {
+		return
+	}
+	if err := b.s.flushClient(); err != nil {
+		b.s.logger.Debug("batched flush failed", "err", err)
+	}
+}
@@ -0,0 +1,406 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// forwardQueueSize is the maximum amount of jobs that may be queued by a forwarder if opts.AsyncProcessorWorkers
+// is set but opts.ForwardQueueSize is not.
+const forwardQueueSize = 256
+
+const (
+	// ForwardPolicyBlock stops reading from a connection while its forwarding queue is full.
+	ForwardPolicyBlock = "block"
+	// ForwardPolicyDrop drops droppable server packets while the forwarding queue is full, and blocks for all
+	// other packets.
+	ForwardPolicyDrop = "drop"
+	// ForwardPolicyDisconnect closes the session once a forwarding queue is full.
+	ForwardPolicyDisconnect = "disconnect"
+)
+
+// forwardLane is the kind of a job forwarded, which determines the queue it is written from and whether it may
+// be dropped.
+type forwardLane uint8
+
+const (
+	// laneBulk is the lane of regular packets, which are written in the order they were queued in.
+	laneBulk forwardLane = iota
+	// laneDroppable is the lane of regular packets that may be dropped if the queue is full and the forwarding
+	// queue policy is ForwardPolicyDrop.
+	laneDroppable
+	// laneControl is the lane of regular jobs that are never flushed by a job of laneFlush, such as client batches
+	// and cache updates, which are written in the order they were queued in.
+	laneControl
+	// lanePriority is the lane of latency-critical jobs, which are written before any queued regular jobs if
+	// opts.PriorityLanes is set.
+	lanePriority
+	// laneFlush is the lane of latency-critical jobs that make the packets queued before them obsolete, such as
+	// Disconnect and Transfer. If opts.PriorityLanes is set, they are written before any queued regular jobs, after
+	// the jobs of laneBulk and laneDroppable queued before them were flushed without being written.
+	laneFlush
+)
+
+// priorityServerPackets holds the IDs of the server packets that are written ahead of bulk traffic, such as
+// chunks, if opts.PriorityLanes is set.
+var priorityServerPackets = map[uint32]struct{}{
+	packet.IDCorrectPlayerMovePrediction: {},
+	packet.IDMovePlayer:                  {},
+}
+
+// flushServerPackets holds the IDs of the server packets that flush the bulk traffic queued before them and are
+// written ahead of it if opts.PriorityLanes is set, as the player leaves the server once they arrive.
+var flushServerPackets = map[uint32]struct{}{
+	packet.IDDisconnect: {},
+	packet.IDTransfer:   {},
+}
+
+// priorityClientPackets holds the IDs of the client packets that are written ahead of bulk traffic if
+// opts.PriorityLanes is set. A client batch is only written ahead if it consists of these packets only.
+var priorityClientPackets = map[uint32]struct{}{
+	packet.IDMovePlayer:      {},
+	packet.IDPlayerAuthInput: {},
+}
+
+// errForwardQueueFull is returned when a job is forwarded while the queue is full and the forwarding queue
+// policy is ForwardPolicyDisconnect.
+var errForwardQueueFull = errors.New("forwarding queue is full")
+
+// forwardJob is a single packet or batch queued by an asynchronous forwarder.
+type forwardJob struct {
+	process func()
+	write   func() error
+	lane    forwardLane
+	// seq is the sequence number of the job, which increases with every job queued.
+	seq uint64
+
+	err  error
+	done chan struct{}
+}
+
+// forwarder forwards packets in a single direction of a session. A job consists of running the processor's
+// hooks for the packets and writing them to the other side. When opts.AsyncProcessorWorkers is set, the hooks
+// of multiple jobs are run concurrently by a pool of workers, while the jobs are still written one by one in
+// the order they were queued in. When only opts.ForwardQueueSize is set, the hooks run on the goroutine that
+// forwards the jobs, which are then written by the forwarder. Otherwise, jobs are run and written on the
+// goroutine that forwards them.
+type forwarder struct {
+	s *Session
+	// forwarding is held while a job is written if the forwarder is asynchronous.
+	forwarding chan struct{}
+	// length is the gauge tracking the amount of jobs queued in this direction over all sessions.
+	length prometheus.Gauge
+
+	jobs    chan *forwardJob
+	pending chan *forwardJob
+	// priority holds the jobs of lanePriority and laneFlush if opts.PriorityLanes is set, which are written
+	// before the jobs in pending.
+	priority chan *forwardJob
+	seq      atomic.Uint64
+
+	// failed is closed once a job failed while forwarding asynchronously, after which err holds its error.
+	failed chan struct{}
+	err    error
+}
+
+// newForwarder creates a new forwarder for the session, starting its workers if opts.AsyncProcessorWorkers
+// is set. forwarding may be nil if writes do not need to be guarded. length is the gauge the amount of queued
+// jobs is reported to.
+func newForwarder(s *Session, forwarding chan struct{}, length prometheus.Gauge) *forwarder {
+	f := &forwarder{s: s, forwarding: forwarding, length: length}
+	size := s.opts.ForwardQueueSize
+	if size <= 0 {
+		if s.opts.AsyncProcessorWorkers <= 0 {
+			return f
+		}
+		size = forwardQueueSize
+	}
+
+	f.pending = make(chan *forwardJob, size)
+	if s.opts.PriorityLanes {
+		f.priority = make(chan *forwardJob, size)
+	}
+	f.failed = make(chan struct{})
+	if s.opts.AsyncProcessorWorkers > 0 {
+		f.jobs = make(chan *forwardJob, size)
+		for range s.opts.AsyncProcessorWorkers {
+			go f.work()
+		}
+	}
+	go f.writeJobs()
+	return f
+}
+
+// forward runs process, which may be nil, followed by write. If the forwarder is asynchronous, the job is
+// queued in laneControl and the error of an earlier job that failed is returned instead, as jobs are no longer
+// written after a job failed. If the queue is full, opts.ForwardQueuePolicy applies, which never drops the job.
+func (f *forwarder) forward(process func(), write func() error) error {
+	return f.forwardLane(laneControl, process, write)
+}
+
+// forwardLane forwards a job like forward in the lane passed. Jobs of laneDroppable are dropped without being
+// run if the queue is full and opts.ForwardQueuePolicy is ForwardPolicyDrop, and jobs of lanePriority and
+// laneFlush are written before queued jobs of the other lanes if opts.PriorityLanes is set.
+func (f *forwarder) forwardLane(lane forwardLane, process func(), write func() error) error {
+	if !f.async() {
+		if process != nil {
+			process()
+		}
+		return write()
+	}
+
+	select {
+	case <-f.failed:
+		// Jobs are no longer written once a job failed, so queueing the job would drop it silently.
+		return f.err
+	default:
+	}
+
+	job := &forwardJob{process: process, write: write, lane: lane, seq: f.seq.Add(1), done: make(chan struct{})}
+	if process == nil {
+		close(job.done)
+	}
+
+	queue := f.pending
+	if lane >= lanePriority && f.priority != nil {
+		queue = f.priority
+	}
+
+	select {
+	case queue <- job:
+	default:
+		switch f.s.opts.ForwardQueuePolicy {
+		case ForwardPolicyDrop:
+			if lane == laneDroppable {
+				f.s.countDroppedPacket()
+				return nil
+			}
+		case ForwardPolicyDisconnect:
+			return errForwardQueueFull
+		}
+
+		select {
+		case queue <- job:
+		case <-f.failed:
+			return f.err
+		case <-f.s.ctx.Done():
+			return context.Cause(f.s.ctx)
+		}
+	}
+	f.length.Inc()
+
+	select {
+	case <-f.failed:
+		// The writer stopped while the job was queued and may have drained the queue already, so the job would
+		// never be written nor removed from the queue.
+		f.drain()
+		return f.err
+	default:
+	}
+
+	if process != nil && f.jobs == nil {
+		f.run(job)
+	} else if process != nil {
+		select {
+		case f.jobs <- job:
+		case <-f.failed:
+			return f.err
+		case <-f.s.ctx.Done():
+			return context.Cause(f.s.ctx)
+		}
+	}
+	return nil
+}
+
+// work runs the processor hooks of queued jobs until the session is closed.
+func (f *forwarder) work() {
+	defer f.s.trackGoroutine()()
+	for {
+		select {
+		case job := <-f.jobs:
+			f.run(job)
+		case <-f.s.ctx.Done():
+			return
+		}
+	}
+}
+
+// run runs the processor hooks of the job, recovering from panics so that they close the session instead
+// of crashing the proxy.
+func (f *forwarder) run(job *forwardJob) {
+	defer close(job.done)
+	defer func() {
+		if r := recover(); r != nil {
+			job.err = fmt.Errorf("panic while processing packets: %v", r)
+		}
+	}()
+	job.process()
+}
+
+// writeJobs writes the queued jobs in the order they were queued in, waiting for the processor hooks of each
+// job to finish first. Queued jobs of lanePriority and laneFlush are written before all other queued jobs. It
+// stops after the first job that fails or once the session is closed.
+func (f *forwarder) writeJobs() {
+	defer f.s.trackGoroutine()()
+	defer f.drain()
+	// held is a regular job taken from the queue while flushing that was queued after the job of laneFlush.
+	var held *forwardJob
+	for {
+		var job *forwardJob
+		select {
+		case job = <-f.priority:
+			f.length.Dec()
+		default:
+			if job, held = held, nil; job == nil {
+				select {
+				case job = <-f.priority:
+				case job = <-f.pending:
+				case <-f.s.ctx.Done():
+					return
+				}
+				f.length.Dec()
+			}
+		}
+
+		if job.lane == laneFlush && f.priority != nil {
+			var ok bool
+			if held, ok = f.flush(job, held); !ok {
+				return
+			}
+		}
+		if !f.write(job) {
+			return
+		}
+	}
+}
+
+// flush flushes the regular jobs queued before the job of laneFlush passed, starting with held if it is not nil.
+// Jobs of laneBulk and laneDroppable are discarded without being written, while jobs of laneControl are written.
+// It returns the first job taken from the queue that was queued after the job passed, if any, and false if a job
+// failed or the session was closed.
+func (f *forwarder) flush(before *forwardJob, held *forwardJob) (*forwardJob, bool) {
+	for {
+		job := held
+		held = nil
+		if job == nil {
+			select {
+			case job = <-f.pending:
+				f.length.Dec()
+			default:
+				return nil, true
+			}
+		}
+
+		if job.seq > before.seq {
+			return job, true
+		}
+		if job.lane == laneControl {
+			if !f.write(job) {
+				return nil, false
+			}
+			continue
+		}
+		f.s.countDroppedPacket()
+	}
+}
+
+// write waits for the processor hooks of the job to finish and writes it, returning false if the job failed
+// or the session was closed.
+func (f *forwarder) write(job *forwardJob) bool {
+	select {
+	case <-job.done:
+	case <-f.s.ctx.Done():
+		return false
+	}
+
+	err := job.err
+	if err == nil {
+		f.acquire()
+		err = job.write()
+		f.release()
+	}
+
+	if err != nil {
+		f.err = err
+		close(f.failed)
+		return false
+	}
+	return true
+}
+
+// drain discards the jobs that are still queued once the forwarder stopped writing, so that they are no longer
+// reported as queued. It is called by the writer when it stops, and by forwardLane for jobs queued concurrently.
+func (f *forwarder) drain() {
+	for {
+		select {
+		case <-f.priority:
+			f.length.Dec()
+		case <-f.pending:
+			f.length.Dec()
+		default:
+			return
+		}
+	}
+}
+
+// async returns whether the forwarder writes jobs asynchronously.
+func (f *forwarder) async() bool {
+	return f.pending != nil
+}
+
+// queued returns the amount of jobs that were queued but not yet written.
+func (f *forwarder) queued() int {
+	if !f.async() {
+		return 0
+	}
+	return len(f.pending) + len(f.priority)
+}
+
+// acquire acquires the forwarding semaphore of the forwarder, if it has one.
+func (f *forwarder) acquire() {
+	if f.forwarding != nil {
+		f.forwarding <- struct{}{}
+	}
+}
+
+// release releases the forwarding semaphore of the forwarder, if it has one.
+func (f *forwarder) release() {
+	if f.forwarding != nil {
+		<-f.forwarding
+	}
+}
+
+// serverLane returns the lane the server packet with the ID passed is forwarded in.
+func (s *Session) serverLane(id uint32) forwardLane {
+	if _, ok := flushServerPackets[id]; ok && s.opts.PriorityLanes {
+		return laneFlush
+	}
+	if _, ok := priorityServerPackets[id]; ok && s.opts.PriorityLanes {
+		return lanePriority
+	}
+	if _, ok := s.opts.DroppablePackets[id]; ok {
+		return laneDroppable
+	}
+	return laneBulk
+}
+
+// clientLane returns the lane the client batch holding the payloads passed is forwarded in. Batches are only
+// written ahead of others if all of their packets are movement or input.
+func (s *Session) clientLane(payloads [][]byte) forwardLane {
+	if !s.opts.PriorityLanes || len(payloads) == 0 {
+		return laneControl
+	}
+
+	for _, payload := range payloads {
+		id, ok := rawPacketID(payload)
+		if _, priority := priorityClientPackets[id]; !ok || !priority {
+			return laneControl
+		}
+	}
+	return lanePriority
+}
@@ -0,0 +1,69 @@
+package session
+
+import (
+	"slices"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// gameDataUpdates returns the packets that update a client holding the game data current to the game data target,
+// such as the game data of a server the client is transferring to. Only the values that differ are updated.
+func gameDataUpdates(current, target minecraft.GameData) []packet.Packet {
+	var pks []packet.Packet
+	if current.Difficulty != target.Difficulty {
+		pks = append(pks, &packet.SetDifficulty{Difficulty: uint32(target.Difficulty)})
+	}
+	if current.WorldGameMode != target.WorldGameMode {
+		pks = append(pks, &packet.SetDefaultGameType{GameType: target.WorldGameMode})
+	}
+	if current.PlayerGameMode != target.PlayerGameMode {
+		pks = append(pks, &packet.SetPlayerGameType{GameType: target.PlayerGameMode})
+	}
+	if current.Time != target.Time {
+		pks = append(pks, &packet.SetTime{Time: int32(target.Time)})
+	}
+	if rules := changedGameRules(current.GameRules, target.GameRules); len(rules) > 0 {
+		pks = append(pks, &packet.GameRulesChanged{GameRules: rules})
+	}
+	return pks
+}
+
+// changedGameRules returns the game rules of target that are missing from current or have a different value.
+func changedGameRules(current, target []protocol.GameRule) []protocol.GameRule {
+	var changed []protocol.GameRule
+	for _, rule := range target {
+		i := slices.IndexFunc(current, func(r protocol.GameRule) bool {
+			return r.Name == rule.Name
+		})
+		if i == -1 || current[i].Value != rule.Value || current[i].CanBeModifiedByPlayer != rule.CanBeModifiedByPlayer {
+			changed = append(changed, rule)
+		}
+	}
+	return changed
+}
+
+// mergeGameRules returns the game rules of current with the rules passed replacing those with the same name.
+func mergeGameRules(current, rules []protocol.GameRule) []protocol.GameRule {
+	merged := slices.Clone(current)
+	for _, rule := range rules {
+		i := slices.IndexFunc(merged, func(r protocol.GameRule) bool {
+			return r.Name == rule.Name
+		})
+		if i == -1 {
+			merged = append(merged, rule)
+		} else {
+			merged[i] = rule
+		}
+	}
+	return merged
+}
+
+// experimentsDiffer returns whether the experiments of two game data differ. Experiments cannot be changed after
+// StartGame, so a client transferring between servers with different experiments keeps those of its first server.
+func experimentsDiffer(a, b []protocol.ExperimentData) bool {
+	return !slices.EqualFunc(a, b, func(x, y protocol.ExperimentData) bool {
+		return x.Name == y.Name && x.Enabled == y.Enabled
+	})
+}
@@ -1,20 +1,25 @@
 package session
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/cooldogedev/spectrum/metrics"
 	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
-	"github.com/sandertv/gophertunnel/minecraft"
-	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 )
 
 // handleServer continuously reads packets from the server and forwards them to the client.
 func handleServer(s *Session) {
+	defer s.trackGoroutine()()
+	forwarder := newForwarder(s, nil, metrics.ServerForwardQueue)
+	s.serverForwarder.Store(forwarder)
+	var batch *serverBatch
+	if s.opts.BatchServerPackets {
+		batch = &serverBatch{s: s, forwarder: forwarder}
+	}
 loop:
 	for {
 		select {
@@ -24,7 +29,11 @@ loop:
 		default:
 		}
 
-		server := s.Server()
+		if spawn := s.pendingSpawn.Swap(nil); spawn != nil {
+			(*spawn)()
+		}
+
+		server, client := s.Server(), s.Client()
 		pk, err := server.ReadPacket()
 		if err != nil {
 			if server != s.Server() {
@@ -41,72 +50,206 @@ loop:
 
 		switch pk := pk.(type) {
 		case *spectrumpacket.Flush:
-			ctx := NewContext()
-			s.Processor().ProcessFlush(ctx)
-			if ctx.Cancelled() {
-				continue loop
+			if err = batch.forward(); err != nil {
+				break
 			}
 
-			if err := s.client.Flush(); err != nil {
-				s.CloseWithError(fmt.Errorf("failed to flush client's buffer: %w", err))
-				logError(s, "failed to flush client's buffer", err)
-				break loop
-			}
+			ctx := NewContext()
+			err = forwarder.forward(func() {
+				s.hooks().ProcessFlush(ctx)
+			}, func() error {
+				if ctx.Cancelled() {
+					return nil
+				}
+				if s.flusher != nil {
+					s.flusher.request()
+					return nil
+				}
+				if s.batcher != nil {
+					s.batcher.flush()
+					return nil
+				}
+				return s.flushClient()
+			})
 		case *spectrumpacket.Latency:
 			s.latency.Store(pk.Latency)
 		case *spectrumpacket.Transfer:
-			if err := s.Transfer(pk.Addr); err != nil {
-				logError(s, "failed to transfer", err)
+			if err = batch.forward(); err != nil {
+				break
 			}
+			err = forwarder.forwardLane(laneFlush, nil, func() error {
+				if err := s.TransferPayload(pk.Addr, pk.Payload); err != nil {
+					logError(s, "failed to transfer", err)
+				}
+				return nil
+			})
+		case *spectrumpacket.CachedRegistry:
+			if err = batch.forward(); err != nil {
+				break
+			}
+			err = forwarder.forward(nil, func() error {
+				return s.writeCachedRegistry(pk)
+			})
 		case *spectrumpacket.UpdateCache:
-			s.SetCache(pk.Cache)
+			if err = batch.forward(); err != nil {
+				break
+			}
+			err = forwarder.forward(nil, func() error {
+				s.updateCache(pk)
+				return nil
+			})
 		case packet.Packet:
-			ctx := NewPacketContext(nil, pk)
-			s.Processor().ProcessServer(ctx)
-			if ctx.Cancelled() {
+			s.logPacket("server", pk.ID(), 0)
+			s.countPacket(false, pk.ID(), 0)
+			if !s.filter(false, pk.ID(), pk, false) {
 				continue loop
 			}
+			if batch != nil {
+				err = batch.add(NewPacketContext(nil, pk))
+				break
+			}
+
+			var ctx *PacketContext
+			if subscribed(s.processorSubscriptions().server, pk.ID()) {
+				ctx = NewPacketContext(nil, pk)
+			}
 
-			if s.opts.SyncProtocol {
-				for _, latest := range s.client.Proto().ConvertToLatest(pk, s.client) {
-					s.tracker.handlePacket(latest)
+			err = forwarder.forwardLane(s.serverLane(pk.ID()), processServer(s, ctx), func() error {
+				if ctx != nil {
+					defer ReturnPacketContext(ctx)
+					if ctx.Cancelled() {
+						return nil
+					}
+					pk = ctx.Packet()
 				}
-			} else {
-				s.tracker.handlePacket(pk)
+				return writeServerPacket(s, ctx, pk)
+			})
+		case []byte:
+			s.logRawPacket("server", pk)
+			s.countRawPacket(false, pk)
+			id, ok := rawPacketID(pk)
+			if ok && !s.filter(false, id, nil, false) {
+				continue loop
 			}
-			if err := s.client.WritePacket(pk); err != nil {
-				s.CloseWithError(fmt.Errorf("failed to write packet to client: %w", err))
-				logError(s, "failed to write packet to client", err)
-				break loop
+			if batch != nil {
+				err = batch.add(NewPacketContext(pk, nil))
+				break
 			}
-		case []byte:
-			ctx := NewPacketContext(pk, nil)
-			s.Processor().ProcessServer(ctx)
-			if ctx.Cancelled() {
+
+			var ctx *PacketContext
+			if subscribedRaw(s.processorSubscriptions().server, pk) {
+				ctx = NewPacketContext(pk, nil)
+			}
+
+			lane := laneBulk
+			if ok {
+				lane = s.serverLane(id)
+			}
+
+			err = forwarder.forwardLane(lane, processServer(s, ctx), func() error {
+				if ctx != nil {
+					defer ReturnPacketContext(ctx)
+					if ctx.Cancelled() {
+						return nil
+					}
+				}
+				return writeServerPayload(s, ctx, pk)
+			})
+		}
+
+		if err != nil {
+			if s.awaitResume(client) {
 				continue loop
 			}
+			s.CloseWithError(err)
+			logError(s, "failed to forward packet to client", err)
+			break loop
+		}
+	}
+}
 
-			if _, err := s.client.Write(pk); err != nil {
-				s.CloseWithError(fmt.Errorf("failed to write packet to client: %w", err))
-				logError(s, "failed to write packet to client", err)
-				break loop
+// writeServerPacket writes a packet sent by the server to the client, translating its entity IDs and passing it
+// to the tracker first. ctx may be nil if the processor did not subscribe to the packet.
+func writeServerPacket(s *Session, ctx *PacketContext, pk packet.Packet) error {
+	if s.entities != nil {
+		s.entities.toClient(pk)
+	}
+	if registry, ok := pk.(*packet.ItemRegistry); ok {
+		s.shieldID.Store(shieldID(registry.Items))
+	}
+	if !s.opts.DisableTracker {
+		dimension := s.tracker.Dimension()
+		if s.opts.SyncProtocol {
+			for _, latest := range s.Client().Proto().ConvertToLatest(pk, s.Client()) {
+				s.tracker.handlePacket(latest)
 			}
+		} else {
+			s.tracker.handlePacket(pk)
+		}
+		if changed := s.tracker.Dimension(); changed != dimension {
+			s.hooks().ProcessDimensionChange(NewContext(), dimension, changed)
 		}
 	}
+	start := time.Now()
+	if err := s.Client().WritePacket(pk); err != nil {
+		return fmt.Errorf("failed to write packet to client: %w", err)
+	}
+	if s.batcher != nil {
+		s.batcher.written(0)
+	}
+	s.countServerPacket()
+	processServerSent(s, ctx, time.Since(start))
+	return nil
 }
 
-// handleClient continuously reads packets from the client and forwards them to the server.
-func handleClient(s *Session) {
-	header := &packet.Header{}
-	pool := s.client.Proto().Packets(true)
-	var shieldID int32
-	for _, item := range s.client.GameData().Items {
-		if item.Name == "minecraft:shield" {
-			shieldID = int32(item.RuntimeID)
-			break
+// writeServerPayload writes the raw payload of a packet sent by the server to the client, or the packet the
+// processor replaced it with. ctx may be nil if the processor did not subscribe to the packet.
+func writeServerPayload(s *Session, ctx *PacketContext, payload []byte) error {
+	var err error
+	start := time.Now()
+	if ctx != nil && ctx.Packet() != nil {
+		err = s.Client().WritePacket(ctx.Packet())
+	} else {
+		_, err = s.Client().Write(payload)
+		if err == nil && s.registries != nil {
+			s.registries.store(payload)
 		}
 	}
+	if err != nil {
+		return fmt.Errorf("failed to write packet to client: %w", err)
+	}
+	if s.batcher != nil {
+		s.batcher.written(len(payload))
+	}
+	s.countServerPacket()
+	processServerSent(s, ctx, time.Since(start))
+	return nil
+}
+
+// processServer returns a function passing the context to the processor's ProcessServer hook, or nil if
+// the context is nil because the processor did not subscribe to the packet.
+func processServer(s *Session, ctx *PacketContext) func() {
+	if ctx == nil {
+		return nil
+	}
+	return func() {
+		s.hooks().ProcessServer(ctx)
+	}
+}
 
+// processServerSent passes the context of a server packet that was written to the client to the processor's
+// ProcessServerSent hook, unless the context is nil or the processor did not subscribe to the packet.
+func processServerSent(s *Session, ctx *PacketContext, latency time.Duration) {
+	if ctx != nil && subscribedServer(s.processorSubscriptions().server, ctx) {
+		s.hooks().ProcessServerSent(ctx, latency)
+	}
+}
+
+// handleClient continuously reads packets from the client and forwards them to the server.
+func handleClient(s *Session) {
+	defer s.trackGoroutine()()
+	pipeline := newClientPipeline(s)
+	s.clientForwarder.Store(pipeline.forwarder)
 loop:
 	for {
 		select {
@@ -116,18 +259,33 @@ loop:
 		default:
 		}
 
-		payloads, err := s.client.ReadBatchBytes()
+		client := s.Client()
+		payloads, err := client.ReadBatchBytes()
 		if err != nil {
+			if s.detach(client) {
+				// The client reattaches with a new connection, for which Reattach starts a new handleClient.
+				break loop
+			}
 			s.CloseWithError(fmt.Errorf("failed to read packet from client: %w", err))
 			logError(s, "failed to read packet from client", err)
 			break loop
 		}
-		/* for _, payload := range payloads {
-			if err := handleClientPacketLegacy(s, header, pool, shieldID, payload); err != nil {
-				s.Server().CloseWithError(fmt.Errorf("failed to write packet to server: %w", err))
+		if observer := s.batchObserver.Load(); observer != nil {
+			observer.observe(compressedBatches.take(payloads))
+		}
+
+		var size int
+		for _, payload := range payloads {
+			size += len(payload)
+		}
+		s.bandwidth.clientBytes.Add(uint64(size))
+		if s.clientThrottle != nil {
+			if err := s.clientThrottle.wait(s.ctx, size); err != nil {
+				s.CloseWithError(err)
+				break loop
 			}
-		} */
-		if err := handleClientBatch(s, header, pool, shieldID, payloads); err != nil {
+		}
+		if err := pipeline.handle(payloads); err != nil {
 			s.Server().CloseWithError(fmt.Errorf("failed to write packet to server: %w", err))
 			logError(s, "failed to write packet to server", err)
 			break loop
@@ -137,8 +295,10 @@ loop:
 
 // handleLatency periodically sends the client's current ping and timestamp to the server for latency reporting.
 // The client's latency is derived from half of RakNet's round-trip time (RTT).
-// To calculate the total latency, we multiply this value by 2.
+// To calculate the total latency, we multiply this value by opts.LatencyMultiplier, which defaults to 2.
+// The processor's ProcessLatency hook may adjust or skip every report.
 func handleLatency(s *Session, interval int64) {
+	defer s.trackGoroutine()()
 	ticker := time.NewTicker(time.Millisecond * time.Duration(interval))
 	defer ticker.Stop()
 loop:
@@ -148,112 +308,42 @@ loop:
 			s.CloseWithError(context.Cause(s.ctx))
 			break loop
 		case <-ticker.C:
-			if err := s.Server().WritePacket(&spectrumpacket.Latency{Latency: s.client.Latency().Milliseconds() * 2, Timestamp: time.Now().UnixMilli()}); err != nil {
-				logError(s, "failed to write latency packet", err)
+			latency, timestamp := s.clientLatency(), time.Now().UnixMilli()
+			ctx := NewContext()
+			s.hooks().ProcessLatency(ctx, &latency, &timestamp)
+			if ctx.Cancelled() {
+				continue loop
 			}
-		}
-	}
-}
-
-func handleClientBatch(s *Session, header *packet.Header, pool packet.Pool, shieldID int32, payloads [][]byte) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("panic while handling batch: %v", r)
-		}
-	}()
-
-	ctxBatch := make([]*PacketContext, 0, len(payloads))
-	for _, payload := range payloads {
-		ctx, err := decodeAndCreateContext(s, header, pool, shieldID, payload)
-		if err != nil {
-			return err
-		} else if ctx == nil {
-			continue
-		}
-		ctxBatch = append(ctxBatch, ctx)
-	}
-
-	s.Processor().ProcessClient(ctxBatch)
-	var (
-		proto        minecraft.Protocol
-		payloadBatch = make([][]byte, 0, len(ctxBatch))
-	)
-
-	if s.opts.SyncProtocol {
-		proto = s.client.Proto()
-	} else {
-		proto = minecraft.DefaultProtocol
-	}
-	for _, ctx := range ctxBatch {
-		if ctx.Cancelled() {
-			ReturnPacketContext(ctx)
-			continue
-		}
 
-		if (ctx.decoded == nil || !ctx.Modified()) && s.client.Proto().ID() == protocol.CurrentProtocol {
-			payloadBatch = append(payloadBatch, ctx.raw)
-			ReturnPacketContext(ctx)
-			continue
+			if err := s.Server().WritePacket(&spectrumpacket.Latency{Latency: latency, Timestamp: timestamp}); err != nil {
+				logError(s, "failed to write latency packet", err)
+			}
 		}
-
-		// If the packet was modified, we have to re-encode the packet, and then append that to the payload batch.
-		newPkBuf := bytes.NewBuffer(nil)
-		w := proto.NewWriter(newPkBuf, shieldID)
-		header.PacketID = ctx.decoded.ID()
-		_ = header.Write(newPkBuf)
-		ctx.decoded.Marshal(w)
-		payloadBatch = append(payloadBatch, newPkBuf.Bytes())
 	}
-	return s.Server().WriteBatch(payloadBatch)
 }
 
-// decodeAndCreateContext decodes a client packet and either returns packet.Packet if decode is specified, or a byte slice if decode is not needed. It also will
-// return any errors that occur while decoding this packet. If SyncProtocol is disabled and the session needs packets to be upgraded, we've made the assumption that
-// only the first packet from the upgraded array needs to be handled, as there aren't any cases known yet where it's actually neccessary for the client specifically.
-// If the client is not on the latest version and SyncProtocol is disabled, we will not ever allow for a packet to not be decoded and pass through raw. This is because
-// forwarding a raw legacy packet to a downstream likely equipped without multi-version support would lead to decoding errors.
-func decodeAndCreateContext(s *Session, header *packet.Header, pool packet.Pool, shieldID int32, payload []byte) (ctx *PacketContext, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("panic while decoding packet from client batch: %v", r)
-		}
-	}()
-
-	buf := bytes.NewBuffer(payload)
-	if err := header.Read(buf); err != nil {
-		return nil, errors.New("failed to decode header")
+// handleDecodeFailure handles a client packet that failed to decode. If opts.ProtocolMismatchThreshold is not set,
+// the error is returned as is. Otherwise, the packet is dropped and ProcessProtocolMismatch is called once the
+// threshold is reached, returning an error to disconnect the session unless the processor cancels the context.
+func handleDecodeFailure(s *Session, err error) error {
+	s.countDecodeError()
+	if s.opts.ProtocolMismatchThreshold <= 0 {
+		return err
 	}
 
-	pkFunc, ok := pool[header.PacketID]
-	if !ok {
-		return nil, fmt.Errorf("unknown packet with id %d", header.PacketID)
+	s.decodeFailures++
+	s.logger.Debug("failed to decode client packet", "failures", s.decodeFailures, "err", err)
+	if s.decodeFailures < s.opts.ProtocolMismatchThreshold {
+		return nil
 	}
 
-	// If SyncProtocol is disabled, and the client is not on the latest version, we need to decode the packet. If we don't, this can lead to
-	// issues where we forward a legacy version packet to the downstream server, resulting in decoding errors.
-	isClientLatestVersion := s.client.Proto().ID() == protocol.CurrentProtocol
-	if !s.opts.EnableAllClientDecode {
-		if _, ok := s.opts.ClientDecode[header.PacketID]; !ok && (s.opts.SyncProtocol || isClientLatestVersion) {
-			return NewPacketContext(payload, nil), nil
-		}
-	}
-
-	decodedPk := pkFunc()
-	decodedPk.Marshal(s.client.Proto().NewReader(buf, shieldID, true))
-	if extra := buf.Len(); extra > 0 {
-		return nil, fmt.Errorf("%T had an extra %d bytes", decodedPk, extra)
-	}
-
-	// If we are not using SyncProtocol, we should upgrade the packet to the latest version. For now, we will ignore extra packets
-	// returned by the protocol library as there aren't any packets that require it at the moment.
-	if !s.opts.SyncProtocol && !isClientLatestVersion {
-		upgraded := s.client.Proto().ConvertToLatest(decodedPk, s.client)
-		if len(upgraded) == 0 {
-			return nil, nil
-		}
-		return NewPacketContext(payload, upgraded[0]), nil
+	ctx := NewContext()
+	s.hooks().ProcessProtocolMismatch(ctx, s.decodeFailures, err)
+	if ctx.Cancelled() {
+		s.decodeFailures = 0
+		return nil
 	}
-	return NewPacketContext(payload, decodedPk), nil
+	return fmt.Errorf("protocol mismatch after %d decode failures: %w", s.decodeFailures, err)
 }
 
 func logError(s *Session, msg string, err error) {
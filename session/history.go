@@ -0,0 +1,20 @@
+package session
+
+import "time"
+
+// maxTransferHistory is the maximum amount of transfer records kept per session. Older records are discarded first.
+const maxTransferHistory = 32
+
+// TransferRecord describes a completed server change of a session.
+type TransferRecord struct {
+	// Origin is the address of the server the session was transferred from.
+	Origin string
+	// Target is the address of the server the session was transferred to.
+	Target string
+	// Fallback is whether the server change was caused by a fallback rather than a requested transfer.
+	Fallback bool
+	// Time is the time at which the session finished spawning on the target server.
+	Time time.Time
+	// Duration is the amount of time the session spent on the origin server.
+	Duration time.Duration
+}
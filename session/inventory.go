@@ -0,0 +1,155 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/cooldogedev/spectrum/util"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// inventoryPackets holds the IDs of the client packets that are decoded to be checked if opts.InventoryChecks is
+// set.
+var inventoryPackets = map[uint32]struct{}{
+	packet.IDInventoryTransaction: {},
+	packet.IDItemStackRequest:     {},
+}
+
+var stackRequestSlotInfoType = reflect.TypeFor[protocol.StackRequestSlotInfo]()
+
+// checkInventory checks the inventory transactions and item stack requests of the batch against
+// opts.InventoryChecks. Packets failing the checks are dropped, or the session is closed if the action of the
+// checks is ValidationDisconnect.
+func checkInventory(p *clientPipeline, batch []*PacketContext) ([]*PacketContext, error) {
+	limits := p.s.opts.InventoryChecks
+	if !limits.Enabled() {
+		return batch, nil
+	}
+
+	kept := batch[:0]
+	for _, ctx := range batch {
+		var err error
+		switch pk := ctx.decoded.(type) {
+		case *packet.InventoryTransaction:
+			err = checkInventoryTransaction(limits, pk)
+		case *packet.ItemStackRequest:
+			err = p.checkItemStackRequest(limits, pk)
+		}
+		if err == nil {
+			kept = append(kept, ctx)
+			continue
+		}
+
+		ReturnPacketContext(ctx)
+		p.s.countInventoryReject()
+		if limits.Action == ValidationDisconnect {
+			err = fmt.Errorf("invalid inventory packet: %w", err)
+			p.s.CloseWithError(err)
+			return nil, err
+		}
+		p.s.logger.Debug("dropped invalid inventory packet", "err", err)
+	}
+	return kept, nil
+}
+
+// checkInventoryTransaction checks the amount of actions of an inventory transaction and the slots they refer to.
+func checkInventoryTransaction(limits util.InventoryLimits, pk *packet.InventoryTransaction) error {
+	if limits.MaxActions > 0 && len(pk.Actions) > limits.MaxActions {
+		return fmt.Errorf("inventory transaction with %d actions, maximum is %d", len(pk.Actions), limits.MaxActions)
+	}
+	if limits.MaxSlot <= 0 {
+		return nil
+	}
+
+	for _, action := range pk.Actions {
+		if action.InventorySlot > uint32(limits.MaxSlot) {
+			return fmt.Errorf("inventory action on slot %d, maximum is %d", action.InventorySlot, limits.MaxSlot)
+		}
+	}
+	for _, slots := range pk.LegacySetItemSlots {
+		for _, slot := range slots.Slots {
+			if int(slot) > limits.MaxSlot {
+				return fmt.Errorf("legacy set item slot %d, maximum is %d", slot, limits.MaxSlot)
+			}
+		}
+	}
+
+	var hotBarSlot int32
+	switch data := pk.TransactionData.(type) {
+	case *protocol.UseItemTransactionData:
+		hotBarSlot = data.HotBarSlot
+	case *protocol.UseItemOnEntityTransactionData:
+		hotBarSlot = data.HotBarSlot
+	case *protocol.ReleaseItemTransactionData:
+		hotBarSlot = data.HotBarSlot
+	}
+	if hotBarSlot < 0 || int(hotBarSlot) > limits.MaxSlot {
+		return fmt.Errorf("transaction on hot bar slot %d, maximum is %d", hotBarSlot, limits.MaxSlot)
+	}
+	return nil
+}
+
+// checkItemStackRequest checks the amount of requests of an ItemStackRequest packet, the amount of actions of every
+// request, the slots they refer to and, if limits.RequestOrder is set, whether the request IDs keep decreasing. The
+// last request ID is only updated if the packet passes the checks.
+func (p *clientPipeline) checkItemStackRequest(limits util.InventoryLimits, pk *packet.ItemStackRequest) error {
+	if limits.MaxRequests > 0 && len(pk.Requests) > limits.MaxRequests {
+		return fmt.Errorf("%d item stack requests, maximum is %d", len(pk.Requests), limits.MaxRequests)
+	}
+
+	last, hasLast := p.lastRequestID, p.hasRequestID
+	for _, request := range pk.Requests {
+		if limits.RequestOrder {
+			if hasLast && request.RequestID >= last {
+				return fmt.Errorf("item stack request id %d does not follow %d", request.RequestID, last)
+			}
+			last, hasLast = request.RequestID, true
+		}
+
+		if limits.MaxActions > 0 && len(request.Actions) > limits.MaxActions {
+			return fmt.Errorf("item stack request with %d actions, maximum is %d", len(request.Actions), limits.MaxActions)
+		}
+		if limits.MaxSlot <= 0 {
+			continue
+		}
+		for _, action := range request.Actions {
+			if err := checkStackRequestSlots(limits, reflect.ValueOf(action)); err != nil {
+				return err
+			}
+		}
+	}
+	p.lastRequestID, p.hasRequestID = last, hasLast
+	return nil
+}
+
+// checkStackRequestSlots checks the slots of the StackRequestSlotInfo fields of an item stack request action. The
+// fields are found using reflection, as the actions referring to slots share them through unexported types.
+func checkStackRequestSlots(limits util.InventoryLimits, v reflect.Value) error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return errors.New("nil item stack request action")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := range v.NumField() {
+		field := v.Field(i)
+		switch {
+		case field.Type() == stackRequestSlotInfoType:
+			if slot := field.FieldByName("Slot").Uint(); slot > uint64(limits.MaxSlot) {
+				return fmt.Errorf("item stack request action on slot %d, maximum is %d", slot, limits.MaxSlot)
+			}
+		case field.Kind() == reflect.Struct:
+			// Embedded structs, such as the one shared by the take, place and swap actions, hold the slots.
+			if err := checkStackRequestSlots(limits, field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"sync/atomic"
+
+	"github.com/cooldogedev/spectrum/metrics"
+)
+
+// SessionMetrics holds the counters of a single session. The same counters are aggregated over all sessions
+// in the metrics package.
+type SessionMetrics struct {
+	// ClientPacketsForwarded is the amount of packets sent by the client that were forwarded to servers.
+	ClientPacketsForwarded uint64
+	// ServerPacketsForwarded is the amount of packets sent by servers that were forwarded to the client.
+	ServerPacketsForwarded uint64
+	// Transfers is the amount of transfers that completed successfully.
+	Transfers uint64
+	// TransferFailures is the amount of transfers that failed.
+	TransferFailures uint64
+	// DecodeErrors is the amount of client packets that failed to decode.
+	DecodeErrors uint64
+	// Fallbacks is the amount of times the session fell back to another server after losing its server.
+	Fallbacks uint64
+	// PacketsDropped is the amount of server packets that were dropped because the forwarding queue was full.
+	PacketsDropped uint64
+	// ValidationFailures is the amount of client packets that violated the validation limits.
+	ValidationFailures uint64
+	// InventoryRejects is the amount of client inventory packets that failed the inventory checks.
+	InventoryRejects uint64
+}
+
+// sessionMetrics holds the counters returned by Session.Metrics.
+type sessionMetrics struct {
+	clientPacketsForwarded atomic.Uint64
+	serverPacketsForwarded atomic.Uint64
+	transfers              atomic.Uint64
+	transferFailures       atomic.Uint64
+	decodeErrors           atomic.Uint64
+	fallbacks              atomic.Uint64
+	packetsDropped         atomic.Uint64
+	validationFailures     atomic.Uint64
+	inventoryRejects       atomic.Uint64
+}
+
+// Metrics returns a snapshot of the counters of the session.
+func (s *Session) Metrics() SessionMetrics {
+	return SessionMetrics{
+		ClientPacketsForwarded: s.metrics.clientPacketsForwarded.Load(),
+		ServerPacketsForwarded: s.metrics.serverPacketsForwarded.Load(),
+		Transfers:              s.metrics.transfers.Load(),
+		TransferFailures:       s.metrics.transferFailures.Load(),
+		DecodeErrors:           s.metrics.decodeErrors.Load(),
+		Fallbacks:              s.metrics.fallbacks.Load(),
+		PacketsDropped:         s.metrics.packetsDropped.Load(),
+		ValidationFailures:     s.metrics.validationFailures.Load(),
+		InventoryRejects:       s.metrics.inventoryRejects.Load(),
+	}
+}
+
+// countClientBatch counts a batch of client packets that was forwarded to the server.
+func (s *Session) countClientBatch(n int) {
+	s.metrics.clientPacketsForwarded.Add(uint64(n))
+	metrics.ClientPacketsForwarded.Add(float64(n))
+	metrics.ClientBatchSize.Observe(float64(n))
+}
+
+// countServerPacket counts a server packet that was forwarded to the client.
+func (s *Session) countServerPacket() {
+	s.metrics.serverPacketsForwarded.Add(1)
+	metrics.ServerPacketsForwarded.Inc()
+}
+
+// countTransfer counts a transfer that completed successfully.
+func (s *Session) countTransfer() {
+	s.metrics.transfers.Add(1)
+	metrics.Transfers.Inc()
+}
+
+// countTransferFailure counts a transfer that failed.
+func (s *Session) countTransferFailure() {
+	s.metrics.transferFailures.Add(1)
+	metrics.TransferFailures.Inc()
+}
+
+// countDecodeError counts a client packet that failed to decode.
+func (s *Session) countDecodeError() {
+	s.metrics.decodeErrors.Add(1)
+	metrics.DecodeErrors.Inc()
+}
+
+// countFallback counts a fallback of the session.
+func (s *Session) countFallback() {
+	s.metrics.fallbacks.Add(1)
+	metrics.Fallbacks.Inc()
+}
+
+// countDroppedPacket counts a server packet that was dropped because the forwarding queue was full.
+func (s *Session) countDroppedPacket() {
+	s.metrics.packetsDropped.Add(1)
+	metrics.PacketsDropped.Inc()
+}
+
+// countValidationFailure counts a client packet that violated the validation limits.
+func (s *Session) countValidationFailure() {
+	s.metrics.validationFailures.Add(1)
+	metrics.ValidationFailures.Inc()
+}
+
+// countInventoryReject counts a client inventory packet that failed the inventory checks.
+func (s *Session) countInventoryReject() {
+	s.metrics.inventoryRejects.Add(1)
+	metrics.InventoryRejects.Inc()
+}
@@ -0,0 +1,198 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
+)
+
+const (
+	// migrationTimeout is the maximum duration storing or taking the state of a migrated session may take.
+	migrationTimeout = 5 * time.Second
+	// defaultMigrationTTL is the duration states of migrated sessions are kept for if opts.MigrationTTL is zero.
+	defaultMigrationTTL = 30 * time.Second
+)
+
+// MigrationState is the state of a session handed over from one proxy to another using Session.Migrate. The
+// proxy the client reconnects to resumes the session from it, connecting the client to the same server with the
+// same cache instead of discovering a new server.
+type MigrationState struct {
+	// XUID is the XUID of the player the state belongs to, under which it is stored.
+	XUID string `json:"xuid"`
+	// Token uniquely identifies the migration. The proxy resuming the state remembers it until the state expires,
+	// so that a state is only ever resumed once, and it is logged by both proxies so that a handover can be traced.
+	Token string `json:"token"`
+	// Target is the address of the proxy the session was migrated to, which the client reports connecting to when
+	// it reconnects. Other proxies do not resume the state.
+	Target string `json:"target"`
+	// Server is the address of the server the session was connected to.
+	Server string `json:"server"`
+	// Cache is the cache of the session, which is sent to the server again.
+	Cache []byte `json:"cache"`
+	// CacheVersion is the version of the cache.
+	CacheVersion uint64 `json:"cache_version"`
+	// CacheCompressed specifies whether Cache is compressed using zstd.
+	CacheCompressed bool `json:"cache_compressed"`
+	// CacheSlots holds the named cache slots of the session.
+	CacheSlots []spectrumpacket.CacheSlot `json:"cache_slots"`
+	// Created is the time the session was migrated at in Unix milliseconds.
+	Created int64 `json:"created"`
+	// Expires is the time in Unix milliseconds after which the state is no longer resumed, even if the store still
+	// holds it.
+	Expires int64 `json:"expires"`
+}
+
+// resumedTokens holds the tokens of the migration states resumed by the proxy until they expire.
+var resumedTokens = &migrationTokens{tokens: make(map[string]time.Time)}
+
+// migrationTokens is a set of migration tokens that each expire at a given time.
+type migrationTokens struct {
+	tokens map[string]time.Time
+	mu     sync.Mutex
+}
+
+// claim adds the token passed to the set until expiry, returning false if it was already claimed before. Expired
+// tokens are removed in the process.
+func (t *migrationTokens) claim(token string, expiry time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for token, expires := range t.tokens {
+		if now.After(expires) {
+			delete(t.tokens, token)
+		}
+	}
+
+	if _, ok := t.tokens[token]; ok {
+		return false
+	}
+	t.tokens[token] = expiry
+	return true
+}
+
+// MigrationStore is a store shared by the proxies of a cluster holding the states of migrated sessions until the
+// clients reconnect to the proxy they were migrated to.
+type MigrationStore interface {
+	// Store stores the state passed under its XUID, replacing any state stored for it. The state expires after
+	// ttl if it was not taken.
+	Store(ctx context.Context, state MigrationState, ttl time.Duration) error
+	// Take removes the state stored under the XUID passed and returns it, along with whether a state was stored.
+	Take(ctx context.Context, xuid string) (MigrationState, bool, error)
+}
+
+// SetMigrationStore sets the store the session saves its state to when it is migrated, and resumes its state
+// from during login if it was migrated by another proxy. It must be set before Login is called.
+func (s *Session) SetMigrationStore(store MigrationStore) {
+	s.migrationStore = store
+}
+
+// Migrate hands the session over to the proxy at the address passed, such as another instance of Spectrum sharing
+// the migration store. The state of the session is stored before the client is sent to the proxy using
+// TransferProxy, and the proxy resumes it once the client reconnects, so the player ends up on the same server
+// without going through discovery again. The state expires after opts.MigrationTTL if the client does not
+// reconnect in time, and is resumed once at most. Since the proxy only resumes it if the client reports connecting
+// to addr, addr must be the address clients reach the proxy at. Sessions of players without an XUID, such as in
+// offline mode, cannot be migrated.
+func (s *Session) Migrate(ctx context.Context, addr string) error {
+	if s.migrationStore == nil {
+		return errors.New("no migration store set")
+	}
+
+	xuid := s.Client().IdentityData().XUID
+	if xuid == "" {
+		return errors.New("session has no xuid")
+	}
+
+	serverAddr := s.ServerAddr()
+	if serverAddr == "" {
+		return errors.New("session is not connected to a server")
+	}
+
+	ttl := s.opts.MigrationTTL
+	if ttl <= 0 {
+		ttl = defaultMigrationTTL
+	}
+
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	cache := s.cache.Load()
+	now := time.Now()
+	state := MigrationState{
+		XUID:         xuid,
+		Token:        hex.EncodeToString(token),
+		Target:       addr,
+		Server:       serverAddr,
+		Cache:        cache.data,
+		CacheVersion: cache.version,
+		Created:      now.UnixMilli(),
+		Expires:      now.Add(ttl).UnixMilli(),
+
+		CacheCompressed: cache.compressed,
+		CacheSlots:      s.cacheSlotList(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+	if err := s.migrationStore.Store(ctx, state, ttl); err != nil {
+		return err
+	}
+
+	s.logger.Debug("migrating session", "addr", addr, "token", state.Token)
+	return s.TransferProxy(addr)
+}
+
+// resume takes the state the session was migrated with from the migration store, if any. The state is only resumed
+// if it was migrated to the address the client connected to, has not expired and its token was not resumed before.
+// Failing to reach the store or to verify the state is logged and treated like having no state, so that the player
+// is discovered a server instead.
+func (s *Session) resume(ctx context.Context) (MigrationState, bool) {
+	if s.migrationStore == nil {
+		return MigrationState{}, false
+	}
+
+	xuid := s.Client().IdentityData().XUID
+	if xuid == "" {
+		return MigrationState{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+	state, ok, err := s.migrationStore.Take(ctx, xuid)
+	if err != nil {
+		s.logger.Error("failed to take migration state", "err", err)
+		return MigrationState{}, false
+	} else if !ok {
+		return MigrationState{}, false
+	}
+
+	if err := verifyMigration(state, xuid, s.Client().ClientData().ServerAddress); err != nil {
+		s.logger.Warn("rejected migration state", "token", state.Token, "err", err)
+		return MigrationState{}, false
+	}
+	return state, true
+}
+
+// verifyMigration verifies that the state passed may be resumed by the player with the XUID passed that connected
+// to the address passed, claiming its token if it may.
+func verifyMigration(state MigrationState, xuid string, addr string) error {
+	expiry := time.UnixMilli(state.Expires)
+	switch {
+	case state.Token == "":
+		return errors.New("state has no token")
+	case state.XUID != xuid:
+		return errors.New("state belongs to another player")
+	case !strings.EqualFold(state.Target, addr):
+		return errors.New("state was migrated to another proxy")
+	case time.Now().After(expiry):
+		return errors.New("state expired")
+	case !resumedTokens.claim(state.Token, expiry):
+		return errors.New("state was already resumed")
+	}
+	return nil
+}
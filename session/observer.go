@@ -0,0 +1,158 @@
+package session
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+const (
+	// batchObserverQueueSize is the amount of batches that may be queued for an observer before new batches are
+	// dropped.
+	batchObserverQueueSize = 64
+	// compressedBatchesSize is the amount of compressed batches kept by ObserveCompression until the session that
+	// read them takes them, after which the oldest batches are dropped.
+	compressedBatchesSize = 1024
+	// compressionNone is the compression algorithm ID prefixed to batches that were not compressed.
+	compressionNone = 0xff
+)
+
+// batchObserver asynchronously hands the batches read from a client connection to an observing function.
+type batchObserver struct {
+	fn     func([]byte)
+	queue  chan []byte
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newBatchObserver(fn func([]byte)) *batchObserver {
+	return &batchObserver{
+		fn:     fn,
+		queue:  make(chan []byte, batchObserverQueueSize),
+		closed: make(chan struct{}),
+	}
+}
+
+// observe queues the batch, which must be a copy the observing function may retain, dropping the batch if the
+// queue is full.
+func (o *batchObserver) observe(batch []byte) {
+	select {
+	case o.queue <- batch:
+	default:
+	}
+}
+
+// run calls the observing function for every queued batch until the observer or the context is closed.
+func (o *batchObserver) run(ctx context.Context) {
+	compressedBatches.observers.Add(1)
+	defer compressedBatches.observers.Add(-1)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.closed:
+			return
+		case batch := <-o.queue:
+			o.fn(batch)
+		}
+	}
+}
+
+// close stops the observer.
+func (o *batchObserver) close() {
+	o.once.Do(func() {
+		close(o.closed)
+	})
+}
+
+// ObserveCompression wraps the compression passed, so that the sessions of the clients accepted by a listener using
+// the returned compression may observe the batches read from them before they are decompressed using
+// Session.ObserveRawClientBatch. Spectrum.Listen wraps the Compression of its minecraft.ListenConfig, which
+// defaults to packet.FlateCompression. The batches are only kept while a session observes raw client batches.
+func ObserveCompression(compression packet.Compression) packet.Compression {
+	if compression == nil {
+		compression = packet.FlateCompression
+	}
+	return observedCompression{Compression: compression}
+}
+
+// observedCompression is the packet.Compression returned by ObserveCompression.
+type observedCompression struct {
+	packet.Compression
+}
+
+// Decompress ...
+func (c observedCompression) Decompress(compressed []byte, limit int) ([]byte, error) {
+	decompressed, err := c.Compression.Decompress(compressed, limit)
+	if err == nil && compressedBatches.observers.Load() > 0 {
+		compressedBatches.put(byte(c.EncodeCompression()), compressed, decompressed)
+	}
+	return decompressed, err
+}
+
+// compressedBatches holds the batches decompressed by the compressions returned by ObserveCompression.
+var compressedBatches = &compressedBatchStore{
+	seed:    maphash.MakeSeed(),
+	batches: make(map[uint64][]byte, compressedBatchesSize),
+}
+
+// compressedBatchStore holds copies of compressed batches by the hash of their decompressed contents, so that the
+// session that read a batch may find it using the payloads the batch held. The store is shared by all listeners,
+// as a packet.Compression does not know the connection it decompresses batches for.
+type compressedBatchStore struct {
+	seed maphash.Seed
+	// observers is the amount of sessions observing raw client batches. Batches are only kept while it is not zero.
+	observers atomic.Int32
+
+	batches map[uint64][]byte
+	keys    [compressedBatchesSize]uint64
+	next    int
+	mu      sync.Mutex
+}
+
+// put stores a copy of the compressed batch, prefixed with the ID of its compression algorithm, dropping the oldest
+// batch if the store is full.
+func (s *compressedBatchStore) put(algorithm byte, compressed, decompressed []byte) {
+	batch := make([]byte, 0, len(compressed)+1)
+	batch = append(batch, algorithm)
+	batch = append(batch, compressed...)
+	key := maphash.Bytes(s.seed, decompressed)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The batch stored in the slot may have been taken already, in which case deleting it does nothing.
+	delete(s.batches, s.keys[s.next])
+	s.batches[key] = batch
+	s.keys[s.next] = key
+	s.next = (s.next + 1) % compressedBatchesSize
+}
+
+// take removes the batch holding the payloads passed from the store and returns it. If the batch is not found,
+// because it was not compressed or was dropped, the payloads are returned as an uncompressed batch instead, which
+// decodes to the same packets.
+func (s *compressedBatchStore) take(payloads [][]byte) []byte {
+	size := 1
+	for _, payload := range payloads {
+		size += binary.MaxVarintLen32 + len(payload)
+	}
+
+	decompressed := make([]byte, 1, size)
+	decompressed[0] = compressionNone
+	for _, payload := range payloads {
+		decompressed = binary.AppendUvarint(decompressed, uint64(len(payload)))
+		decompressed = append(decompressed, payload...)
+	}
+
+	key := maphash.Bytes(s.seed, decompressed[1:])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if batch, ok := s.batches[key]; ok {
+		delete(s.batches, key)
+		return batch
+	}
+	return decompressed
+}
@@ -0,0 +1,456 @@
+package session
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum/metrics"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// clientStage is a single stage of the client pipeline. It receives the packets of a client batch that made it
+// through the previous stages and returns the packets that are passed on to the next stage. Packets dropped by
+// a stage must be returned to the pool using ReturnPacketContext and are never seen by later stages.
+type clientStage func(p *clientPipeline, batch []*PacketContext) ([]*PacketContext, error)
+
+// clientStages are the stages every batch read from the client passes through, in this order, unless the
+// batch is forwarded unchanged because of passthrough:
+//  1. readHeaders reads the header of every packet, dropping packets with an invalid header or unknown ID.
+//  2. filterPacketIDs drops the packets dropped by the filter rules of the session that only match on the ID.
+//  3. decodePackets decodes the packets that need to be decoded, dropping packets that fail to decode.
+//  4. filterPackets drops the decoded packets dropped by the filter rules of the session with a Match function.
+//  5. validatePackets drops the packets violating opts.Validation, or disconnects the session.
+//  6. checkInventory drops the inventory packets failing opts.InventoryChecks, or disconnects the session.
+//  7. translateEntities translates the entity IDs of decoded packets to the IDs used by the server if
+//     opts.TranslateEntityIDs is enabled.
+//  8. filterBlobStatus drops the blob hashes the client reports the status of that were sent by a previous server.
+//
+// Afterwards, processPackets passes the packets the processor subscribed to to the processor's ProcessClient
+// hook, packets cancelled by the processor are dropped and the remaining packets are encoded and written to the
+// server as a single batch by encodeBatch. These steps run on the workers of the pipeline's forwarder if
+// opts.AsyncProcessorWorkers is set. A packet that is dropped by a stage is therefore never decoded
+// or seen by the processor if it was dropped before those stages.
+var clientStages = []clientStage{
+	readHeaders,
+	filterPacketIDs,
+	decodePackets,
+	filterPackets,
+	validatePackets,
+	checkInventory,
+	translateEntities,
+	filterBlobStatus,
+}
+
+// clientPipeline runs the batches read from the client of a session through the client stages.
+type clientPipeline struct {
+	s *Session
+
+	header *packet.Header
+	pool   packet.Pool
+	// reader is reset to the payload of every packet whose header is read or that is decoded, and decoder is the
+	// protocol reader reading from it, which is reused as long as the shield ID it was created with stays the same.
+	reader          *bytes.Reader
+	decoder         protocol.IO
+	decoderShieldID int32
+
+	// subs are the subscriptions of the session's processor at the time the current batch was read.
+	subs subscriptions
+	// encodeHeader is used by encodeBatch, which may run concurrently with the other stages.
+	encodeHeader *packet.Header
+	// encoded holds the buffer of the batch encoded by encodeBatch, which is returned to the pool once the batch
+	// was written.
+	encoded   *encodeBuffer
+	forwarder *forwarder
+
+	// lastRequestID is the ID of the last item stack request of the client that passed checkInventory, and
+	// hasRequestID whether there was one yet.
+	lastRequestID int32
+	hasRequestID  bool
+}
+
+// newClientPipeline creates a new clientPipeline for the session.
+func newClientPipeline(s *Session) *clientPipeline {
+	return &clientPipeline{
+		s:      s,
+		header: &packet.Header{},
+		pool:   s.Client().Proto().Packets(true),
+		reader: bytes.NewReader(nil),
+
+		encodeHeader: &packet.Header{},
+		forwarder:    newForwarder(s, s.forwarding, metrics.ClientForwardQueue),
+	}
+}
+
+// handle runs the payloads of a batch read from the client through the client stages and writes the
+// resulting batch to the server. If the forwarder is asynchronous, the batch is passed to the processor
+// and written asynchronously, in which case an error is only returned if an earlier batch failed.
+func (p *clientPipeline) handle(payloads [][]byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while handling batch: %v", r)
+		}
+	}()
+
+	if !p.forwarder.async() {
+		p.s.forwarding <- struct{}{}
+		defer func() {
+			<-p.s.forwarding
+		}()
+	}
+
+	p.subs = p.s.processorSubscriptions()
+	lane := p.s.clientLane(payloads)
+	if p.passthrough() {
+		for _, payload := range payloads {
+			p.s.countRawPacket(true, payload)
+		}
+		return p.forwarder.forwardLane(lane, nil, func() error {
+			if err := p.s.Server().WriteBatch(payloads); err != nil {
+				return err
+			}
+			p.s.countClientBatch(len(payloads))
+			return nil
+		})
+	}
+
+	batch := make([]*PacketContext, 0, len(payloads))
+	for _, payload := range payloads {
+		batch = append(batch, NewPacketContext(payload, nil))
+	}
+
+	for _, stage := range clientStages {
+		if batch, err = stage(p, batch); err != nil {
+			return err
+		}
+	}
+
+	subs := p.subs
+	return p.forwarder.forwardLane(lane, func() {
+		processPackets(p.s, subs, batch)
+	}, func() error {
+		defer func() {
+			for _, ctx := range batch {
+				ReturnPacketContext(ctx)
+			}
+		}()
+
+		start := time.Now()
+		encoded, n := p.encodeBatch(batch)
+		defer p.releaseEncoded()
+		if err := p.s.Server().WriteEncodedBatch(encoded); err != nil {
+			return err
+		}
+		p.s.countClientBatch(n)
+		processSentPackets(p.s, subs, batch, time.Since(start))
+		return nil
+	})
+}
+
+// passthrough returns whether batches can be forwarded to the server unchanged because none of the client
+// stages would do anything with them: the session has no processor or its processor subscribed to no client
+// packets, no packets need to be decoded and no packets are logged. Packets with unknown IDs are forwarded as well
+// in that case, since their headers are never read.
+func (p *clientPipeline) passthrough() bool {
+	if _, ok := p.s.hooks().(NopProcessor); !ok && (p.subs.client == nil || len(p.subs.client) > 0) {
+		return false
+	}
+
+	if p.subs.client == nil && p.s.decodesAnyClient() {
+		return false
+	}
+	if p.s.logSampling.Load() != nil || p.s.entities != nil || p.s.filtersClient() || p.s.opts.Validation.Enabled() {
+		return false
+	}
+	if p.s.opts.InventoryChecks.Enabled() {
+		return false
+	}
+	if !p.s.opts.DisableTracker && p.s.tracker.hasStaleBlobs() {
+		return false
+	}
+	return p.s.opts.SyncProtocol || p.s.Client().Proto().ID() == protocol.CurrentProtocol
+}
+
+// readHeaders reads the header of every packet in the batch, storing the packet's ID in its context.
+func readHeaders(p *clientPipeline, batch []*PacketContext) ([]*PacketContext, error) {
+	kept := batch[:0]
+	for _, ctx := range batch {
+		p.reader.Reset(ctx.raw)
+		err := p.header.Read(p.reader)
+		if err != nil {
+			err = errors.New("failed to decode header")
+		} else if _, ok := p.pool[p.header.PacketID]; !ok {
+			err = fmt.Errorf("unknown packet with id %d", p.header.PacketID)
+		}
+
+		if err != nil {
+			ReturnPacketContext(ctx)
+			if err := handleDecodeFailure(p.s, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		ctx.id = p.header.PacketID
+		ctx.headerLen = len(ctx.raw) - p.reader.Len()
+		p.s.logPacket("client", ctx.id, len(ctx.raw))
+		p.s.countPacket(true, ctx.id, len(ctx.raw))
+		kept = append(kept, ctx)
+	}
+	return kept, nil
+}
+
+// required returns whether client packets with the ID passed must be decoded for the session itself, regardless of
+// the processor, such as to translate their entity IDs.
+func (p *clientPipeline) required(id uint32) bool {
+	if _, ok := clientEntityPackets[id]; ok && p.s.entities != nil {
+		return true
+	}
+	if p.s.filterDecodes(true, id) {
+		return true
+	}
+	if _, ok := validatedPackets[id]; ok && p.s.opts.Validation.Enabled() {
+		return true
+	}
+	if _, ok := inventoryPackets[id]; ok && p.s.opts.InventoryChecks.Enabled() {
+		return true
+	}
+	return id == packet.IDClientCacheBlobStatus && !p.s.opts.DisableTracker && p.s.Client().ClientCacheEnabled()
+}
+
+// decodePackets decodes the packets in the batch that need to be decoded. Packets are decoded if they are in
+// the client decode list of the session according to opts.ClientDecodeMode, or opts.EnableAllClientDecode is
+// enabled, and the processor subscribed to them. If the client is not on the latest version and SyncProtocol is
+// disabled, every packet is decoded, because forwarding a raw legacy packet to a server that likely lacks
+// multi-version support would lead to decoding errors on the server.
+func decodePackets(p *clientPipeline, batch []*PacketContext) ([]*PacketContext, error) {
+	isClientLatestVersion := p.s.Client().Proto().ID() == protocol.CurrentProtocol
+	decode := p.s.clientDecode()
+	kept := batch[:0]
+	for _, ctx := range batch {
+		if p.s.opts.SyncProtocol || isClientLatestVersion {
+			if !p.required(ctx.id) && (!subscribed(p.subs.client, ctx.id) || !p.s.decodesClient(decode, ctx.id)) {
+				kept = append(kept, ctx)
+				continue
+			}
+		}
+
+		pk, err := p.decode(ctx, isClientLatestVersion)
+		if err != nil {
+			ReturnPacketContext(ctx)
+			if err := handleDecodeFailure(p.s, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if pk == nil {
+			ReturnPacketContext(ctx)
+			continue
+		}
+		ctx.decoded = pk
+		kept = append(kept, ctx)
+	}
+	return kept, nil
+}
+
+// translateEntities translates the entity IDs of the decoded packets of the batch from the IDs used on the client to
+// the IDs used by the server, marking the packets holding entity IDs as modified so that they are encoded again.
+func translateEntities(p *clientPipeline, batch []*PacketContext) ([]*PacketContext, error) {
+	if p.s.entities == nil {
+		return batch, nil
+	}
+
+	for _, ctx := range batch {
+		if ctx.decoded != nil && p.s.entities.toServer(ctx.decoded) {
+			ctx.SetModified()
+		}
+	}
+	return batch, nil
+}
+
+// filterBlobStatus removes the blob hashes sent by a previous server from the ClientCacheBlobStatus packets of the
+// batch, since the current server does not know them, and drops the packets left without hashes.
+func filterBlobStatus(p *clientPipeline, batch []*PacketContext) ([]*PacketContext, error) {
+	if p.s.opts.DisableTracker {
+		return batch, nil
+	}
+
+	kept := batch[:0]
+	for _, ctx := range batch {
+		if pk, ok := ctx.decoded.(*packet.ClientCacheBlobStatus); ok {
+			keep, modified := p.s.tracker.filterBlobStatus(pk)
+			if !keep {
+				ReturnPacketContext(ctx)
+				continue
+			}
+			if modified {
+				ctx.SetModified()
+			}
+		}
+		kept = append(kept, ctx)
+	}
+	return kept, nil
+}
+
+// processPackets passes the packets of the batch the processor subscribed to to the processor's ProcessClient
+// hook. The hook is not called if the processor subscribed to none of them.
+func processPackets(s *Session, subs subscriptions, batch []*PacketContext) {
+	if batch := subscribedBatch(subs.client, batch); len(batch) > 0 {
+		s.hooks().ProcessClient(batch)
+	}
+}
+
+// processSentPackets passes the packets of the batch that were written to the server and that the processor
+// subscribed to to the processor's ProcessClientSent hook.
+func processSentPackets(s *Session, subs subscriptions, batch []*PacketContext, latency time.Duration) {
+	sent := make([]*PacketContext, 0, len(batch))
+	for _, ctx := range batch {
+		if !ctx.Cancelled() && subscribed(subs.client, ctx.id) {
+			sent = append(sent, ctx)
+		}
+	}
+	if len(sent) > 0 {
+		s.hooks().ProcessClientSent(sent, latency)
+	}
+}
+
+// decode decodes the packet of the context. If SyncProtocol is disabled and the client is not on the latest
+// version, the packet is upgraded to the latest version. We've made the assumption that only the first packet
+// of the upgraded packets needs to be handled, as there aren't any cases known yet where more are necessary for
+// packets sent by the client. A nil packet is returned if the packet was dropped while upgrading.
+func (p *clientPipeline) decode(ctx *PacketContext, isClientLatestVersion bool) (pk packet.Packet, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while decoding packet from client batch: %v", r)
+		}
+	}()
+
+	p.reader.Reset(ctx.raw[ctx.headerLen:])
+	if shieldID := p.s.shieldID.Load(); p.decoder == nil || p.decoderShieldID != shieldID {
+		p.decoder = p.s.Client().Proto().NewReader(p.reader, shieldID, true)
+		p.decoderShieldID = shieldID
+	}
+
+	pk = p.pool[ctx.id]()
+	pk.Marshal(p.decoder)
+	if extra := p.reader.Len(); extra > 0 {
+		return nil, fmt.Errorf("%T had an extra %d bytes", pk, extra)
+	}
+
+	if !p.s.opts.SyncProtocol && !isClientLatestVersion {
+		upgraded := p.s.Client().Proto().ConvertToLatest(pk, p.s.Client())
+		if len(upgraded) == 0 {
+			return nil, nil
+		}
+		return upgraded[0], nil
+	}
+	return pk, nil
+}
+
+// encodeBatch drops the cancelled packets of the batch and encodes the remaining packets into a single batch as
+// expected by server.Conn.WriteEncodedBatch, returning it along with the amount of packets it holds.
+// Packets that were decoded are re-encoded if they were modified, or if they were upgraded from a legacy
+// protocol because SyncProtocol is disabled. Packets replaced using PacketContext.SetPacket are always modified,
+// so the replacement is encoded under its own ID. Packets injected using PacketContext.InjectBefore and
+// PacketContext.InjectAfter are encoded around the packet they were injected at, even if it was cancelled.
+// The contexts of the batch are not returned to the pool, so that they can still be passed to ProcessClientSent.
+// The batch returned is held by a pooled buffer and must no longer be used after releaseEncoded was called.
+func (p *clientPipeline) encodeBatch(batch []*PacketContext) ([]byte, int) {
+	var proto minecraft.Protocol
+	if p.s.opts.SyncProtocol {
+		proto = p.s.Client().Proto()
+	} else {
+		proto = minecraft.DefaultProtocol
+	}
+
+	buf := encodeBufferPool.Get().(*encodeBuffer)
+	buf.reset(proto, p.s.Server().ShieldID())
+	p.encoded = buf
+
+	passthrough := p.s.opts.SyncProtocol || p.s.Client().Proto().ID() == protocol.CurrentProtocol
+	for _, ctx := range batch {
+		for _, pk := range ctx.before {
+			buf.appendPacket(p.encodeHeader, pk)
+		}
+
+		if !ctx.Cancelled() {
+			if ctx.decoded == nil || (!ctx.Modified() && passthrough) {
+				buf.appendRaw(ctx.raw)
+			} else {
+				buf.appendPacket(p.encodeHeader, ctx.decoded)
+			}
+		}
+
+		for _, pk := range ctx.after {
+			buf.appendPacket(p.encodeHeader, pk)
+		}
+	}
+	return buf.buf.Bytes(), buf.n
+}
+
+// releaseEncoded returns the buffer of the batch encoded by encodeBatch to the pool once the batch was written.
+// Buffers that grew beyond maxPooledEncodeBuffer are dropped instead.
+func (p *clientPipeline) releaseEncoded() {
+	if buf := p.encoded; buf != nil && buf.buf.Cap() <= maxPooledEncodeBuffer {
+		encodeBufferPool.Put(buf)
+	}
+	p.encoded = nil
+}
+
+// maxPooledEncodeBuffer is the maximum capacity of an encodeBuffer that is returned to the pool, so that a single
+// large batch does not keep its buffer alive.
+const maxPooledEncodeBuffer = 1024 * 1024
+
+// encodeBuffer is a pooled buffer that the client batches written by the pipeline are encoded into, prefixing
+// every packet with its length as a 32-bit little-endian integer. The writer encoding into the buffer is reused
+// as long as the protocol and shield ID it was created with stay the same.
+type encodeBuffer struct {
+	buf bytes.Buffer
+	// n is the amount of packets in the buffer.
+	n int
+
+	writer   protocol.IO
+	protocol int32
+	shieldID int32
+}
+
+// reset empties the buffer, so that packets are encoded using the protocol and shield ID passed.
+func (b *encodeBuffer) reset(proto minecraft.Protocol, shieldID int32) {
+	b.buf.Reset()
+	b.n = 0
+	if b.writer == nil || b.protocol != proto.ID() || b.shieldID != shieldID {
+		b.writer = proto.NewWriter(&b.buf, shieldID)
+		b.protocol, b.shieldID = proto.ID(), shieldID
+	}
+}
+
+// appendRaw appends a packet that is already encoded.
+func (b *encodeBuffer) appendRaw(payload []byte) {
+	b.buf.Write(binary.LittleEndian.AppendUint32(b.buf.AvailableBuffer(), uint32(len(payload))))
+	b.buf.Write(payload)
+	b.n++
+}
+
+// appendPacket encodes the packet with its header using the header passed and appends it.
+func (b *encodeBuffer) appendPacket(header *packet.Header, pk packet.Packet) {
+	var length [4]byte
+	b.buf.Write(length[:])
+	start := b.buf.Len()
+	header.PacketID = pk.ID()
+	_ = header.Write(&b.buf)
+	pk.Marshal(b.writer)
+	binary.LittleEndian.PutUint32(b.buf.Bytes()[start-4:start], uint32(b.buf.Len()-start))
+	b.n++
+}
+
+var encodeBufferPool = sync.Pool{
+	New: func() any {
+		return &encodeBuffer{}
+	},
+}
@@ -0,0 +1,252 @@
+package session
+
+import (
+	"bytes"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cooldogedev/spectrum/util"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// recordingProcessor records the client packets passed to ProcessClient and whether they were decoded.
+type recordingProcessor struct {
+	NopProcessor
+	subscribed []uint32
+	cancel     uint32
+
+	decoded map[uint32]bool
+	mu      sync.Mutex
+}
+
+// SubscribedClientPackets ...
+func (p *recordingProcessor) SubscribedClientPackets() []uint32 {
+	return p.subscribed
+}
+
+// SubscribedServerPackets ...
+func (p *recordingProcessor) SubscribedServerPackets() []uint32 {
+	return []uint32{}
+}
+
+// ProcessClient ...
+func (p *recordingProcessor) ProcessClient(batch []*PacketContext) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ctx := range batch {
+		p.decoded[ctx.id] = ctx.Packet() != nil
+		if ctx.id == p.cancel {
+			ctx.Cancel()
+		}
+	}
+}
+
+// processed returns whether the packet with the ID passed was passed to ProcessClient and whether it was decoded.
+func (p *recordingProcessor) processed(id uint32) (processed bool, decoded bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	decoded, processed = p.decoded[id]
+	return processed, decoded
+}
+
+// decodeCountingPacketID is the ID of decodeCountingPacket.
+const decodeCountingPacketID = 0x3fe
+
+// decodeCountingPackets is the amount of times a decodeCountingPacket was decoded.
+var decodeCountingPackets atomic.Int32
+
+func init() {
+	packet.RegisterPacketFromClient(decodeCountingPacketID, func() packet.Packet { return &decodeCountingPacket{} })
+}
+
+// decodeCountingPacket is an empty client packet counting how often it is decoded.
+type decodeCountingPacket struct{}
+
+// ID ...
+func (*decodeCountingPacket) ID() uint32 {
+	return decodeCountingPacketID
+}
+
+// Marshal ...
+func (*decodeCountingPacket) Marshal(io protocol.IO) {
+	if _, ok := io.(*protocol.Reader); ok {
+		decodeCountingPackets.Add(1)
+	}
+}
+
+// unknownPacketID is the ID of a packet that does not exist, which is dropped by readHeaders.
+const unknownPacketID = 0x3ff
+
+func TestClientPipeline(t *testing.T) {
+	tests := []struct {
+		name       string
+		subscribed []uint32
+		cancel     uint32
+		rules      []util.FilterRule
+		unknown    bool
+		processed  bool
+		forwarded  bool
+	}{
+		{
+			name:       "processed and forwarded",
+			subscribed: []uint32{packet.IDCommandRequest, packet.IDAnimate},
+			processed:  true,
+			forwarded:  true,
+		},
+		{
+			name:       "not subscribed",
+			subscribed: []uint32{packet.IDAnimate},
+			forwarded:  true,
+		},
+		{
+			name:       "cancelled by processor",
+			subscribed: []uint32{packet.IDCommandRequest, packet.IDAnimate},
+			cancel:     packet.IDCommandRequest,
+			processed:  true,
+		},
+		{
+			name:       "dropped by filter rule",
+			subscribed: []uint32{packet.IDCommandRequest, packet.IDAnimate},
+			rules:      []util.FilterRule{{Name: "commands", Direction: "client", ID: packet.IDCommandRequest, Action: FilterDrop}},
+		},
+		{
+			name:    "unknown packet",
+			unknown: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := *util.DefaultOpts()
+			opts.EnableAllClientDecode = true
+			opts.FilterRules = tt.rules
+			opts.ProtocolMismatchThreshold = 10
+			ts := newTestSession(t, NewRegistry(), opts)
+			processor := &recordingProcessor{subscribed: tt.subscribed, cancel: tt.cancel, decoded: make(map[uint32]bool)}
+			ts.SetProcessor(processor)
+
+			id := uint32(packet.IDCommandRequest)
+			if tt.unknown {
+				id = unknownPacketID
+				header := &packet.Header{PacketID: id}
+				buf := bytes.NewBuffer(nil)
+				_ = header.Write(buf)
+				if _, err := ts.client.Write(buf.Bytes()); err != nil {
+					t.Fatalf("failed to write unknown packet: %v", err)
+				}
+				ts.writeClient(t)
+			} else {
+				ts.writeClient(t, &packet.CommandRequest{CommandLine: "/say hello"})
+			}
+
+			// The Animate packet marks the end of the packets sent, since it is always forwarded. Unknown packets
+			// cannot be decoded by the backend, so readBackend fails if they are forwarded.
+			ts.writeClient(t, &packet.Animate{ActionType: packet.AnimateActionSwingArm})
+			forwarded := slices.ContainsFunc(ts.readBackend(t, packet.IDAnimate), func(pk packet.Packet) bool {
+				return pk.ID() == id
+			})
+			if forwarded != tt.forwarded {
+				t.Errorf("forwarded = %v, want %v", forwarded, tt.forwarded)
+			}
+
+			processed, decoded := processor.processed(id)
+			if processed != tt.processed {
+				t.Errorf("processed = %v, want %v", processed, tt.processed)
+			}
+			if processed && !decoded {
+				t.Error("processed packet was not decoded")
+			}
+		})
+	}
+}
+
+func TestClientPipelineFilteredPackets(t *testing.T) {
+	opts := *util.DefaultOpts()
+	opts.EnableAllClientDecode = true
+	opts.Validation = util.ValidationLimits{MaxStringLength: 4, Action: ValidationDisconnect}
+	opts.FilterRules = []util.FilterRule{
+		{Name: "counting", Direction: "client", ID: decodeCountingPacketID, Action: FilterDrop},
+		{Name: "commands", Direction: "client", ID: packet.IDCommandRequest, Action: FilterDrop},
+	}
+	ts := newTestSession(t, NewRegistry(), opts)
+	processor := &recordingProcessor{
+		subscribed: []uint32{decodeCountingPacketID, packet.IDCommandRequest, packet.IDAnimate},
+		decoded:    make(map[uint32]bool),
+	}
+	ts.SetProcessor(processor)
+
+	// The command exceeds the validation limits, so the session is disconnected if it is validated before it is
+	// dropped.
+	decodes := decodeCountingPackets.Load()
+	ts.writeClient(t, &decodeCountingPacket{})
+	ts.writeClient(t, &packet.CommandRequest{CommandLine: "/say hello"})
+	ts.writeClient(t, &packet.Animate{ActionType: packet.AnimateActionSwingArm})
+	for _, pk := range ts.readBackend(t, packet.IDAnimate) {
+		if id := pk.ID(); id == decodeCountingPacketID || id == packet.IDCommandRequest {
+			t.Errorf("filtered packet %d was forwarded", id)
+		}
+	}
+
+	if n := decodeCountingPackets.Load() - decodes; n != 0 {
+		t.Errorf("filtered packet was decoded %d times", n)
+	}
+	for _, id := range []uint32{decodeCountingPacketID, packet.IDCommandRequest} {
+		if processed, _ := processor.processed(id); processed {
+			t.Errorf("filtered packet %d was processed", id)
+		}
+	}
+	if processed, _ := processor.processed(packet.IDAnimate); !processed {
+		t.Error("Animate was not processed")
+	}
+}
+
+// clientBatchPaths configure a session to forward client batches unchanged through passthrough or to run them
+// through the client stages for a processor that does not modify them.
+var clientBatchPaths = []struct {
+	name      string
+	processor bool
+}{
+	{name: "passthrough"},
+	{name: "processor", processor: true},
+}
+
+// newClientBatchSession logs in a new session forwarding client batches through the path passed.
+func newClientBatchSession(t testing.TB, processor bool) *testSession {
+	t.Helper()
+	opts := *util.DefaultOpts()
+	opts.EnableAllClientDecode = processor
+	ts := newTestSession(t, NewRegistry(), opts)
+	if processor {
+		ts.SetProcessor(&recordingProcessor{subscribed: []uint32{packet.IDText}, decoded: make(map[uint32]bool)})
+	}
+	return ts
+}
+
+func TestClientBatchPathsIdentical(t *testing.T) {
+	text := &packet.Text{TextType: packet.TextTypeChat, SourceName: "player", Message: "hello"}
+	payloads := make([][]byte, 0, len(clientBatchPaths))
+	for _, path := range clientBatchPaths {
+		ts := newClientBatchSession(t, path.processor)
+		ts.writeClient(t, text)
+		payloads = append(payloads, bytes.Clone(ts.readBackendPayload(t, packet.IDText)))
+	}
+	if !bytes.Equal(payloads[0], payloads[1]) {
+		t.Fatalf("processor path wrote %x, passthrough wrote %x", payloads[1], payloads[0])
+	}
+}
+
+func BenchmarkClientBatch(b *testing.B) {
+	text := &packet.Text{TextType: packet.TextTypeChat, SourceName: "player", Message: "hello"}
+	for _, path := range clientBatchPaths {
+		b.Run(path.name, func(b *testing.B) {
+			ts := newClientBatchSession(b, path.processor)
+			b.ReportAllocs()
+			for b.Loop() {
+				ts.writeClient(b, text)
+				ts.readBackendPayload(b, packet.IDText)
+			}
+		})
+	}
+}
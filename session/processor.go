@@ -2,14 +2,18 @@ package session
 
 import (
 	"sync"
+	"time"
 
 	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sandertv/gophertunnel/minecraft/resource"
 )
 
 // Context represents the context of an action. It holds the state of whether the action has been canceled.
 type Context struct {
 	canceled bool
+	values   values
 }
 
 // NewContext returns a new context.
@@ -27,6 +31,18 @@ func (c *Context) Cancelled() bool {
 	return c.canceled
 }
 
+// WithValue attaches a value to the context under the key, replacing any value previously attached under it.
+// Values are visible to every processor called with the context afterwards. Like with context.WithValue, the
+// key must be comparable and should be of an unexported type to avoid collisions between processors.
+func (c *Context) WithValue(key, value any) {
+	c.values.set(key, value)
+}
+
+// Value returns the value attached to the context under the key, or nil if no value was attached.
+func (c *Context) Value(key any) any {
+	return c.values.get(key)
+}
+
 var pkCtxPool = sync.Pool{
 	New: func() any {
 		return &PacketContext{}
@@ -39,8 +55,15 @@ type PacketContext struct {
 	canceled bool
 	modified bool
 
+	id        uint32
+	headerLen int
+
 	raw     []byte
 	decoded packet.Packet
+	values  values
+
+	before []packet.Packet
+	after  []packet.Packet
 }
 
 func NewPacketContext(raw []byte, decoded packet.Packet) *PacketContext {
@@ -51,10 +74,17 @@ func NewPacketContext(raw []byte, decoded packet.Packet) *PacketContext {
 }
 
 func ReturnPacketContext(ctx *PacketContext) {
+	ctx.id = 0
+	ctx.headerLen = 0
 	ctx.raw = nil
 	ctx.decoded = nil
 	ctx.modified = false
 	ctx.canceled = false
+	ctx.values.reset()
+	clear(ctx.before)
+	ctx.before = ctx.before[:0]
+	clear(ctx.after)
+	ctx.after = ctx.after[:0]
 	pkCtxPool.Put(ctx)
 }
 
@@ -89,26 +119,104 @@ func (ctx *PacketContext) SetModified() {
 	ctx.modified = true
 }
 
+// SetPacket replaces the packet of the context with another packet, which is forwarded in its place while keeping
+// its position in the batch. The context is marked as modified, so the replacement is always encoded, even if the
+// original packet was not decoded. pk must not be nil, Cancel should be used to drop a packet instead.
+func (ctx *PacketContext) SetPacket(pk packet.Packet) {
+	ctx.decoded = pk
+	ctx.modified = true
+}
+
+// InjectBefore injects a packet into the batch of a client packet, directly before the packet of the context but
+// after any packets injected before it earlier. Injected packets are forwarded even if the context is cancelled, which
+// allows them to be written in the position of the packet they replace. It has no effect on server packets.
+func (ctx *PacketContext) InjectBefore(pk packet.Packet) {
+	ctx.before = append(ctx.before, pk)
+}
+
+// InjectAfter injects a packet into the batch of a client packet, directly after the packet of the context and
+// any packets injected after it earlier. Injected packets are forwarded even if the context is cancelled.
+// It has no effect on server packets.
+func (ctx *PacketContext) InjectAfter(pk packet.Packet) {
+	ctx.after = append(ctx.after, pk)
+}
+
+// WithValue attaches a value to the context under the key, replacing any value previously attached under it.
+// Values are visible to every processor called with the context afterwards and are removed once the packet was
+// forwarded. Like with context.WithValue, the key must be comparable and should be of an unexported type to
+// avoid collisions between processors.
+func (ctx *PacketContext) WithValue(key, value any) {
+	ctx.values.set(key, value)
+}
+
+// Value returns the value attached to the context under the key, or nil if no value was attached.
+func (ctx *PacketContext) Value(key any) any {
+	return ctx.values.get(key)
+}
+
 // Processor defines methods for processing various actions within a proxy session.
 type Processor interface {
+	// ProcessLogin is called once the client logged in to the proxy, before a server is dialed. Cancelling the
+	// context rejects the login and disconnects the client. It is only called if the processor was set before
+	// Session.Login was called, so processors of sessions accepted with AutoLogin must be set using
+	// Spectrum.SetSessionProcessor.
+	ProcessLogin(ctx *Context, identity login.IdentityData, client login.ClientData)
+	// ProcessResourcePacks is called with the resource packs about to be offered to a client during login, which
+	// happens before a session is created for the client. It is therefore only called on the processor set using
+	// Spectrum.SetListenerProcessor, and never on the processors of a session, including those added using
+	// Session.AddProcessor. Cancelling the context offers the packs of the minecraft.ListenConfig instead.
+	ProcessResourcePacks(ctx *Context, packs *[]*resource.Pack)
 	// ProcessStartGame is called only once during the login sequence.
 	ProcessStartGame(ctx *Context, data *minecraft.GameData)
-	// ProcessServer is called before forwarding the server-sent packets to the client.
+	// ProcessServer is called before forwarding the server-sent packets to the client. It is not called if
+	// opts.BatchServerPackets is enabled.
 	ProcessServer(ctx *PacketContext)
 	// ProcessClient is called before forwarding the client-sent packets to the server.
 	ProcessClient(batch []*PacketContext)
+	// ProcessServerBatch is called instead of ProcessServer if opts.BatchServerPackets is enabled, with the
+	// server-sent packets read up to a Flush packet of the server, which usually makes up a whole tick of the
+	// server, before they are forwarded to the client.
+	ProcessServerBatch(batch []*PacketContext)
+	// ProcessServerSent is called after a server-sent packet was written to the client, with the time it took to
+	// write it. It is not called for packets that were cancelled or failed to be written.
+	ProcessServerSent(ctx *PacketContext, latency time.Duration)
+	// ProcessClientSent is called after a batch of client-sent packets was written to the server, with the time it
+	// took to write it. The batch only holds the packets that were not cancelled, and the contexts must not be used
+	// after the hook returns.
+	ProcessClientSent(batch []*PacketContext, latency time.Duration)
+	// ProcessLatency is called before the client's latency is reported to the server, allowing the latency in
+	// milliseconds and the timestamp in Unix milliseconds to be adjusted. Cancelling the context skips the report.
+	ProcessLatency(ctx *Context, latency *int64, timestamp *int64)
 	// ProcessFlush is called before flushing the player's minecraft.Conn buffer in response to a downstream server request.
 	ProcessFlush(ctx *Context)
 	// ProcessPreTransfer is called before transferring the player to a different server.
 	ProcessPreTransfer(ctx *Context, origin *string, target *string)
 	// ProcessTransferFailure is called when the player transfer to a different server fails.
 	ProcessTransferFailure(ctx *Context, origin *string, target *string)
+	// ProcessTransferRejected is called when a transfer to target is rejected before it started, with the error
+	// returned to the caller of the transfer, such as a *TransferCooldownError.
+	ProcessTransferRejected(ctx *Context, target string, err error)
 	// ProcessPostTransfer is called after transferring the player to a different server.
 	ProcessPostTransfer(ctx *Context, origin *string, target *string)
-	// ProcessCache is called before updating the session's cache.
+	// ProcessDimensionChange is called when the client changed from one dimension to another, either because the
+	// server sent a ChangeDimension packet or because the player was transferred to a server in another dimension.
+	// It is not called if opts.DisableTracker is enabled.
+	ProcessDimensionChange(ctx *Context, from int32, to int32)
+	// ProcessCache is called before updating the session's default cache. It is not called for named cache slots.
 	ProcessCache(ctx *Context, new *[]byte)
-	// ProcessDisconnection is called when the player disconnects from the proxy.
+	// ProcessDisconnection is called when the player disconnects from the proxy. The message is that of the error
+	// the session was closed with and may be changed to alter the message the client is disconnected with. All
+	// errors encountered while closing the session are returned by DisconnectCause(ctx).
 	ProcessDisconnection(ctx *Context, message *string)
+	// ProcessProtocolMismatch is called once the amount of client packets that failed to decode reaches
+	// opts.ProtocolMismatchThreshold, which usually indicates that the client sends packets of a protocol other
+	// than the one it negotiated. err is the most recent decode error. The session is disconnected afterwards
+	// unless the context is canceled, in which case the failure count is reset.
+	ProcessProtocolMismatch(ctx *Context, failures int, err error)
+	// ProcessServerRemoved is called when the server the player is connected to was removed from the server
+	// registry set using Session.SetServerRegistry. The session falls back to another server afterwards unless the
+	// context is canceled, in which case the player stays on the server.
+	ProcessServerRemoved(ctx *Context, addr string)
 }
 
 // NopProcessor is a no-operation implementation of the Processor interface.
@@ -117,12 +225,22 @@ type NopProcessor struct{}
 // Ensure that NopProcessor satisfies the Processor interface.
 var _ Processor = NopProcessor{}
 
-func (NopProcessor) ProcessStartGame(_ *Context, _ *minecraft.GameData)      {}
-func (NopProcessor) ProcessServer(_ *PacketContext)                          {}
-func (NopProcessor) ProcessClient(_ []*PacketContext)                        {}
-func (NopProcessor) ProcessFlush(_ *Context)                                 {}
-func (NopProcessor) ProcessPreTransfer(_ *Context, _ *string, _ *string)     {}
-func (NopProcessor) ProcessTransferFailure(_ *Context, _ *string, _ *string) {}
-func (NopProcessor) ProcessPostTransfer(_ *Context, _ *string, _ *string)    {}
-func (NopProcessor) ProcessCache(_ *Context, _ *[]byte)                      {}
-func (NopProcessor) ProcessDisconnection(_ *Context, _ *string)              {}
+func (NopProcessor) ProcessLogin(_ *Context, _ login.IdentityData, _ login.ClientData) {}
+func (NopProcessor) ProcessResourcePacks(_ *Context, _ *[]*resource.Pack)              {}
+func (NopProcessor) ProcessStartGame(_ *Context, _ *minecraft.GameData)                {}
+func (NopProcessor) ProcessServer(_ *PacketContext)                                    {}
+func (NopProcessor) ProcessClient(_ []*PacketContext)                                  {}
+func (NopProcessor) ProcessServerBatch(_ []*PacketContext)                             {}
+func (NopProcessor) ProcessServerSent(_ *PacketContext, _ time.Duration)               {}
+func (NopProcessor) ProcessClientSent(_ []*PacketContext, _ time.Duration)             {}
+func (NopProcessor) ProcessLatency(_ *Context, _ *int64, _ *int64)                     {}
+func (NopProcessor) ProcessFlush(_ *Context)                                           {}
+func (NopProcessor) ProcessPreTransfer(_ *Context, _ *string, _ *string)               {}
+func (NopProcessor) ProcessTransferFailure(_ *Context, _ *string, _ *string)           {}
+func (NopProcessor) ProcessTransferRejected(_ *Context, _ string, _ error)             {}
+func (NopProcessor) ProcessPostTransfer(_ *Context, _ *string, _ *string)              {}
+func (NopProcessor) ProcessDimensionChange(_ *Context, _ int32, _ int32)               {}
+func (NopProcessor) ProcessCache(_ *Context, _ *[]byte)                                {}
+func (NopProcessor) ProcessDisconnection(_ *Context, _ *string)                        {}
+func (NopProcessor) ProcessProtocolMismatch(_ *Context, _ int, _ error)                {}
+func (NopProcessor) ProcessServerRemoved(_ *Context, _ string)                         {}
@@ -3,16 +3,20 @@ package session
 import (
 	"strings"
 	"sync"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 )
 
 type Registry struct {
 	sessions map[string]*Session
+	groups   map[string]map[*Session]struct{}
 	mu       sync.RWMutex
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
 		sessions: make(map[string]*Session),
+		groups:   make(map[string]map[*Session]struct{}),
 	}
 }
 
@@ -33,7 +37,7 @@ func (r *Registry) GetSessionByUsername(username string) *Session {
 	defer r.mu.RUnlock()
 
 	for _, session := range r.sessions {
-		if strings.EqualFold(session.client.IdentityData().DisplayName, username) {
+		if strings.EqualFold(session.Client().IdentityData().DisplayName, username) {
 			return session
 		}
 	}
@@ -56,3 +60,69 @@ func (r *Registry) GetSessions() []*Session {
 	}
 	return sessions
 }
+
+// GetGroup returns the sessions that are currently members of the named group.
+func (r *Registry) GetGroup(name string) []*Session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := r.groups[name]
+	sessions := make([]*Session, 0, len(members))
+	for session := range members {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// BroadcastToGroup writes the provided packets to every session that is a member of the named group.
+func (r *Registry) BroadcastToGroup(name string, pks []packet.Packet) {
+	for _, session := range r.GetGroup(name) {
+		for _, pk := range pks {
+			if err := session.Client().WritePacket(pk); err != nil {
+				break
+			}
+		}
+	}
+}
+
+// joinGroup adds the session to the named group, creating the group if it does not exist yet. Closed sessions
+// are not added. The check is done while holding the lock, so that a session closed concurrently is either never
+// added or removed again by leaveGroups.
+func (r *Registry) joinGroup(name string, session *Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if session.ctx.Err() != nil {
+		return
+	}
+
+	members, ok := r.groups[name]
+	if !ok {
+		members = make(map[*Session]struct{})
+		r.groups[name] = members
+	}
+	members[session] = struct{}{}
+}
+
+// leaveGroup removes the session from the named group, deleting the group once it has no members left.
+func (r *Registry) leaveGroup(name string, session *Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if members, ok := r.groups[name]; ok {
+		delete(members, session)
+		if len(members) == 0 {
+			delete(r.groups, name)
+		}
+	}
+}
+
+// leaveGroups removes the session from every group it is a member of.
+func (r *Registry) leaveGroups(session *Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, members := range r.groups {
+		delete(members, session)
+		if len(members) == 0 {
+			delete(r.groups, name)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+
+	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// registryPackets holds the IDs of the heavyweight, mostly static packets cached by sessions if
+// opts.CacheRegistries is enabled.
+var registryPackets = map[uint32]struct{}{
+	packet.IDAvailableCommands:   {},
+	packet.IDBiomeDefinitionList: {},
+	packet.IDCreativeContent:     {},
+}
+
+// registryCache holds the most recent registry packet of every kind sent to the client of a session, so that
+// servers declaring the same hash using a CachedRegistry packet do not have to send it again.
+type registryCache struct {
+	header  packet.Header
+	entries map[uint32]registryEntry
+	mu      sync.Mutex
+}
+
+// registryEntry is an encoded registry packet held by a registryCache.
+type registryEntry struct {
+	hash    uint64
+	payload []byte
+}
+
+// newRegistryCache creates an empty registryCache.
+func newRegistryCache() *registryCache {
+	return &registryCache{entries: make(map[uint32]registryEntry)}
+}
+
+// store caches a copy of the encoded packet passed if it is a registry packet.
+func (c *registryCache) store(payload []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.header.Read(bytes.NewBuffer(payload)); err != nil {
+		return
+	}
+	if _, ok := registryPackets[c.header.PacketID]; !ok {
+		return
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write(payload)
+	c.entries[c.header.PacketID] = registryEntry{hash: h.Sum64(), payload: bytes.Clone(payload)}
+}
+
+// load returns the cached packet with the ID and hash passed, if any.
+func (c *registryCache) load(id uint32, hash uint64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[id]
+	if !ok || entry.hash != hash {
+		return nil, false
+	}
+	return entry.payload, true
+}
+
+// hashes returns the hashes of the cached packets, sorted by packet ID.
+func (c *registryCache) hashes() []spectrumpacket.RegistryHash {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hashes := make([]spectrumpacket.RegistryHash, 0, len(c.entries))
+	for id, entry := range c.entries {
+		hashes = append(hashes, spectrumpacket.RegistryHash{PacketID: id, Hash: entry.hash})
+	}
+	slices.SortFunc(hashes, func(a, b spectrumpacket.RegistryHash) int {
+		return int(a.PacketID) - int(b.PacketID)
+	})
+	return hashes
+}
+
+// writeCachedRegistry writes the cached registry packet the CachedRegistry packet passed refers to to the client.
+// Servers referring to packets the session does not hold are logged, since the client never receives the packet.
+func (s *Session) writeCachedRegistry(pk *spectrumpacket.CachedRegistry) error {
+	if s.registries == nil {
+		s.logger.Warn("server sent cached registry while registries are not cached", "id", pk.PacketID)
+		return nil
+	}
+
+	payload, ok := s.registries.load(pk.PacketID, pk.Hash)
+	if !ok {
+		s.logger.Warn("server sent unknown cached registry", "id", pk.PacketID, "hash", pk.Hash)
+		return nil
+	}
+	if _, err := s.Client().Write(payload); err != nil {
+		return fmt.Errorf("failed to write packet to client: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/cooldogedev/spectrum/util"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func TestRegistryBroadcastToGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		joins  map[int][]string
+		leaves map[int][]string
+		closed []int
+		// lateJoins are the groups joined after the closed sessions were closed.
+		lateJoins map[int][]string
+		group     string
+		want      []int
+	}{
+		{
+			name:  "members only",
+			joins: map[int][]string{0: {"arena"}, 1: {"arena"}, 2: {"party"}},
+			group: "arena",
+			want:  []int{0, 1},
+		},
+		{
+			name:   "left group",
+			joins:  map[int][]string{0: {"arena"}, 1: {"arena", "party"}},
+			leaves: map[int][]string{1: {"arena"}},
+			group:  "arena",
+			want:   []int{0},
+		},
+		{
+			name:   "closed session",
+			joins:  map[int][]string{0: {"arena"}, 1: {"arena"}},
+			closed: []int{0},
+			group:  "arena",
+			want:   []int{1},
+		},
+		{
+			name:      "joined after close",
+			joins:     map[int][]string{1: {"arena"}},
+			closed:    []int{0},
+			lateJoins: map[int][]string{0: {"arena"}},
+			group:     "arena",
+			want:      []int{1},
+		},
+		{
+			name:  "unknown group",
+			joins: map[int][]string{0: {"arena"}},
+			group: "party",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry()
+			sessions := make([]*testSession, 3)
+			for i := range sessions {
+				sessions[i] = newTestSession(t, registry, *util.DefaultOpts())
+			}
+			for i, groups := range tt.joins {
+				for _, group := range groups {
+					sessions[i].JoinGroup(group)
+				}
+			}
+			for i, groups := range tt.leaves {
+				for _, group := range groups {
+					sessions[i].LeaveGroup(group)
+				}
+			}
+			for _, i := range tt.closed {
+				_ = sessions[i].Close()
+			}
+			for i, groups := range tt.lateJoins {
+				for _, group := range groups {
+					sessions[i].JoinGroup(group)
+				}
+			}
+
+			var members []int
+			for _, member := range registry.GetGroup(tt.group) {
+				members = append(members, slices.IndexFunc(sessions, func(ts *testSession) bool {
+					return ts.Session == member
+				}))
+			}
+			slices.Sort(members)
+			if !slices.Equal(members, tt.want) {
+				t.Fatalf("group members = %v, want %v", members, tt.want)
+			}
+
+			registry.BroadcastToGroup(tt.group, []packet.Packet{&packet.Text{TextType: packet.TextTypeRaw, Message: tt.group}})
+			for i, ts := range sessions {
+				if slices.Contains(tt.closed, i) {
+					continue
+				}
+
+				// The marker is written after the broadcast, so the broadcast packet is read first if it was sent.
+				if err := ts.Client().WritePacket(&packet.SetTime{Time: 1}); err != nil {
+					t.Fatalf("failed to write marker: %v", err)
+				}
+				received := slices.ContainsFunc(ts.readClient(t, packet.IDSetTime), func(pk packet.Packet) bool {
+					text, ok := pk.(*packet.Text)
+					return ok && text.Message == tt.group
+				})
+				if want := slices.Contains(tt.want, i); received != want {
+					t.Errorf("session %d received broadcast = %v, want %v", i, received, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+)
+
+// watchClient detaches the session once the client passed is lost, or cancels the session's context with the
+// cause of the client's context if the session cannot be resumed.
+func (s *Session) watchClient(client *minecraft.Conn) {
+	context.AfterFunc(client.Context(), func() {
+		if !s.detach(client) {
+			s.cancelFunc(context.Cause(client.Context()))
+		}
+	})
+}
+
+// detach keeps the session alive for opts.ResumeWindow after the client passed was lost, so that the player may
+// reattach using Reattach. It returns false if the session cannot be resumed, which is the case if resuming is
+// disabled, the session is closing, the player has not spawned yet or has no XUID to be recognised by.
+func (s *Session) detach(client *minecraft.Conn) bool {
+	window := s.opts.ResumeWindow
+	if window <= 0 || s.closing.Load() || s.joinedAt.Load() == 0 || client.IdentityData().XUID == "" {
+		return false
+	}
+
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+	if s.Client() != client || s.reattached != nil {
+		// The client was already replaced or the session is already waiting for it to be replaced.
+		return true
+	}
+
+	reattached := make(chan struct{})
+	s.reattached = reattached
+	s.logger.Info("client lost, waiting for it to resume", "window", window)
+	go func() {
+		ctx, cancel := context.WithTimeout(s.ctx, window)
+		defer cancel()
+		select {
+		case <-reattached:
+		case <-ctx.Done():
+			s.resumeMu.Lock()
+			expired := s.reattached == reattached
+			s.resumeMu.Unlock()
+			if expired {
+				s.CloseWithError(fmt.Errorf("client did not resume within %s", window))
+			}
+		}
+	}()
+	return true
+}
+
+// Detached returns whether the client of the session was lost and the session is waiting for the player to
+// reattach within opts.ResumeWindow.
+func (s *Session) Detached() bool {
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+	return s.reattached != nil
+}
+
+// Reattach resumes a detached session with the new connection of the same player, which is spawned using the game
+// data the session was started with. The state tracked by the session, such as entities, boss bars and cached
+// chunks, is replayed to the new client, and the server connection, which was kept alive, is reused instead of
+// logging in to the server again. Spectrum reattaches sessions automatically when opts.ResumeWindow is set.
+func (s *Session) Reattach(client *minecraft.Conn) error {
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+	if s.reattached == nil {
+		return errors.New("session is not detached")
+	}
+
+	if client.IdentityData().XUID != s.Client().IdentityData().XUID {
+		return errors.New("client belongs to another player")
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.opts.ResumeWindow)
+	defer cancel()
+	if err := client.StartGameContext(ctx, s.GameData()); err != nil {
+		return fmt.Errorf("startgame sequence failed: %w", err)
+	}
+
+	s.client.Store(client)
+	s.shieldID.Store(shieldID(client.GameData().Items))
+	s.tracker.replay(s)
+	if err := client.Flush(); err != nil {
+		return fmt.Errorf("failed to flush client's buffer: %w", err)
+	}
+
+	close(s.reattached)
+	s.reattached = nil
+	s.watchClient(client)
+	go handleClient(s)
+	s.logger.Info("client resumed session")
+	return nil
+}
+
+// awaitResume blocks until the session was reattached if the client passed was lost and the session is
+// resumable, returning true once it was reattached. It returns false immediately if the client was not lost or
+// the session cannot be resumed.
+func (s *Session) awaitResume(client *minecraft.Conn) bool {
+	if client.Context().Err() == nil || !s.detach(client) {
+		return false
+	}
+
+	s.resumeMu.Lock()
+	reattached := s.reattached
+	s.resumeMu.Unlock()
+	if reattached == nil {
+		return true
+	}
+
+	select {
+	case <-reattached:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
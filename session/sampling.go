@@ -0,0 +1,52 @@
+package session
+
+import (
+	"encoding/binary"
+	"maps"
+	"math/rand/v2"
+)
+
+// SetLogSampling sets the rates at which packets forwarded by the session are logged, keyed by packet ID.
+// A rate of 1 logs every packet with that ID, 0.01 logs roughly one in a hundred, and packets without a rate
+// are never logged. Sampling is probabilistic, so the amount of logged packets only approaches the rate over
+// time. The map is copied, so it may be modified after the call. Passing nil disables logging.
+// Packets are logged at debug level using the session's logger.
+func (s *Session) SetLogSampling(rates map[uint32]float64) {
+	if len(rates) == 0 {
+		s.logSampling.Store(nil)
+		return
+	}
+
+	rates = maps.Clone(rates)
+	s.logSampling.Store(&rates)
+}
+
+// logPacket logs a packet forwarded in the given direction if it is picked by the session's log sampling rates.
+// The size of the packet is omitted if it is unknown, which is the case for packets that were decoded by the server.
+func (s *Session) logPacket(direction string, id uint32, size int) {
+	rates := s.logSampling.Load()
+	if rates == nil {
+		return
+	}
+
+	rate, ok := (*rates)[id]
+	if !ok || rate <= 0 || (rate < 1 && rand.Float64() >= rate) {
+		return
+	}
+	args := []any{"xuid", s.Client().IdentityData().XUID, "direction", direction, "id", id}
+	if size > 0 {
+		args = append(args, "size", size)
+	}
+	s.logger.Debug("forwarded packet", args...)
+}
+
+// logRawPacket logs a raw packet payload, reading the packet ID from the payload's header.
+func (s *Session) logRawPacket(direction string, payload []byte) {
+	if s.logSampling.Load() == nil {
+		return
+	}
+
+	if header, n := binary.Uvarint(payload); n > 0 {
+		s.logPacket(direction, uint32(header&0x3ff), len(payload))
+	}
+}
@@ -0,0 +1,51 @@
+package session
+
+import (
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// noTransferScreen is stored in Session.transferScreen while no transfer screen is shown.
+const noTransferScreen int32 = -1
+
+// showTransferScreen shows the dimension change loading screen to the client by moving it to a temporary
+// dimension, which stays visible until hideTransferScreen is called. The dimension change screen is supported
+// by every protocol version. Clients on protocol 712 (1.21.20) and above additionally report when the screen
+// is dismissed through a ServerBoundLoadingScreen packet, which is forwarded to the server like any other packet.
+func (s *Session) showTransferScreen() {
+	gameData := s.GameData()
+	dimension := int32(packet.DimensionNether)
+	if s.dimension() == packet.DimensionNether {
+		dimension = packet.DimensionEnd
+	}
+
+	if !s.transferScreen.CompareAndSwap(noTransferScreen, dimension) {
+		return
+	}
+	_ = s.Client().WritePacket(&packet.ChangeDimension{Dimension: dimension, Position: gameData.PlayerPosition})
+	_ = s.Client().WritePacket(&packet.StopSound{StopAll: true})
+	_ = s.Client().Flush()
+}
+
+// hideTransferScreen dismisses the loading screen shown by showTransferScreen by moving the client to the
+// dimension of the provided game data and spawning it.
+func (s *Session) hideTransferScreen(gameData minecraft.GameData) {
+	dimension := s.transferScreen.Swap(noTransferScreen)
+	if dimension == noTransferScreen {
+		return
+	}
+
+	if gameData.Dimension == dimension {
+		// The client ignores dimension changes to the dimension it is already in, so it is moved to
+		// another dimension first.
+		other := int32(packet.DimensionOverworld)
+		if dimension == packet.DimensionOverworld {
+			other = packet.DimensionNether
+		}
+		_ = s.Client().WritePacket(&packet.ChangeDimension{Dimension: other, Position: gameData.PlayerPosition})
+	}
+	_ = s.Client().WritePacket(&packet.ChangeDimension{Dimension: gameData.Dimension, Position: gameData.PlayerPosition})
+	_ = s.Client().WritePacket(&packet.PlayerAction{ActionType: protocol.PlayerActionDimensionChangeDone})
+	_ = s.Client().WritePacket(&packet.PlayStatus{Status: packet.PlayStatusPlayerSpawn})
+}
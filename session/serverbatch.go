@@ -0,0 +1,63 @@
+package session
+
+// maxServerBatchSize is the maximum amount of server packets collected by a serverBatch, after which they are
+// forwarded even though the server did not send a Flush packet yet.
+const maxServerBatchSize = 512
+
+// serverBatch collects the packets read from the server up to the next Flush packet if opts.BatchServerPackets
+// is enabled, so that they are passed to the processor's ProcessServerBatch hook and forwarded to the client as
+// a unit. Spectrum packets other than Latency forward the collected packets first to keep their order.
+type serverBatch struct {
+	s         *Session
+	forwarder *forwarder
+	contexts  []*PacketContext
+}
+
+// add adds the context of a server packet to the batch, forwarding the batch if it is full.
+func (b *serverBatch) add(ctx *PacketContext) error {
+	b.contexts = append(b.contexts, ctx)
+	if len(b.contexts) >= maxServerBatchSize {
+		return b.forward()
+	}
+	return nil
+}
+
+// forward passes the packets of the batch the processor subscribed to to the processor's ProcessServerBatch hook
+// and writes the packets that were not cancelled to the client. It does nothing if the batch is nil or empty.
+func (b *serverBatch) forward() error {
+	if b == nil || len(b.contexts) == 0 {
+		return nil
+	}
+
+	s, contexts := b.s, b.contexts
+	b.contexts = nil
+	subs := s.processorSubscriptions()
+	return b.forwarder.forward(func() {
+		if batch := subscribedServerBatch(subs.server, contexts); len(batch) > 0 {
+			s.hooks().ProcessServerBatch(batch)
+		}
+	}, func() error {
+		defer func() {
+			for _, ctx := range contexts {
+				ReturnPacketContext(ctx)
+			}
+		}()
+
+		for _, ctx := range contexts {
+			if ctx.Cancelled() {
+				continue
+			}
+
+			var err error
+			if payload := ctx.Payload(); payload != nil {
+				err = writeServerPayload(s, ctx, payload)
+			} else {
+				err = writeServerPacket(s, ctx, ctx.Packet())
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -5,17 +5,24 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"slices"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/cooldogedev/spectrum/metrics"
 	"github.com/cooldogedev/spectrum/server"
 	"github.com/cooldogedev/spectrum/session/animation"
+	"github.com/cooldogedev/spectrum/tracing"
 	"github.com/cooldogedev/spectrum/transport"
 	"github.com/cooldogedev/spectrum/util"
 	"github.com/sandertv/gophertunnel/minecraft"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Session represents a player session within the proxy, managing client and server interactions,
@@ -24,12 +31,18 @@ type Session struct {
 	ctx        context.Context
 	cancelFunc context.CancelCauseFunc
 
-	client *minecraft.Conn
+	// client is the connection of the client, which is replaced when a dropped client reattaches.
+	client atomic.Pointer[minecraft.Conn]
 
 	serverAddr string
 	serverConn *server.Conn
 	serverMu   sync.RWMutex
 
+	// connectedAddr is the address of the server the session last spawned on, as reported to a discovery
+	// implementing server.ConnectionObserver.
+	connectedAddr string
+	connectedMu   sync.Mutex
+
 	logger   *slog.Logger
 	registry *Registry
 
@@ -37,23 +50,127 @@ type Session struct {
 	opts      util.Opts
 	transport transport.Transport
 
+	// serverRegistry is the registry of servers the session dials, and whose health is checked before transferring,
+	// or nil if no registry was set.
+	serverRegistry *server.Registry
+
 	animation animation.Animation
-	tracker   *tracker
+	tracker   *Tracker
+
+	processor     Processor
+	subscriptions subscriptions
+	processorMu   sync.RWMutex
+
+	// decodeFailures is the amount of client packets that failed to decode. It is only accessed by handleClient.
+	decodeFailures int
+
+	batchObserver atomic.Pointer[batchObserver]
+	logSampling   atomic.Pointer[map[uint32]float64]
+	// clientDecodeIDs and serverDecodeIDs hold the decode lists set using SetClientDecode and SetServerDecode, or
+	// nil if the lists of the options are used.
+	clientDecodeIDs atomic.Pointer[map[uint32]struct{}]
+	serverDecodeIDs atomic.Pointer[map[uint32]struct{}]
+	filters         atomic.Pointer[filterSet]
+
+	history   []TransferRecord
+	historyMu sync.Mutex
 
-	processor   Processor
-	processorMu sync.RWMutex
+	transferID atomic.Uint64
+	// lastTransfer is the time the latest transfer subject to opts.TransferCooldown started at in Unix nanoseconds.
+	lastTransfer    atomic.Int64
+	transferTarget  string
+	transferPayload []byte
+	transferTimer   *time.Timer
+	transferMu      sync.Mutex
 
-	cache      atomic.Value
+	gameData atomic.Pointer[minecraft.GameData]
+	// shieldID is the runtime ID of the shield in the item registry of the client, which client packets are
+	// decoded with. It changes if a server sends a new ItemRegistry packet and when the session transfers to a
+	// server with a different item registry.
+	shieldID atomic.Int32
+	cache    atomic.Pointer[cacheState]
+	// cacheSlots holds the named cache slots of the session by their name. The map is replaced on every update.
+	cacheSlots atomic.Pointer[map[string]*cacheState]
+	cacheMu    sync.Mutex
+	createdAt  time.Time
+	joinedAt   atomic.Int64
 	latency    atomic.Int64
 	inFallback atomic.Bool
 	once       sync.Once
+	// closing is set once the session started closing, after which a lost client is no longer resumable.
+	closing atomic.Bool
+	// reattached is closed once a new client reattached to the session after its client was lost. It is nil
+	// while the session is attached to a client.
+	reattached chan struct{}
+	resumeMu   sync.Mutex
+
+	// forwarding is held by handleClient while a client batch is being forwarded to the server.
+	forwarding chan struct{}
+	// transferScreen is the temporary dimension the client was moved to by showTransferScreen, or
+	// noTransferScreen if no transfer screen is shown.
+	transferScreen atomic.Int32
+
+	metrics   sessionMetrics
+	stats     packetStats
+	bandwidth bandwidth
+	// clientThrottle and serverThrottle limit the rate at which bytes are read from the client and servers.
+	// They are nil if no limit is configured.
+	clientThrottle *tokenBucket
+	serverThrottle *tokenBucket
+
+	tracer        trace.Tracer
+	tokenProvider server.TokenProvider
+	eventBus      *EventBus
+	// entities translates the entity IDs of servers to unique IDs on the client. It is nil unless
+	// opts.TranslateEntityIDs is enabled.
+	entities *entityIDs
+	// flusher coalesces the client flushes requested by the server. It is nil unless opts.FlushCoalesceWindow is
+	// set.
+	flusher *flushCoalescer
+	// batcher batches the server packets written to the client. It is nil unless opts.ClientBatchSize or
+	// opts.ClientBatchDelay is set.
+	batcher *clientBatcher
+	// registries holds the registry packets sent to the client. It is nil unless opts.CacheRegistries is enabled.
+	registries *registryCache
+	// migrationStore is the store the state of the session is saved to by Migrate and resumed from during login.
+	migrationStore MigrationStore
+	// firstFlush is the span started once a transfer completed, which ends with the first flush requested by
+	// the new server.
+	firstFlush atomic.Pointer[trace.Span]
+
+	goroutines      atomic.Int32
+	clientForwarder atomic.Pointer[forwarder]
+	serverForwarder atomic.Pointer[forwarder]
+	// pendingSpawn is set by a two-phase transfer once its connection replaced the server connection. It is called by
+	// handleServer before reading from the new connection, which spawns the player on the new server.
+	pendingSpawn atomic.Pointer[func()]
 }
 
+// clientBatchFlushTimeout is the maximum duration a clean close waits for a client batch to be forwarded
+// when opts.FlushClientOnClose is enabled.
+const clientBatchFlushTimeout = time.Second
+
+const (
+	// fallbackBackoff is the delay before trying the second server of a fallback chain, which doubles for every
+	// server tried afterwards.
+	fallbackBackoff = 250 * time.Millisecond
+	// maxFallbackBackoff is the maximum delay between trying two servers of a fallback chain.
+	maxFallbackBackoff = 5 * time.Second
+	// defaultTransferRetryBackoff is the delay before retrying a failed transfer if opts.TransferRetryBackoff is
+	// zero, which doubles for every retry.
+	defaultTransferRetryBackoff = 500 * time.Millisecond
+	// maxTransferRetryBackoff is the maximum delay before retrying a failed transfer.
+	maxTransferRetryBackoff = 10 * time.Second
+	// prepareTransferTimeout is the maximum duration the connection sequence of a two-phase transfer may take.
+	prepareTransferTimeout = 30 * time.Second
+	// staleChunkTimeout is the duration the server a session was seamlessly transferred to has to send the chunks
+	// the client still holds from the previous server, after which the remaining chunks are unloaded.
+	staleChunkTimeout = 5 * time.Second
+)
+
 // NewSession creates a new Session instance using the provided minecraft.Conn.
 func NewSession(client *minecraft.Conn, logger *slog.Logger, registry *Registry, discovery server.Discovery, opts util.Opts, transport transport.Transport) *Session {
 	s := &Session{
-		client: client,
-
 		logger:   logger,
 		registry: registry,
 
@@ -64,10 +181,39 @@ func NewSession(client *minecraft.Conn, logger *slog.Logger, registry *Registry,
 		processor: NopProcessor{},
 
 		animation: &animation.Dimension{},
-		tracker:   newTracker(),
+		tracker:   newTracker(opts.CacheChunks, opts.ResumeWindow > 0),
+
+		createdAt:  time.Now(),
+		forwarding: make(chan struct{}, 1),
+		tracer:     tracing.Tracer(nil),
+	}
+	s.ctx, s.cancelFunc = context.WithCancelCause(context.Background())
+	s.client.Store(client)
+	s.watchClient(client)
+	if opts.TranslateEntityIDs {
+		s.entities = newEntityIDs()
+	}
+	if opts.FlushCoalesceWindow > 0 {
+		s.flusher = &flushCoalescer{s: s, window: opts.FlushCoalesceWindow}
+	}
+	if opts.ClientBatchSize > 0 || opts.ClientBatchDelay > 0 {
+		s.batcher = &clientBatcher{s: s, size: opts.ClientBatchSize, delay: opts.ClientBatchDelay}
+	}
+	if opts.CacheRegistries {
+		s.registries = newRegistryCache()
+	}
+	if opts.ClientBandwidthLimit > 0 {
+		s.clientThrottle = newTokenBucket(opts.ClientBandwidthLimit)
+	}
+	if opts.ServerBandwidthLimit > 0 {
+		s.serverThrottle = newTokenBucket(opts.ServerBandwidthLimit)
 	}
-	s.ctx, s.cancelFunc = context.WithCancelCause(client.Context())
-	s.cache.Store([]byte(nil))
+	if len(opts.FilterRules) > 0 {
+		s.setConfiguredFilterRules()
+	}
+	s.cache.Store(&cacheState{})
+	s.cacheSlots.Store(&map[string]*cacheState{})
+	s.transferScreen.Store(noTransferScreen)
 	return s
 }
 
@@ -89,14 +235,41 @@ func (s *Session) LoginTimeout(duration time.Duration) (err error) {
 // establishing a connection, and spawning the player in the game. The process is performed
 // using the provided context for cancellation.
 func (s *Session) LoginContext(ctx context.Context) (err error) {
-	identityData := s.client.IdentityData()
-	serverAddr, err := s.discovery.Discover(s.client)
-	if err != nil {
+	ctx, span := s.tracer.Start(ctx, "spectrum.login")
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	identityData := s.Client().IdentityData()
+	if protocolID := s.Client().Proto().ID(); len(s.opts.SupportedProtocols) > 0 && !slices.Contains(s.opts.SupportedProtocols, protocolID) {
+		s.logger.Debug("unsupported protocol", "protocol", protocolID)
+		return errors.New(s.opts.UnsupportedProtocolMessage)
+	}
+
+	processorCtx := NewContext()
+	s.hooks().ProcessLogin(processorCtx, identityData, s.Client().ClientData())
+	if processorCtx.Cancelled() {
+		s.logger.Debug("login rejected by processor")
+		return errors.New("login rejected")
+	}
+
+	var serverAddr string
+	if state, ok := s.resume(ctx); ok {
+		s.logger.Debug("resuming migrated session", "server", state.Server, "token", state.Token)
+		s.setCache("", state.Cache, state.CacheCompressed, state.CacheVersion)
+		for _, slot := range state.CacheSlots {
+			s.setCache(slot.Name, slot.Cache, slot.Compressed, slot.Version)
+		}
+		serverAddr = state.Server
+	} else if serverAddr, err = s.discovery.Discover(s.Client()); err != nil {
 		s.logger.Debug("discovery failed", "err", err)
 		return err
 	}
 
-	conn, err := s.dial(ctx, serverAddr)
+	span.SetAttributes(attribute.String("server", serverAddr))
+	dialCtx, dialSpan := s.tracer.Start(ctx, "spectrum.dial")
+	conn, err := s.dial(dialCtx, serverAddr)
+	tracing.End(dialSpan, err)
 	if err != nil {
 		s.logger.Debug("dialer failed", "err", err)
 		return err
@@ -105,39 +278,73 @@ func (s *Session) LoginContext(ctx context.Context) (err error) {
 	go handleServer(s)
 	go handleClient(s)
 	go handleLatency(s, s.opts.LatencyInterval)
+	connectCtx, connectSpan := s.tracer.Start(ctx, "spectrum.connect")
 	if err := conn.DoConnect(); err != nil {
+		tracing.End(connectSpan, err)
 		s.logger.Debug("connection sequence failed", "err", err)
 		return err
 	}
 
-	if err := conn.WaitConnect(ctx); err != nil {
+	if err := conn.WaitConnect(connectCtx); err != nil {
+		tracing.End(connectSpan, err)
 		conn.CloseWithError(fmt.Errorf("connection sequence failed: %w", err))
 		s.logger.Debug("connection sequence failed", "err", err)
 		return err
 	}
+	connectSpan.End()
 
+	_, spawnSpan := s.tracer.Start(ctx, "spectrum.spawn")
 	gameData := conn.GameData()
-	s.Processor().ProcessStartGame(NewContext(), &gameData)
-	if err := s.client.StartGame(gameData); err != nil {
+	s.hooks().ProcessStartGame(NewContext(), &gameData)
+	s.gameData.Store(&gameData)
+	if !s.opts.DisableTracker {
+		s.tracker.setGameData(gameData, gameData.EntityRuntimeID)
+	}
+	if err := s.Client().StartGame(gameData); err != nil {
+		tracing.End(spawnSpan, err)
 		s.logger.Debug("startgame sequence failed", "err", err)
 		return err
 	}
+	if s.entities != nil {
+		s.entities.reset(gameData, s.Client().GameData())
+	}
+	s.shieldID.Store(shieldID(s.Client().GameData().Items))
 
 	if err := conn.DoSpawn(); err != nil {
+		tracing.End(spawnSpan, err)
 		s.logger.Debug("spawn sequence failed", "err", err)
 		return err
 	}
+	spawnSpan.End()
+	s.joinedAt.Store(time.Now().UnixNano())
+	s.setConnectedAddr(serverAddr)
 	s.registry.AddSession(identityData.XUID, s)
+	metrics.SessionsActive.Inc()
+	s.publish(SessionStarted{Session: s, Server: serverAddr})
 	s.logger.Info("logged in session")
 	return
 }
 
 // Transfer initiates a transfer to a different server using the specified address.
 // It sets a default timeout of 1 minute for the transfer operation.
+// If opts.TransferDebounce is set, the transfer is instead scheduled to start once no other transfer was
+// requested within the debounce window, in which case Transfer returns nil and failures are only logged.
 func (s *Session) Transfer(addr string) (err error) {
+	return s.TransferPayload(addr, nil)
+}
+
+// TransferPayload initiates a transfer like Transfer, forwarding the payload passed to the target server, which
+// allows passing context such as a party ID to it. Servers that do not support packet.FeatureTransferPayload do
+// not receive the payload.
+func (s *Session) TransferPayload(addr string, payload []byte) (err error) {
+	if s.opts.TransferDebounce > 0 {
+		s.debounceTransfer(addr, payload)
+		return nil
+	}
+
 	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
 	defer cancel()
-	return s.TransferContext(ctx, addr)
+	return s.transfer(ctx, addr, payload, 0, true)
 }
 
 // TransferTimeout initiates a transfer to a different server using the specified address
@@ -148,52 +355,388 @@ func (s *Session) TransferTimeout(addr string, duration time.Duration) (err erro
 	return s.TransferContext(ctx, addr)
 }
 
-// TransferContext initiates a transfer to a different server using the specified address. It ensures that only one transfer
-// occurs at a time, returning an error if another transfer is already in progress.
-// The process is performed using the provided context for cancellation.
+// TransferContext initiates a transfer to a different server using the specified address. Starting a new transfer
+// supersedes a transfer that is still in progress, in which case ProcessTransferFailure is not called for the
+// superseded transfer. If opts.TransferRetries is set, a failed transfer is retried in the background even if an
+// error is returned. The process is performed using the provided context for cancellation.
 func (s *Session) TransferContext(ctx context.Context, addr string) (err error) {
+	return s.transfer(ctx, addr, nil, 0, true)
+}
+
+// transfer transfers the session to the server at addr, forwarding the payload passed to it. attempt is the amount
+// of times the transfer was retried, and cooldown specifies whether the transfer is subject to
+// opts.TransferCooldown, which retries and fallbacks are not.
+func (s *Session) transfer(ctx context.Context, addr string, payload []byte, attempt int, cooldown bool) (err error) {
+	if cooldown {
+		if err := s.checkTransferCooldown(addr); err != nil {
+			s.logger.Debug("rejected transfer", "target", addr, "err", err)
+			s.hooks().ProcessTransferRejected(NewContext(), addr, err)
+			return err
+		}
+	}
+
+	id := s.transferID.Add(1)
 	s.serverMu.RLock()
 	origin := s.serverAddr
 	s.serverMu.RUnlock()
+	ctx, span := s.tracer.Start(ctx, "spectrum.transfer", trace.WithAttributes(attribute.String("origin", origin), attribute.String("target", addr)))
 	processorCtx := NewContext()
-	s.Processor().ProcessPreTransfer(processorCtx, &origin, &addr)
+	s.hooks().ProcessPreTransfer(processorCtx, &origin, &addr)
 	if processorCtx.Cancelled() {
-		return errors.New("processor failed")
+		err := errors.New("processor failed")
+		tracing.End(span, err)
+		return err
+	}
+
+	if s.serverRegistry != nil && !s.serverRegistry.Healthy(addr) {
+		err := fmt.Errorf("server %s is unhealthy", addr)
+		tracing.End(span, err)
+		return err
 	}
 
 	s.sendMetadata(true)
-	conn, err := s.dial(ctx, addr)
+	if s.opts.ShowTransferScreen {
+		s.showTransferScreen()
+	}
+
+	dialCtx, dialSpan := s.tracer.Start(ctx, "spectrum.dial")
+	var conn *server.Conn
+	if s.opts.TwoPhaseTransfer {
+		conn, err = s.newServerConn(dialCtx, addr)
+	} else {
+		conn, err = s.dial(dialCtx, addr)
+	}
+	tracing.End(dialSpan, err)
 	if err != nil {
-		s.Processor().ProcessTransferFailure(NewContext(), &origin, &addr)
-		return fmt.Errorf("dialer failed: %w", err)
+		err = fmt.Errorf("dialer failed: %w", err)
+		s.transferFailed(origin, addr, payload, id, attempt)
+		tracing.End(span, err)
+		return err
 	}
 
+	_, connectSpan := s.tracer.Start(ctx, "spectrum.connect")
+	conn.SetTransferPayload(payload)
 	if err := conn.DoConnect(); err != nil {
-		s.Processor().ProcessTransferFailure(NewContext(), &origin, &addr)
-		return fmt.Errorf("connection sequence failed failed: %w", err)
+		err = fmt.Errorf("connection sequence failed failed: %w", err)
+		if s.opts.TwoPhaseTransfer {
+			_ = conn.CloseWithError(err)
+		}
+		s.transferFailed(origin, addr, payload, id, attempt)
+		tracing.End(connectSpan, err)
+		tracing.End(span, err)
+		return err
 	}
 
-	conn.OnConnect(func(err error) {
+	complete := func(err error) {
+		tracing.End(connectSpan, err)
 		if err != nil {
-			s.Processor().ProcessTransferFailure(NewContext(), &origin, &addr)
+			if s.transferID.Load() != id {
+				s.logger.Debug("transfer superseded", "origin", origin, "target", addr)
+				tracing.End(span, errors.New("transfer superseded"))
+				return
+			}
+			s.transferFailed(origin, addr, payload, id, attempt)
+			tracing.End(span, err)
 			return
 		}
 
+		_, spawnSpan := s.tracer.Start(ctx, "spectrum.spawn")
 		gameData := conn.GameData()
-		s.animation.Play(s.client, gameData)
-		s.sendGameData(conn.GameData())
+		seamless := s.opts.SeamlessTransfer && s.dimension() == gameData.Dimension
+		if !seamless {
+			s.animation.Play(s.Client(), gameData)
+		}
+		_, gameDataSpan := s.tracer.Start(ctx, "spectrum.apply_game_data")
+		s.sendGameData(conn.GameData(), seamless)
+		gameDataSpan.End()
 		if err := conn.DoSpawn(); err != nil {
-			s.Processor().ProcessTransferFailure(NewContext(), &origin, &addr)
+			s.transferFailed(origin, addr, payload, id, attempt)
+			tracing.End(spawnSpan, err)
+			tracing.End(span, err)
 			return
 		}
-		s.inFallback.Store(false)
-		s.animation.Clear(s.client, gameData)
-		s.Processor().ProcessPostTransfer(NewContext(), &origin, &addr)
+		spawnSpan.End()
+		s.gameData.Store(&gameData)
+		s.shieldID.Store(shieldID(gameData.Items))
+		s.setConnectedAddr(addr)
+		s.recordTransfer(origin, addr, s.inFallback.Swap(false))
+		s.countTransfer()
+		s.hideTransferScreen(gameData)
+		if !seamless {
+			s.animation.Clear(s.Client(), gameData)
+		} else if !s.opts.DisableTracker {
+			time.AfterFunc(staleChunkTimeout, func() {
+				if s.ctx.Err() == nil && s.transferID.Load() == id {
+					s.tracker.unloadStaleChunks(s, gameData.Dimension)
+				}
+			})
+		}
+		s.hooks().ProcessPostTransfer(NewContext(), &origin, &addr)
+		_, firstFlushSpan := s.tracer.Start(ctx, "spectrum.first_flush")
+		if previous := s.firstFlush.Swap(&firstFlushSpan); previous != nil {
+			(*previous).End()
+		}
+		span.End()
 		s.logger.Debug("transferred session", "origin", origin, "target", addr)
-	})
+	}
+	if s.opts.TwoPhaseTransfer {
+		go s.prepareTransfer(conn, addr, id, complete)
+	} else {
+		conn.OnConnect(complete)
+	}
 	return nil
 }
 
+// prepareTransfer drives the connection sequence of a two-phase transfer while the session keeps playing on its
+// current server, buffering the packets the target sends meanwhile. Once connected, the connection atomically
+// replaces the current server connection, which is closed, and complete is called on the goroutine reading from
+// the server to spawn the player, after which the buffered packets are forwarded.
+func (s *Session) prepareTransfer(conn *server.Conn, addr string, id uint64, complete func(err error)) {
+	ctx, cancel := context.WithTimeout(s.ctx, prepareTransferTimeout)
+	defer cancel()
+	if err := conn.Prepare(ctx); err != nil {
+		_ = conn.CloseWithError(err)
+		if s.ctx.Err() == nil {
+			complete(err)
+		}
+		return
+	}
+
+	s.serverMu.Lock()
+	if s.transferID.Load() != id {
+		s.serverMu.Unlock()
+		err := errors.New("transfer superseded")
+		_ = conn.CloseWithError(err)
+		complete(err)
+		return
+	}
+
+	previous := s.serverConn
+	spawn := func() { complete(nil) }
+	s.pendingSpawn.Store(&spawn)
+	s.serverAddr, s.serverConn = addr, conn
+	s.serverMu.Unlock()
+	if previous != nil {
+		_ = previous.CloseWithError(fmt.Errorf("transferred to %s", addr))
+	}
+}
+
+// transferFailed handles a transfer from origin to addr that failed, retrying it if opts.TransferRetries allows.
+// id is the ID of the failed transfer and attempt the amount of times it was retried already.
+func (s *Session) transferFailed(origin string, addr string, payload []byte, id uint64, attempt int) {
+	s.countTransferFailure()
+	s.hideTransferScreen(s.GameData())
+	s.hooks().ProcessTransferFailure(NewContext(), &origin, &addr)
+	if attempt < s.opts.TransferRetries {
+		s.retryTransfer(addr, payload, id, attempt+1)
+	}
+}
+
+// TransferCooldownError is returned for transfers requested within opts.TransferCooldown of the previous transfer.
+type TransferCooldownError struct {
+	// Target is the address of the server the rejected transfer targeted.
+	Target string
+	// Remaining is the duration after which transfers are accepted again.
+	Remaining time.Duration
+}
+
+// Error ...
+func (e *TransferCooldownError) Error() string {
+	return fmt.Sprintf("transfer to %s rejected: transfers are on cooldown for %s", e.Target, e.Remaining)
+}
+
+// checkTransferCooldown returns a *TransferCooldownError if the previous transfer started less than
+// opts.TransferCooldown ago. Otherwise, the current time is recorded as the start of the latest transfer.
+func (s *Session) checkTransferCooldown(addr string) error {
+	cooldown := s.opts.TransferCooldown
+	if cooldown <= 0 {
+		return nil
+	}
+
+	for {
+		last, now := s.lastTransfer.Load(), time.Now().UnixNano()
+		if elapsed := time.Duration(now - last); last != 0 && elapsed < cooldown {
+			return &TransferCooldownError{Target: addr, Remaining: cooldown - elapsed}
+		}
+		if s.lastTransfer.CompareAndSwap(last, now) {
+			return nil
+		}
+	}
+}
+
+// retryTransfer retries a failed transfer to addr after a delay that starts at opts.TransferRetryBackoff and doubles
+// with every attempt. The retry is dropped if another transfer was started in the meantime.
+func (s *Session) retryTransfer(addr string, payload []byte, id uint64, attempt int) {
+	delay := s.opts.TransferRetryBackoff
+	if delay <= 0 {
+		delay = defaultTransferRetryBackoff
+	}
+	for i := 1; i < attempt && delay < maxTransferRetryBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxTransferRetryBackoff)
+	s.logger.Debug("retrying transfer", "target", addr, "attempt", attempt, "delay", delay)
+	time.AfterFunc(delay, func() {
+		if s.ctx.Err() != nil || s.transferID.Load() != id {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+		defer cancel()
+		if err := s.transfer(ctx, addr, payload, attempt, false); err != nil {
+			logError(s, "failed to retry transfer", err)
+		}
+	})
+}
+
+// TimeInCurrentServer returns the amount of time the session has spent on its current server. Both transfers
+// and fallbacks are treated as server changes. It returns zero if the session has not spawned on a server yet.
+func (s *Session) TimeInCurrentServer() time.Duration {
+	joinedAt := s.joinedAt.Load()
+	if joinedAt == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, joinedAt))
+}
+
+// Uptime returns the amount of time that passed since the session was created.
+func (s *Session) Uptime() time.Duration {
+	return time.Since(s.createdAt)
+}
+
+// ServerAddr returns the address of the server the session is currently connected to, or is being connected to
+// during login.
+func (s *Session) ServerAddr() string {
+	s.serverMu.RLock()
+	defer s.serverMu.RUnlock()
+	return s.serverAddr
+}
+
+// TransferHistory returns the server changes the session went through, ordered from oldest to newest.
+// Only the most recent server changes are kept.
+func (s *Session) TransferHistory() []TransferRecord {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	return slices.Clone(s.history)
+}
+
+// Tracker returns the tracker of the session, which tracks the state servers create on the client.
+func (s *Session) Tracker() *Tracker {
+	return s.tracker
+}
+
+// dimension returns the dimension the client is currently in, falling back to the dimension of the server's game
+// data if opts.DisableTracker is enabled.
+func (s *Session) dimension() int32 {
+	if s.opts.DisableTracker {
+		return s.GameData().Dimension
+	}
+	return s.tracker.Dimension()
+}
+
+// shieldID returns the runtime ID of the shield in the item registry passed, or zero if it has none.
+func shieldID(items []protocol.ItemEntry) int32 {
+	for _, item := range items {
+		if item.Name == "minecraft:shield" {
+			return int32(item.RuntimeID)
+		}
+	}
+	return 0
+}
+
+// GameData returns a copy of the game data of the server the session is currently on. It is set once the login
+// sequence sent the StartGame packet to the client, including changes made by ProcessStartGame, and replaced once
+// a transfer completes. It does not reflect changes made by packets sent afterwards, such as a ChangeDimension or
+// GameRulesChanged packet. Before login completes, the client's game data is returned.
+func (s *Session) GameData() minecraft.GameData {
+	if gameData := s.gameData.Load(); gameData != nil {
+		return *gameData
+	}
+	return s.Client().GameData()
+}
+
+// ResendChunk writes the most recent LevelChunk packet sent by the server for the chunk at the given chunk
+// coordinates to the client again, which may be used to fill holes left by chunks the client missed.
+// The chunk is only known if opts.CacheChunks is enabled, the tracker is not disabled and the server sent
+// the LevelChunk packet decoded, since the tracker never sees packets forwarded as raw payloads.
+func (s *Session) ResendChunk(x, z int32) error {
+	if s.opts.DisableTracker || !s.opts.CacheChunks {
+		return errors.New("chunk caching is disabled")
+	}
+
+	s.tracker.mu.Lock()
+	chunk, ok := s.tracker.chunks[protocol.ChunkPos{x, z}]
+	s.tracker.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("chunk %d, %d is not cached", x, z)
+	}
+	return s.Client().WritePacket(chunk)
+}
+
+// SetTracerProvider sets the provider of the tracer used to record spans for the login, transfer and fallback
+// flows of the session. It should be set before Login is called to record the login.
+func (s *Session) SetTracerProvider(provider trace.TracerProvider) {
+	s.tracer = tracing.Tracer(provider)
+}
+
+// SetServerRegistry sets the registry of servers the session refuses to transfer to while they are unhealthy.
+// Servers registered with a Transport are dialed using it instead of the transport of the session.
+// When the server the session is connected to is removed from the registry, ProcessServerRemoved is called and
+// the session falls back to another server unless the context is canceled. It should be set at most once.
+func (s *Session) SetServerRegistry(registry *server.Registry) {
+	s.serverRegistry = registry
+	if registry != nil {
+		events, unsubscribe := registry.Subscribe()
+		go s.watchServerRegistry(events, unsubscribe)
+	}
+}
+
+// watchServerRegistry handles the changes made to the server registry until the session is closed.
+func (s *Session) watchServerRegistry(events <-chan server.RegistryEvent, unsubscribe func()) {
+	defer s.trackGoroutine()()
+	defer unsubscribe()
+	for {
+		select {
+		case event := <-events:
+			if event.Type != server.ServerRemoved {
+				continue
+			}
+
+			s.connectedMu.Lock()
+			connected := s.connectedAddr == event.Server.Addr
+			s.connectedMu.Unlock()
+			if !connected {
+				continue
+			}
+
+			ctx := NewContext()
+			s.hooks().ProcessServerRemoved(ctx, event.Server.Addr)
+			if ctx.Cancelled() {
+				continue
+			}
+
+			s.logger.Debug("server was removed, falling back", "addr", event.Server.Addr)
+			if err := s.fallback(); err != nil {
+				s.logger.Debug("fallback failed", "err", err)
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// SetEventBus sets the event bus the session publishes its lifecycle events to. It must be set before Login
+// is called for SessionStarted to be published.
+func (s *Session) SetEventBus(bus *EventBus) {
+	s.eventBus = bus
+}
+
+// SetTokenProvider sets the token provider used to authenticate the proxy to servers dialed afterwards. When nil,
+// no token is presented.
+func (s *Session) SetTokenProvider(provider server.TokenProvider) {
+	s.tokenProvider = provider
+}
+
 // Animation returns the animation set to be played during server transfers.
 func (s *Session) Animation() animation.Animation {
 	return s.animation
@@ -204,44 +747,162 @@ func (s *Session) SetAnimation(animation animation.Animation) {
 	s.animation = animation
 }
 
-// Cache returns the current session cache.
+// Cache returns the current session cache. Caches compressed by the server or because opts.CompressCache is
+// enabled are decompressed every time Cache is called.
 func (s *Session) Cache() []byte {
-	return s.cache.Load().([]byte)
+	cache, err := s.cache.Load().decompressed()
+	if err != nil {
+		s.logger.Error("failed to decompress cache", "err", err)
+		return nil
+	}
+	return cache
 }
 
-// SetCache updates the session cache.
+// CacheVersion returns the version of the session cache set by the server that last updated it, which is zero
+// if the cache was never updated or was set using SetCache.
+func (s *Session) CacheVersion() uint64 {
+	return s.cache.Load().version
+}
+
+// SetCache updates the session cache, resetting its version to zero.
 func (s *Session) SetCache(cache []byte) {
-	ctx := NewContext()
-	s.Processor().ProcessCache(ctx, &cache)
-	if !ctx.Cancelled() {
-		s.cache.Store(cache)
+	s.setCache("", cache, false, 0)
+}
+
+// CacheSlot returns the cache held in the named cache slot passed, or nil if the slot does not exist. Slots are
+// maintained by servers using UpdateCache packets addressed to them, in addition to the default cache returned by
+// Cache. An empty name returns the default cache.
+func (s *Session) CacheSlot(name string) []byte {
+	cache, err := s.cacheSlot(name).decompressed()
+	if err != nil {
+		s.logger.Error("failed to decompress cache", "slot", name, "err", err)
+		return nil
+	}
+	return cache
+}
+
+// SetCacheSlot updates the named cache slot passed, resetting its version to zero. The slot is removed if the cache
+// is empty. Unlike SetCache, ProcessCache is not called for named slots.
+func (s *Session) SetCacheSlot(name string, cache []byte) {
+	s.setCache(name, cache, false, 0)
+}
+
+// setCache updates the cache slot with the name passed and its version. compressed specifies whether the cache
+// passed is compressed using zstd.
+func (s *Session) setCache(name string, cache []byte, compressed bool, version uint64) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.storeCache(name, cache, compressed, version)
+}
+
+// ObserveRawClientBatch registers a function that is called with every batch read from the client in its wire form
+// after it was decrypted, before it is decompressed and before any of its packets are decoded or processed. The
+// batch is prefixed with the ID of its compression algorithm, like on the wire. Batches are only available in their
+// compressed form if the client was accepted on a listener using a compression returned by ObserveCompression, as
+// Spectrum.Listen does, and are otherwise passed uncompressed, which decodes to the same packets.
+// The function is called asynchronously and receives a copy of the batch that it may retain. If the function
+// cannot keep up, batches are dropped instead of stalling the client's read loop. Passing nil removes the observer.
+func (s *Session) ObserveRawClientBatch(fn func([]byte)) {
+	if fn == nil {
+		if observer := s.batchObserver.Swap(nil); observer != nil {
+			observer.close()
+		}
+		return
+	}
+
+	observer := newBatchObserver(fn)
+	if previous := s.batchObserver.Swap(observer); previous != nil {
+		previous.close()
 	}
+	go observer.run(s.ctx)
 }
 
 // Processor returns the current processor.
 func (s *Session) Processor() Processor {
-	s.processorMu.RLock()
-	defer s.processorMu.RUnlock()
-	return s.processor
+	processor := s.hooks()
+	if p, ok := processor.(*timeoutProcessor); ok {
+		return p.Processor
+	}
+	return processor
 }
 
-// SetProcessor sets a new processor for the session.
+// SetProcessor sets a new processor for the session, replacing any processors added using AddProcessor.
+// If opts.ProcessorTimeout is set, the processor's hooks are run with that timeout. If the processor implements
+// PacketSubscriber, its subscriptions are read once here.
 func (s *Session) SetProcessor(processor Processor) {
 	s.processorMu.Lock()
-	s.processor = processor
+	s.setProcessor(processor)
 	s.processorMu.Unlock()
 }
 
+// AddProcessor adds a processor to the chain of processors of the session. Processors with a higher priority
+// run first, processors with the same priority run in the order they were added. Every processor of the chain
+// is passed the same contexts, so cancellation or modification by one processor is visible to the next. A
+// processor set using SetProcessor becomes part of the chain with a priority of zero. The ProcessResourcePacks
+// hook of processors in the chain is never called, as resource packs are offered before the session exists.
+func (s *Session) AddProcessor(processor Processor, priority int) {
+	s.processorMu.Lock()
+	defer s.processorMu.Unlock()
+	current := s.processor
+	if p, ok := current.(*timeoutProcessor); ok {
+		current = p.Processor
+	}
+
+	switch current := current.(type) {
+	case NopProcessor:
+		s.setProcessor((&processorChain{}).with(processor, priority))
+	case *processorChain:
+		s.setProcessor(current.with(processor, priority))
+	default:
+		s.setProcessor((&processorChain{}).with(current, 0).with(processor, priority))
+	}
+}
+
+// setProcessor sets the processor and its subscriptions. The caller must hold processorMu. NopProcessor is never
+// wrapped with a timeoutProcessor, so that sessions without a processor can still forward batches unchanged.
+func (s *Session) setProcessor(processor Processor) {
+	s.subscriptions = newSubscriptions(processor)
+	if _, ok := processor.(NopProcessor); !ok && s.opts.ProcessorTimeout > 0 {
+		processor = &timeoutProcessor{Processor: processor, s: s, timeout: s.opts.ProcessorTimeout}
+	}
+	s.processor = processor
+}
+
 // Latency returns the total latency experienced by the session, combining client and server latencies.
 // The client's latency is derived from half of RakNet's round-trip time (RTT).
-// To calculate the total latency, we multiply this value by 2.
+// To calculate the total latency, we multiply this value by opts.LatencyMultiplier, which defaults to 2.
 func (s *Session) Latency() int64 {
-	return (s.client.Latency().Milliseconds() * 2) + s.latency.Load()
+	return s.clientLatency() + s.latency.Load()
+}
+
+// clientLatency returns the client's latency in milliseconds, multiplied by opts.LatencyMultiplier.
+func (s *Session) clientLatency() int64 {
+	return multiplyLatency(s.Client().Latency(), s.opts.LatencyMultiplier)
+}
+
+// multiplyLatency returns the latency in milliseconds multiplied by the multiplier, which defaults to 2 if it is
+// not positive.
+func multiplyLatency(latency time.Duration, multiplier float64) int64 {
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	return int64(float64(latency.Milliseconds()) * multiplier)
+}
+
+// JoinGroup adds the session to the named group, allowing it to receive packets sent through
+// Registry.BroadcastToGroup. The session is removed from all of its groups once it is closed.
+func (s *Session) JoinGroup(name string) {
+	s.registry.joinGroup(name, s)
+}
+
+// LeaveGroup removes the session from the named group.
+func (s *Session) LeaveGroup(name string) {
+	s.registry.leaveGroup(name, s)
 }
 
 // Client returns the client connection.
 func (s *Session) Client() *minecraft.Conn {
-	return s.client
+	return s.client.Load()
 }
 
 // Server returns the current server connection.
@@ -258,31 +919,177 @@ func (s *Session) Context() context.Context {
 }
 
 // Disconnect sends a packet.Disconnect to the client and closes the session.
+// If opts.FlushClientOnClose is enabled, a client batch that is still being forwarded reaches the server first.
 func (s *Session) Disconnect(message string) {
-	s.CloseWithError(errors.New(message))
+	s.close(errors.New(message), true)
+}
+
+// TransferProxy sends the client to the proxy or server at the address passed using a Transfer packet, which
+// makes the client reconnect there, and closes the session afterwards. Unlike Transfer, the client leaves
+// Spectrum, which allows evacuating players to another proxy before shutting down.
+func (s *Session) TransferProxy(addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q: %w", portStr, err)
+	}
+
+	if err := s.Client().WritePacket(&packet.Transfer{Address: host, Port: uint16(port)}); err != nil {
+		return err
+	}
+
+	if err := s.Client().Flush(); err != nil {
+		return err
+	}
+	s.close(fmt.Errorf("transferred to %s", addr), true)
+	return nil
 }
 
 // Close closes the session, including the server and client connections.
+// If opts.FlushClientOnClose is enabled, a client batch that is still being forwarded reaches the server first.
 func (s *Session) Close() (err error) {
-	s.CloseWithError(errors.New("closed by application"))
+	s.close(errors.New("closed by application"), true)
 	return nil
 }
 
+// CloseWithError sends a packet.Disconnect with the error's message to the client and closes the session,
+// including the server and client connections. Errors encountered while closing the connections are joined
+// with err using errors.Join, and the result is used as the cause of the session's context. The client is only
+// ever shown the message of err.
 func (s *Session) CloseWithError(err error) {
+	s.close(err, false)
+}
+
+// close closes the session using err as the cause. If clean is true and opts.FlushClientOnClose is enabled,
+// the server connection is closed in the background once the client batch being forwarded, if any, was written.
+func (s *Session) close(err error, clean bool) {
 	s.once.Do(func() {
-		message := err.Error()
-		s.Processor().ProcessDisconnection(NewContext(), &message)
-		_ = s.client.WritePacket(&packet.Disconnect{Message: message})
-		_ = s.client.Close()
+		s.closing.Store(true)
+		errs := []error{err}
 		if conn := s.Server(); conn != nil {
-			conn.CloseWithError(err)
+			if clean && s.opts.FlushClientOnClose {
+				go s.closeServerAfterBatch(conn, err)
+			} else if closeErr := conn.CloseWithError(err); closeErr != nil && !errors.Is(closeErr, net.ErrClosed) {
+				errs = append(errs, fmt.Errorf("failed to close server: %w", closeErr))
+			}
 		}
-		s.cancelFunc(err)
-		s.registry.RemoveSession(s.client.IdentityData().XUID)
-		s.logger.Info("closed session", "err", err)
+
+		message := err.Error()
+		if hookErr := s.processDisconnection(&message, errors.Join(errs...)); hookErr != nil {
+			errs = append(errs, hookErr)
+		}
+
+		if err := s.Client().WritePacket(&packet.Disconnect{Message: message}); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, fmt.Errorf("failed to write disconnect packet: %w", err))
+		}
+
+		if err := s.Client().Flush(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, fmt.Errorf("failed to flush client's buffer: %w", err))
+		}
+
+		if err := s.Client().Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, fmt.Errorf("failed to close client: %w", err))
+		}
+
+		cause := err
+		if len(errs) > 1 {
+			cause = errors.Join(errs...)
+		}
+		s.cancelFunc(cause)
+		s.setConnectedAddr("")
+		s.registry.leaveGroups(s)
+		s.registry.RemoveSession(s.Client().IdentityData().XUID)
+		if s.joinedAt.Load() != 0 {
+			metrics.SessionsActive.Dec()
+		}
+		s.publish(SessionClosed{Session: s, Cause: cause})
+		s.logger.Info("closed session", "err", cause)
 	})
 }
 
+// processDisconnection calls the ProcessDisconnection hook with the message the client is disconnected with,
+// attaching the errors joined while closing the server to the context so that they are returned by
+// DisconnectCause. A panic in the hook is returned as an error.
+func (s *Session) processDisconnection(message *string, cause error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing disconnection: %v", r)
+		}
+	}()
+	ctx := NewContext()
+	ctx.WithValue(disconnectCauseKey{}, cause)
+	s.hooks().ProcessDisconnection(ctx, message)
+	return nil
+}
+
+// disconnectCauseKey is the key the errors a session is closed with are attached to the context of the
+// ProcessDisconnection hook under.
+type disconnectCauseKey struct{}
+
+// DisconnectCause returns the errors the session was closed with, joined using errors.Join, from the context
+// passed to the ProcessDisconnection hook. Unlike the message of the hook, which is sent to the client, they
+// include internal errors encountered while closing the server. nil is returned for other contexts.
+func DisconnectCause(ctx *Context) error {
+	err, _ := ctx.Value(disconnectCauseKey{}).(error)
+	return err
+}
+
+// setConnectedAddr sets the address of the server the session spawned on, which is empty once the session was
+// closed, notifying the discovery if it implements server.ConnectionObserver. Servers are no longer connected to
+// once the session was closed.
+func (s *Session) setConnectedAddr(addr string) {
+	s.connectedMu.Lock()
+	defer s.connectedMu.Unlock()
+	if addr != "" && s.ctx.Err() != nil {
+		return
+	}
+
+	observer, ok := s.discovery.(server.ConnectionObserver)
+	if s.connectedAddr != "" && ok {
+		observer.ServerDisconnected(s.connectedAddr)
+	}
+	s.connectedAddr = addr
+	if addr != "" && ok {
+		observer.ServerConnected(addr)
+	}
+}
+
+// closeServerAfterBatch waits for the client batch that is being forwarded to be written to the server,
+// or for clientBatchFlushTimeout to pass, and closes the server connection afterwards.
+func (s *Session) closeServerAfterBatch(conn *server.Conn, err error) {
+	timer := time.NewTimer(clientBatchFlushTimeout)
+	defer timer.Stop()
+	select {
+	case s.forwarding <- struct{}{}:
+		<-s.forwarding
+	case <-timer.C:
+		s.logger.Debug("timed out waiting for client batch to be forwarded")
+	}
+
+	if closeErr := conn.CloseWithError(err); closeErr != nil && !errors.Is(closeErr, net.ErrClosed) {
+		s.logger.Debug("failed to close server", "err", closeErr)
+	}
+}
+
+// hooks returns the processor whose hooks are invoked by the session, which may wrap the processor
+// returned by Processor with a timeoutProcessor.
+func (s *Session) hooks() Processor {
+	s.processorMu.RLock()
+	defer s.processorMu.RUnlock()
+	return s.processor
+}
+
+// processorSubscriptions returns the packet IDs the processor returned by hooks subscribed to.
+func (s *Session) processorSubscriptions() subscriptions {
+	s.processorMu.RLock()
+	defer s.processorMu.RUnlock()
+	return s.subscriptions
+}
+
 // dial dials the specified server address and returns a new server.Conn instance.
 // The provided context is used to manage timeouts and cancellations during the dialing process.
 func (s *Session) dial(ctx context.Context, addr string) (*server.Conn, error) {
@@ -298,18 +1105,89 @@ func (s *Session) dial(ctx context.Context, addr string) (*server.Conn, error) {
 		_ = s.serverConn.Close()
 	}
 
-	conn, err := s.transport.Dial(ctx, addr)
+	c, err := s.newServerConn(ctx, addr)
 	if err != nil {
 		return nil, err
 	}
-	c := server.NewConn(conn, s.client, s.logger.With("addr", addr), s.opts.SyncProtocol, s.Cache())
 	s.serverAddr = addr
 	s.serverConn = c
 	return c, nil
 }
 
-// fallback attempts to transfer the session to a fallback server provided by the discovery.
-func (s *Session) fallback() error {
+// newServerConn dials the server at addr and creates a connection to it, without replacing the current server
+// connection of the session.
+func (s *Session) newServerConn(ctx context.Context, addr string) (*server.Conn, error) {
+	select {
+	case <-s.ctx.Done():
+		return nil, context.Cause(s.ctx)
+	default:
+	}
+
+	if s.opts.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.DialTimeout)
+		defer cancel()
+	}
+
+	dialer := s.transport
+	if s.serverRegistry != nil {
+		if t := s.serverRegistry.Transport(addr); t != nil {
+			dialer = t
+		}
+	}
+
+	conn, err := dialer.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	cache := s.cache.Load()
+	data, err := cache.decompressed()
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to decompress cache: %w", err)
+	}
+
+	c := server.NewConn(&meteredConn{ReadWriteCloser: conn, s: s}, s.Client(), s.logger.With("addr", addr), s.opts.SyncProtocol, data)
+	c.SetCacheVersion(cache.version)
+	c.SetCacheSlots(s.cacheSlotList())
+	c.SetHandshakeMetadata(s.opts.HandshakeMetadata)
+	if s.registries != nil {
+		c.SetRegistries(s.registries.hashes())
+	}
+	compression, ok := s.opts.ServerCompression[addr]
+	if !ok {
+		compression = s.opts.Compression
+	}
+
+	c.SetCompressionThreshold(s.opts.CompressionThreshold)
+	c.SetDecode(s.serverDecode())
+	if err := c.SetCompression(compression, s.opts.CompressionLevel, s.opts.ZstdDictionary); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	if s.tokenProvider != nil {
+		token, err := s.tokenProvider.Token(addr, s.Client().IdentityData())
+		if err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("failed to create token: %w", err)
+		}
+		c.SetToken(token)
+	}
+	return c, nil
+}
+
+// Fallback transfers the session to a fallback server provided by the discovery, trying every server of the
+// fallback chain if the discovery implements server.FallbackChainDiscovery. It returns an error if none of them
+// could be reached.
+func (s *Session) Fallback() error {
+	return s.fallback()
+}
+
+// fallback attempts to transfer the session to a fallback server provided by the discovery. If the discovery
+// implements server.FallbackChainDiscovery, each fallback server is tried in order, waiting an increasing
+// backoff between attempts, until one of them succeeded.
+func (s *Session) fallback() (err error) {
 	select {
 	case <-s.ctx.Done():
 		return context.Cause(s.ctx)
@@ -319,17 +1197,132 @@ func (s *Session) fallback() error {
 	if !s.inFallback.CompareAndSwap(false, true) {
 		return errors.New("already in fallback")
 	}
+	defer func() {
+		if err != nil {
+			s.inFallback.Store(false)
+		}
+	}()
+
+	ctx, span := s.tracer.Start(s.ctx, "spectrum.fallback")
+	defer func() {
+		tracing.End(span, err)
+	}()
 
-	addr, err := s.discovery.DiscoverFallback(s.client)
+	addrs, err := s.discoverFallbacks()
 	if err != nil {
 		return fmt.Errorf("discovery failed: %w", err)
 	}
 
-	s.logger.Debug("transferring session to a fallback server", "addr", addr)
-	if err := s.Transfer(addr); err != nil {
-		return fmt.Errorf("transfer failed: %w", err)
+	s.countFallback()
+	backoff := fallbackBackoff
+	var errs []error
+	for i, addr := range addrs {
+		if i > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff = min(backoff*2, maxFallbackBackoff)
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			}
+		}
+
+		span.SetAttributes(attribute.String("target", addr))
+		s.logger.Debug("transferring session to a fallback server", "addr", addr)
+		if err := s.fallbackTo(ctx, addr); err != nil {
+			s.logger.Debug("fallback server failed", "addr", addr, "err", err)
+			errs = append(errs, fmt.Errorf("transfer to %s failed: %w", addr, err))
+			continue
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// fallbackTo transfers the session to the fallback server with the address passed. Fallbacks are not subject to
+// opts.TransferCooldown, as the session has no server to stay on.
+func (s *Session) fallbackTo(ctx context.Context, addr string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	return s.transfer(ctx, addr, nil, 0, false)
+}
+
+// discoverFallbacks returns the fallback servers provided by the discovery, in the order they are tried in.
+func (s *Session) discoverFallbacks() ([]string, error) {
+	if discovery, ok := s.discovery.(server.FallbackChainDiscovery); ok {
+		addrs, err := discovery.DiscoverFallbacks(s.Client())
+		if err != nil {
+			return nil, err
+		}
+
+		if len(addrs) == 0 {
+			return nil, errors.New("no fallback servers discovered")
+		}
+		return addrs, nil
+	}
+
+	addr, err := s.discovery.DiscoverFallback(s.Client())
+	if err != nil {
+		return nil, err
+	}
+	return []string{addr}, nil
+}
+
+// debounceTransfer schedules a transfer to the address once opts.TransferDebounce has passed without another
+// transfer being requested. Requesting another transfer within the window replaces the scheduled target and payload.
+func (s *Session) debounceTransfer(addr string, payload []byte) {
+	s.transferMu.Lock()
+	defer s.transferMu.Unlock()
+	s.transferTarget, s.transferPayload = addr, payload
+	if s.transferTimer != nil {
+		s.transferTimer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(s.opts.TransferDebounce, func() {
+		s.transferMu.Lock()
+		if s.transferTimer != timer {
+			s.transferMu.Unlock()
+			return
+		}
+		target, payload := s.transferTarget, s.transferPayload
+		s.transferTimer, s.transferPayload = nil, nil
+		s.transferMu.Unlock()
+
+		ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+		defer cancel()
+		if err := s.transfer(ctx, target, payload, 0, true); err != nil {
+			logError(s, "failed to transfer", err)
+		}
+	})
+	s.transferTimer = timer
+}
+
+// recordTransfer appends a completed server change to the transfer history and resets the time spent on
+// the current server.
+func (s *Session) recordTransfer(origin string, target string, fallback bool) {
+	now := time.Now()
+	record := TransferRecord{
+		Origin:   origin,
+		Target:   target,
+		Fallback: fallback,
+		Time:     now,
+		Duration: now.Sub(time.Unix(0, s.joinedAt.Swap(now.UnixNano()))),
+	}
+
+	s.historyMu.Lock()
+	if len(s.history) == maxTransferHistory {
+		s.history = slices.Delete(s.history, 0, 1)
+	}
+	s.history = append(s.history, record)
+	s.historyMu.Unlock()
+	s.publish(TransferCompleted{Session: s, Record: record})
+}
+
+// publish publishes the event passed to the event bus of the session, if it has one.
+func (s *Session) publish(event any) {
+	if s.eventBus != nil {
+		s.eventBus.Publish(event)
 	}
-	return nil
 }
 
 func (s *Session) sendMetadata(noAI bool) {
@@ -339,44 +1332,84 @@ func (s *Session) sendMetadata(noAI bool) {
 	}
 	metadata.SetFlag(protocol.EntityDataKeyFlags, protocol.EntityDataFlagBreathing)
 	metadata.SetFlag(protocol.EntityDataKeyFlags, protocol.EntityDataFlagHasGravity)
-	_ = s.client.WritePacket(&packet.SetActorData{
-		EntityRuntimeID: s.client.GameData().EntityRuntimeID,
+	_ = s.Client().WritePacket(&packet.SetActorData{
+		EntityRuntimeID: s.Client().GameData().EntityRuntimeID,
 		EntityMetadata:  metadata,
 	})
 }
 
-func (s *Session) sendGameData(gameData minecraft.GameData) {
-	chunk := emptyChunk(gameData.Dimension)
+// sendGameData applies the game data of the server the session is transferring to on the client. Unless the
+// transfer is seamless, the chunks around the new position are replaced with empty chunks, which are hidden by the
+// dimension change of the animation. Seamless transfers keep the chunks the client holds visible until the new
+// server overwrites them, and only move the chunk publisher to the new position so that chunks out of its range are
+// unloaded. The chunks of the previous server in range that the new server does not send within staleChunkTimeout
+// are unloaded afterwards.
+func (s *Session) sendGameData(gameData minecraft.GameData, seamless bool) {
+	runtimeID := gameData.EntityRuntimeID
+	if s.entities != nil {
+		s.entities.reset(gameData, s.Client().GameData())
+		runtimeID = s.Client().GameData().EntityRuntimeID
+	}
+
 	pos := gameData.PlayerPosition
-	chunkX := int32(pos.X()) >> 4
-	chunkZ := int32(pos.Z()) >> 4
-	for x := chunkX - 4; x <= chunkX+4; x++ {
-		for z := chunkZ - 4; z <= chunkZ+4; z++ {
-			_ = s.client.WritePacket(&packet.LevelChunk{
-				Dimension:     gameData.Dimension,
-				Position:      protocol.ChunkPos{x, z},
-				SubChunkCount: 1,
-				RawPayload:    chunk,
-			})
+	var publisher *packet.NetworkChunkPublisherUpdate
+	if seamless {
+		publisher = &packet.NetworkChunkPublisherUpdate{
+			Position: protocol.BlockPos{int32(pos.X()), int32(pos.Y()), int32(pos.Z())},
+			Radius:   uint32(gameData.ChunkRadius) << 4,
+		}
+		_ = s.Client().WritePacket(publisher)
+	} else {
+		chunk := emptyChunk(gameData.Dimension)
+		chunkX := int32(pos.X()) >> 4
+		chunkZ := int32(pos.Z()) >> 4
+		for x := chunkX - 4; x <= chunkX+4; x++ {
+			for z := chunkZ - 4; z <= chunkZ+4; z++ {
+				_ = s.Client().WritePacket(&packet.LevelChunk{
+					Dimension:     gameData.Dimension,
+					Position:      protocol.ChunkPos{x, z},
+					SubChunkCount: 1,
+					RawPayload:    chunk,
+				})
+			}
 		}
 	}
-	s.tracker.mu.Lock()
-	s.tracker.clearEffects(s)
-	s.tracker.clearEntities(s)
-	s.tracker.clearBossBars(s)
-	s.tracker.clearPlayers(s)
-	s.tracker.clearScoreboards(s)
-	s.tracker.mu.Unlock()
-	_ = s.client.WritePacket(&packet.MovePlayer{
-		EntityRuntimeID: gameData.EntityRuntimeID,
+	if !s.opts.DisableTracker {
+		s.tracker.mu.Lock()
+		s.tracker.clearEffects(s)
+		s.tracker.clearBossBars(s)
+		s.tracker.clearEntities(s)
+		s.tracker.clearPlayers(s)
+		s.tracker.clearScoreboards(s)
+		s.tracker.clearChunks(publisher)
+		s.tracker.clearBlobs()
+		s.tracker.mu.Unlock()
+	}
+	_ = s.Client().WritePacket(&packet.MovePlayer{
+		EntityRuntimeID: runtimeID,
 		Position:        gameData.PlayerPosition,
 		Pitch:           gameData.Pitch,
 		Yaw:             gameData.Yaw,
 		Mode:            packet.MoveModeReset,
 	})
-	_ = s.client.WritePacket(&packet.LevelEvent{EventType: packet.LevelEventStopRaining, EventData: 10_000})
-	_ = s.client.WritePacket(&packet.LevelEvent{EventType: packet.LevelEventStopThunderstorm})
-	_ = s.client.WritePacket(&packet.SetDifficulty{Difficulty: uint32(gameData.Difficulty)})
-	_ = s.client.WritePacket(&packet.SetPlayerGameType{GameType: gameData.PlayerGameMode})
-	_ = s.client.WritePacket(&packet.GameRulesChanged{GameRules: gameData.GameRules})
+	_ = s.Client().WritePacket(&packet.LevelEvent{EventType: packet.LevelEventStopRaining, EventData: 10_000})
+	_ = s.Client().WritePacket(&packet.LevelEvent{EventType: packet.LevelEventStopThunderstorm})
+
+	current := s.GameData()
+	if !s.opts.DisableTracker {
+		if tracked, ok := s.tracker.clientGameData(); ok {
+			current = tracked
+		}
+		previous := s.tracker.Dimension()
+		s.tracker.setGameData(gameData, runtimeID)
+		if previous != gameData.Dimension {
+			s.hooks().ProcessDimensionChange(NewContext(), previous, gameData.Dimension)
+		}
+	}
+	if experimentsDiffer(current.Experiments, gameData.Experiments) {
+		s.logger.Debug("server has different experiments, which cannot be changed after login")
+	}
+	for _, pk := range gameDataUpdates(current, gameData) {
+		_ = s.Client().WritePacket(pk)
+	}
 }
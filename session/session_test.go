@@ -0,0 +1,541 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cooldogedev/spectrum/server"
+	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
+	"github.com/cooldogedev/spectrum/session/sessiontest"
+	"github.com/cooldogedev/spectrum/transport"
+	"github.com/cooldogedev/spectrum/util"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// testTimeout is the maximum duration a test waits for a session to log in.
+const testTimeout = 10 * time.Second
+
+// testSession is a session logged in to a sessiontest.Backend by a client dialed over sessiontest.Network.
+type testSession struct {
+	*Session
+	client  *minecraft.Conn
+	backend *sessiontest.BackendConn
+	// backends is the transport the session dials backends with, which serves the backend at "backend".
+	backends *sessiontest.Transport
+	// spawn holds the packets the backend received after the connection sequence, up to and including the
+	// SetLocalPlayerAsInitialised packet.
+	spawn []packet.Packet
+}
+
+// newTestSession logs in a new session using the registry and options passed, failing the test if the login
+// fails. It returns once both the client and the backend have spawned the player.
+func newTestSession(t testing.TB, registry *Registry, opts util.Opts) *testSession {
+	t.Helper()
+	ts, err := dialTestSession(t, registry, opts, nil)
+	if err != nil {
+		t.Fatalf("failed to log in session: %v", err)
+	}
+	return ts
+}
+
+// dialTestSession dials a new session using the registry and options passed and logs it in, returning the error
+// returned by Session.Login if it fails. Like Spectrum.Accept, the session is disconnected with that error. If wrap
+// is not nil, the session dials the backend using the transport it returns.
+func dialTestSession(t testing.TB, registry *Registry, opts util.Opts, wrap func(tr transport.Transport) transport.Transport) (*testSession, error) {
+	t.Helper()
+	backend := sessiontest.NewBackend(&packet.StartGame{WorldName: "test"})
+	backends := sessiontest.NewTransport()
+	backends.Register("backend", backend)
+	var sessionTransport transport.Transport = backends
+	if wrap != nil {
+		sessionTransport = wrap(backends)
+	}
+	t.Cleanup(func() {
+		_ = backend.Close()
+	})
+
+	listener, err := minecraft.ListenConfig{AuthenticationDisabled: true}.Listen(sessiontest.Network, "")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	type result[T any] struct {
+		value T
+		err   error
+	}
+	sessions := make(chan result[*Session], 1)
+	logins := make(chan error, 1)
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			sessions <- result[*Session]{err: err}
+			return
+		}
+
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		s := NewSession(c.(*minecraft.Conn), logger, registry, server.NewStaticDiscovery("backend", ""), opts, sessionTransport)
+		sessions <- result[*Session]{value: s}
+		if err := s.Login(); err != nil {
+			s.Disconnect(err.Error())
+			logins <- err
+			return
+		}
+		logins <- nil
+	}()
+
+	clients := make(chan result[*minecraft.Conn], 1)
+	go func() {
+		client, err := minecraft.Dialer{}.DialContext(ctx, sessiontest.Network, listener.Addr().String())
+		if err == nil {
+			err = client.DoSpawnContext(ctx)
+		}
+		clients <- result[*minecraft.Conn]{value: client, err: err}
+	}()
+
+	conns := make(chan *sessiontest.BackendConn, 1)
+	var spawn []packet.Packet
+	go func() {
+		conn, err := backend.Accept(ctx)
+		if err != nil {
+			return
+		}
+
+		// The backend is connected to the proxy through a synchronous pipe, so the packet spawning the player
+		// must be read for the login to complete.
+		for {
+			pk, err := conn.ReadPacket()
+			if err != nil {
+				return
+			}
+
+			spawn = append(spawn, pk)
+			if _, ok := pk.(*packet.SetLocalPlayerAsInitialised); ok {
+				conns <- conn
+				return
+			}
+		}
+	}()
+
+	ts := &testSession{backends: backends}
+	select {
+	case res := <-sessions:
+		if res.err != nil {
+			t.Fatalf("failed to accept client: %v", res.err)
+		}
+		ts.Session = res.value
+		t.Cleanup(func() {
+			_ = ts.Close()
+		})
+	case <-ctx.Done():
+		t.Fatalf("client was not accepted: %v", ctx.Err())
+	}
+
+	var loginErr error
+	select {
+	case loginErr = <-logins:
+		if loginErr == nil {
+			ts.backend = <-conns
+		}
+	case ts.backend = <-conns:
+		loginErr = <-logins
+	case <-ctx.Done():
+		t.Fatalf("session did not log in: %v", ctx.Err())
+	}
+	if ts.backend != nil {
+		ts.spawn = spawn
+	}
+
+	select {
+	case res := <-clients:
+		if res.value != nil {
+			t.Cleanup(func() {
+				_ = res.value.Close()
+			})
+		}
+		if loginErr != nil {
+			return nil, loginErr
+		}
+		if res.err != nil {
+			t.Fatalf("client failed to spawn: %v", res.err)
+		}
+		ts.client = res.value
+	case <-ctx.Done():
+		t.Fatalf("client did not spawn: %v", ctx.Err())
+	}
+	return ts, nil
+}
+
+// writeClient writes the packets passed from the client to the proxy as a single batch.
+func (ts *testSession) writeClient(t testing.TB, pks ...packet.Packet) {
+	t.Helper()
+	for _, pk := range pks {
+		if err := ts.client.WritePacket(pk); err != nil {
+			t.Fatalf("failed to write packet: %v", err)
+		}
+	}
+	if err := ts.client.Flush(); err != nil {
+		t.Fatalf("failed to flush client: %v", err)
+	}
+}
+
+// readBackend reads the packets the backend receives until it receives a packet with the ID passed, returning the
+// packets read, including the last one.
+func (ts *testSession) readBackend(t testing.TB, id uint32) []packet.Packet {
+	t.Helper()
+	var pks []packet.Packet
+	for {
+		pk, err := ts.backend.ReadPacket()
+		if err != nil {
+			t.Fatalf("failed to read packet: %v", err)
+		}
+
+		pks = append(pks, pk)
+		if pk.ID() == id {
+			return pks
+		}
+	}
+}
+
+// readBackendPayload reads the payloads the backend receives until it receives a packet with the ID passed,
+// returning the payload of that packet without decoding it.
+func (ts *testSession) readBackendPayload(t testing.TB, id uint32) []byte {
+	t.Helper()
+	header := &packet.Header{}
+	for {
+		payload, err := ts.backend.ReadPayload()
+		if err != nil {
+			t.Fatalf("failed to read payload: %v", err)
+		}
+		if err := header.Read(bytes.NewBuffer(payload)); err == nil && header.PacketID == id {
+			return payload
+		}
+	}
+}
+
+// readClient reads the packets the client receives until it receives a packet with the ID passed, returning the
+// packets read, including the last one.
+func (ts *testSession) readClient(t testing.TB, id uint32) []packet.Packet {
+	t.Helper()
+	if err := ts.client.SetReadDeadline(time.Now().Add(testTimeout)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	var pks []packet.Packet
+	for {
+		pk, err := ts.client.ReadPacket()
+		if err != nil {
+			t.Fatalf("failed to read packet: %v", err)
+		}
+
+		pks = append(pks, pk)
+		if pk.ID() == id {
+			return pks
+		}
+	}
+}
+
+func TestLoginSupportedProtocols(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported []int32
+		wantErr   bool
+	}{
+		{name: "empty accepts all"},
+		{name: "supported", supported: []int32{minecraft.DefaultProtocol.ID() - 1, minecraft.DefaultProtocol.ID()}},
+		{name: "unsupported", supported: []int32{minecraft.DefaultProtocol.ID() - 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := *util.DefaultOpts()
+			opts.SupportedProtocols = tt.supported
+			opts.UnsupportedProtocolMessage = "please update your game"
+			_, err := dialTestSession(t, NewRegistry(), opts, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("login error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && err.Error() != opts.UnsupportedProtocolMessage {
+				t.Fatalf("login error = %q, want %q", err, opts.UnsupportedProtocolMessage)
+			}
+		})
+	}
+}
+
+func TestClientCacheStatusWithoutFeatures(t *testing.T) {
+	ts := newTestSession(t, NewRegistry(), *util.DefaultOpts())
+	for i, pk := range ts.spawn {
+		status, ok := pk.(*packet.ClientCacheStatus)
+		if !ok {
+			continue
+		}
+		if status.Enabled != ts.Client().ClientCacheEnabled() {
+			t.Fatalf("client cache status enabled = %v, want %v", status.Enabled, ts.Client().ClientCacheEnabled())
+		}
+		if i != len(ts.spawn)-2 {
+			t.Fatalf("client cache status was sent at %d of %d packets, want right before spawning", i, len(ts.spawn))
+		}
+		return
+	}
+	t.Fatal("backend without features did not receive the client cache status")
+}
+
+func TestTransferShieldID(t *testing.T) {
+	ts := newTestSession(t, NewRegistry(), *util.DefaultOpts())
+	for _, target := range []struct {
+		addr     string
+		shieldID int32
+	}{{addr: "first", shieldID: 300}, {addr: "second", shieldID: 400}} {
+		backend := sessiontest.NewBackend(&packet.StartGame{WorldName: target.addr})
+		backend.ItemRegistry = &packet.ItemRegistry{Items: []protocol.ItemEntry{
+			{Name: "minecraft:apple", RuntimeID: 1},
+			{Name: "minecraft:shield", RuntimeID: int16(target.shieldID)},
+		}}
+		ts.backends.Register(target.addr, backend)
+		t.Cleanup(func() {
+			_ = backend.Close()
+		})
+
+		if err := ts.Transfer(target.addr); err != nil {
+			t.Fatalf("failed to transfer to %s: %v", target.addr, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		ts.backend, _ = backend.Accept(ctx)
+		cancel()
+		if ts.backend == nil {
+			t.Fatalf("session did not connect to %s", target.addr)
+		}
+		ts.readBackend(t, packet.IDSetLocalPlayerAsInitialised)
+
+		deadline := time.Now().Add(testTimeout)
+		for ts.shieldID.Load() != target.shieldID {
+			if time.Now().After(deadline) {
+				t.Fatalf("shield ID after transferring to %s = %d, want %d", target.addr, ts.shieldID.Load(), target.shieldID)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestVerifyMigration(t *testing.T) {
+	expires := time.Now().Add(time.Minute).UnixMilli()
+	valid := MigrationState{XUID: "1", Token: "valid", Target: "proxy:19132", Expires: expires}
+	tests := []struct {
+		name    string
+		state   MigrationState
+		xuid    string
+		addr    string
+		wantErr bool
+	}{
+		{name: "valid", state: valid, xuid: "1", addr: "PROXY:19132"},
+		{name: "reused token", state: valid, xuid: "1", addr: "proxy:19132", wantErr: true},
+		{name: "no token", state: MigrationState{XUID: "1", Target: "proxy:19132", Expires: expires}, xuid: "1", addr: "proxy:19132", wantErr: true},
+		{name: "other player", state: MigrationState{XUID: "1", Token: "player", Target: "proxy:19132", Expires: expires}, xuid: "2", addr: "proxy:19132", wantErr: true},
+		{name: "other proxy", state: MigrationState{XUID: "1", Token: "proxy", Target: "proxy:19132", Expires: expires}, xuid: "1", addr: "other:19132", wantErr: true},
+		{name: "expired", state: MigrationState{XUID: "1", Token: "expired", Target: "proxy:19132", Expires: time.Now().Add(-time.Second).UnixMilli()}, xuid: "1", addr: "proxy:19132", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyMigration(tt.state, tt.xuid, tt.addr); (err != nil) != tt.wantErr {
+				t.Fatalf("verifyMigration() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFlushClientOnClose(t *testing.T) {
+	tests := []struct {
+		name      string
+		flush     bool
+		clean     bool
+		delivered bool
+	}{
+		{name: "flushed on clean close", flush: true, clean: true, delivered: true},
+		{name: "not flushed on error close", flush: true},
+		{name: "disabled", clean: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := *util.DefaultOpts()
+			opts.FlushClientOnClose = tt.flush
+			ts := newTestSession(t, NewRegistry(), opts)
+			ts.writeClient(t, &packet.Text{TextType: packet.TextTypeChat, Message: "pending"})
+
+			// The backend does not read until the session is closed, so the batch stays pending while it is being
+			// written to the synchronous pipe.
+			deadline := time.Now().Add(testTimeout)
+			for len(ts.forwarding) == 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("client batch was not forwarded")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if tt.clean {
+				ts.Disconnect("closed")
+			} else {
+				ts.CloseWithError(errors.New("closed"))
+			}
+
+			var delivered bool
+			for {
+				pk, err := ts.backend.ReadPacket()
+				if err != nil {
+					break
+				}
+				if text, ok := pk.(*packet.Text); ok && text.Message == "pending" {
+					delivered = true
+					break
+				}
+			}
+			if delivered != tt.delivered {
+				t.Fatalf("pending batch delivered = %v, want %v", delivered, tt.delivered)
+			}
+		})
+	}
+}
+
+// errServerClose is returned when closing the connections dialed by failingCloseTransport.
+var errServerClose = errors.New("server close failed")
+
+// failingCloseTransport wraps a transport.Transport, returning errServerClose when closing the connections it
+// dials.
+type failingCloseTransport struct {
+	transport.Transport
+}
+
+// Dial ...
+func (t failingCloseTransport) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	conn, err := t.Transport.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return failingCloseConn{ReadWriteCloser: conn}, nil
+}
+
+// failingCloseConn is a connection dialed by failingCloseTransport.
+type failingCloseConn struct {
+	io.ReadWriteCloser
+}
+
+// Close ...
+func (c failingCloseConn) Close() error {
+	_ = c.ReadWriteCloser.Close()
+	return errServerClose
+}
+
+// disconnectProcessor records the message and cause passed to ProcessDisconnection and panics afterwards.
+type disconnectProcessor struct {
+	NopProcessor
+	message string
+	cause   error
+}
+
+// ProcessDisconnection ...
+func (p *disconnectProcessor) ProcessDisconnection(ctx *Context, message *string) {
+	p.message, p.cause = *message, DisconnectCause(ctx)
+	panic("disconnection failed")
+}
+
+func TestCloseWithErrorJoinsErrors(t *testing.T) {
+	ts, err := dialTestSession(t, NewRegistry(), *util.DefaultOpts(), func(tr transport.Transport) transport.Transport {
+		return failingCloseTransport{Transport: tr}
+	})
+	if err != nil {
+		t.Fatalf("failed to log in session: %v", err)
+	}
+	processor := &disconnectProcessor{}
+	ts.SetProcessor(processor)
+
+	kicked := errors.New("kicked")
+	ts.CloseWithError(kicked)
+	cause := context.Cause(ts.Context())
+	for _, want := range []error{kicked, errServerClose} {
+		if !errors.Is(cause, want) {
+			t.Errorf("cause %q does not hold %q", cause, want)
+		}
+	}
+	if !strings.Contains(cause.Error(), "panic while processing disconnection") {
+		t.Errorf("cause %q does not hold the panic of the hook", cause)
+	}
+
+	if processor.message != kicked.Error() {
+		t.Errorf("disconnect message = %q, want %q", processor.message, kicked.Error())
+	}
+	if !errors.Is(processor.cause, kicked) || !errors.Is(processor.cause, errServerClose) {
+		t.Errorf("DisconnectCause = %q, want it to hold %q and %q", processor.cause, kicked, errServerClose)
+	}
+}
+
+func TestMultiplyLatency(t *testing.T) {
+	tests := []struct {
+		name       string
+		latency    time.Duration
+		multiplier float64
+		want       int64
+	}{
+		{name: "half round-trip", latency: 25 * time.Millisecond, multiplier: 2, want: 50},
+		{name: "full round-trip", latency: 50 * time.Millisecond, multiplier: 1, want: 50},
+		{name: "fractional", latency: 40 * time.Millisecond, multiplier: 1.5, want: 60},
+		{name: "zero defaults to two", latency: 25 * time.Millisecond, want: 50},
+		{name: "negative defaults to two", latency: 25 * time.Millisecond, multiplier: -1, want: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := multiplyLatency(tt.latency, tt.multiplier); got != tt.want {
+				t.Fatalf("multiplyLatency(%v, %v) = %d, want %d", tt.latency, tt.multiplier, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionLatency(t *testing.T) {
+	tests := []struct {
+		name       string
+		multiplier float64
+	}{
+		{name: "full round-trip", multiplier: 1},
+		{name: "half round-trip", multiplier: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := *util.DefaultOpts()
+			opts.LatencyInterval = 10
+			opts.LatencyMultiplier = tt.multiplier
+			ts := newTestSession(t, NewRegistry(), opts)
+
+			want := int64(float64(sessiontest.Latency.Milliseconds()) * tt.multiplier)
+			pks := ts.readBackend(t, spectrumpacket.IDLatency)
+			if latency := pks[len(pks)-1].(*spectrumpacket.Latency); latency.Latency != want {
+				t.Errorf("reported latency = %d, want %d", latency.Latency, want)
+			}
+			// The backend never reports the latency of the server, so the latency of the session is only that of
+			// the client.
+			if latency := ts.Latency(); latency != want {
+				t.Errorf("Latency() = %d, want %d", latency, want)
+			}
+		})
+	}
+}
+
+func BenchmarkSessionLatency(b *testing.B) {
+	opts := *util.DefaultOpts()
+	opts.LatencyMultiplier = 1.5
+	ts := newTestSession(b, NewRegistry(), opts)
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = ts.Latency()
+	}
+}
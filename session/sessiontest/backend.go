@@ -0,0 +1,284 @@
+package sessiontest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/cooldogedev/spectrum/protocol"
+	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
+	"github.com/golang/snappy"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+const (
+	flagPacketDecode byte = 1 << iota
+	flagPacketCompressed
+	flagPacketIsBatch
+)
+
+// Backend is a fake downstream server speaking the spectrum protocol. It completes the connection sequence
+// of every connection dialed to it and hands the connection out through Accept once the player has spawned.
+type Backend struct {
+	// RuntimeID is the runtime ID sent to the proxy in the ConnectionResponse packet.
+	RuntimeID uint64
+	// UniqueID is the unique ID sent to the proxy in the ConnectionResponse packet.
+	UniqueID int64
+	// Features are the features of the spectrum protocol advertised to the proxy in the ConnectionResponse
+	// packet. When zero, the backend behaves like a server that does not know about features.
+	Features uint32
+	// ItemRegistry is the ItemRegistry packet sent to the proxy during the connection sequence. When nil, an empty
+	// item registry is sent.
+	ItemRegistry *packet.ItemRegistry
+
+	startGame *packet.StartGame
+	conns     chan *BackendConn
+	closed    chan struct{}
+	once      sync.Once
+}
+
+// NewBackend creates a new Backend that sends the provided StartGame packet during the connection sequence.
+func NewBackend(startGame *packet.StartGame) *Backend {
+	return &Backend{
+		RuntimeID: 1,
+		UniqueID:  1,
+
+		startGame: startGame,
+		conns:     make(chan *BackendConn, 16),
+		closed:    make(chan struct{}),
+	}
+}
+
+// Accept returns the next connection that completed the connection sequence, blocking until one is
+// available or the context is canceled.
+func (b *Backend) Accept(ctx context.Context) (*BackendConn, error) {
+	select {
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	case <-b.closed:
+		return nil, errors.New("backend closed")
+	case conn := <-b.conns:
+		return conn, nil
+	}
+}
+
+// Close closes the backend, causing subsequent dials to fail.
+func (b *Backend) Close() error {
+	b.once.Do(func() {
+		close(b.closed)
+	})
+	return nil
+}
+
+// serve starts the connection sequence of a dialed connection in the background.
+func (b *Backend) serve(ctx context.Context, conn net.Conn) error {
+	select {
+	case <-b.closed:
+		return errors.New("backend closed")
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	default:
+	}
+
+	c := &BackendConn{
+		conn:   conn,
+		reader: protocol.NewReader(conn),
+		writer: protocol.NewWriter(conn),
+	}
+	go func() {
+		if err := b.handshake(c); err != nil {
+			_ = c.Close()
+			return
+		}
+
+		select {
+		case b.conns <- c:
+		case <-b.closed:
+			_ = c.Close()
+		}
+	}()
+	return nil
+}
+
+// handshake performs the server side of the connection sequence on the connection.
+func (b *Backend) handshake(c *BackendConn) error {
+	pk, err := c.ReadPacket()
+	if err != nil {
+		return err
+	}
+
+	request, ok := pk.(*spectrumpacket.ConnectionRequest)
+	if !ok {
+		return fmt.Errorf("expected connection request, got %T", pk)
+	}
+	c.Request = request
+
+	startGame := *b.startGame
+	startGame.EntityUniqueID = b.UniqueID
+	startGame.EntityRuntimeID = b.RuntimeID
+	if err := c.WritePacket(&spectrumpacket.ConnectionResponse{RuntimeID: b.RuntimeID, UniqueID: b.UniqueID, Features: b.Features}); err != nil {
+		return err
+	}
+
+	for b.Features != 0 && c.Features == nil {
+		pk, err := c.ReadPacket()
+		if err != nil {
+			return err
+		}
+
+		switch pk := pk.(type) {
+		case *spectrumpacket.HandshakeMetadata:
+			c.Metadata = pk
+		case *spectrumpacket.ConnectionFeatures:
+			c.Features = pk
+		}
+	}
+
+	if err := c.WritePacket(&startGame); err != nil {
+		return err
+	}
+
+	if minecraft.DefaultProtocol.ID() >= 776 {
+		registry := b.ItemRegistry
+		if registry == nil {
+			registry = &packet.ItemRegistry{}
+		}
+		if err := c.WritePacket(registry); err != nil {
+			return err
+		}
+	}
+
+	for {
+		pk, err := c.ReadPacket()
+		if err != nil {
+			return err
+		}
+
+		switch pk := pk.(type) {
+		case *spectrumpacket.HandshakeMetadata:
+			c.Metadata = pk
+		case *packet.RequestChunkRadius:
+			if err := c.WritePacket(&packet.ChunkRadiusUpdated{ChunkRadius: pk.ChunkRadius}); err != nil {
+				return err
+			}
+			return c.WritePacket(&packet.PlayStatus{Status: packet.PlayStatusPlayerSpawn})
+		}
+	}
+}
+
+// BackendConn is a connection from the proxy to a Backend.
+type BackendConn struct {
+	// Request is the ConnectionRequest packet the proxy sent to initiate the connection.
+	Request *spectrumpacket.ConnectionRequest
+	// Metadata is the HandshakeMetadata packet the proxy sent, if any.
+	Metadata *spectrumpacket.HandshakeMetadata
+	// Features is the ConnectionFeatures packet the proxy sent, which is nil if the backend advertised no
+	// features.
+	Features *spectrumpacket.ConnectionFeatures
+
+	conn   net.Conn
+	reader *protocol.Reader
+	writer *protocol.Writer
+
+	batch [][]byte
+}
+
+// ReadPacket reads the next packet sent by the proxy and decodes it. Packets sent as part of a batch are
+// returned one by one.
+func (c *BackendConn) ReadPacket() (pk packet.Packet, err error) {
+	payload, err := c.ReadPayload()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while decoding packet: %v", r)
+		}
+	}()
+
+	buf := bytes.NewBuffer(payload)
+	header := &packet.Header{}
+	if err := header.Read(buf); err != nil {
+		return nil, err
+	}
+
+	factory, ok := minecraft.DefaultProtocol.Packets(true)[header.PacketID]
+	if !ok {
+		return nil, fmt.Errorf("unknown packet ID %v", header.PacketID)
+	}
+	pk = factory()
+	pk.Marshal(minecraft.DefaultProtocol.NewReader(buf, 0, false))
+	return pk, nil
+}
+
+// ReadPayload reads the next packet sent by the proxy without decoding it. Packets sent as part of a batch
+// are returned one by one.
+func (c *BackendConn) ReadPayload() ([]byte, error) {
+	if len(c.batch) > 0 {
+		payload := c.batch[0]
+		c.batch = c.batch[1:]
+		return payload, nil
+	}
+
+	data, err := c.reader.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, errors.New("received an empty packet")
+	}
+
+	flags, payload := data[0], data[1:]
+	if flags&flagPacketCompressed != 0 {
+		if payload, err = snappy.Decode(nil, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if flags&flagPacketIsBatch == 0 {
+		return payload, nil
+	}
+
+	for len(payload) > 0 {
+		if len(payload) < 4 {
+			return nil, errors.New("truncated batch entry length")
+		}
+
+		length := binary.LittleEndian.Uint32(payload)
+		payload = payload[4:]
+		if uint32(len(payload)) < length {
+			return nil, errors.New("truncated batch entry")
+		}
+		c.batch = append(c.batch, payload[:length])
+		payload = payload[length:]
+	}
+	return c.ReadPayload()
+}
+
+// WritePacket encodes the packet and writes it to the proxy, flagged to be decoded by the proxy.
+func (c *BackendConn) WritePacket(pk packet.Packet) error {
+	buf := bytes.NewBuffer(nil)
+	header := &packet.Header{PacketID: pk.ID()}
+	if err := header.Write(buf); err != nil {
+		return err
+	}
+	pk.Marshal(minecraft.DefaultProtocol.NewWriter(buf, 0))
+	return c.writer.WriteWithFlags(flagPacketDecode, buf.Bytes())
+}
+
+// WritePayload writes an encoded packet to the proxy, which forwards it to the client without decoding it.
+func (c *BackendConn) WritePayload(payload []byte) error {
+	return c.writer.WriteWithFlags(0, payload)
+}
+
+// Close closes the connection.
+func (c *BackendConn) Close() error {
+	return c.conn.Close()
+}
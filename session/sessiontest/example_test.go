@@ -0,0 +1,100 @@
+package sessiontest_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/cooldogedev/spectrum/server"
+	"github.com/cooldogedev/spectrum/session"
+	"github.com/cooldogedev/spectrum/session/sessiontest"
+	"github.com/cooldogedev/spectrum/util"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+func Example() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	backend := sessiontest.NewBackend(&packet.StartGame{WorldName: "lobby"})
+	defer backend.Close()
+	transport := sessiontest.NewTransport()
+	transport.Register("lobby", backend)
+
+	listener, err := minecraft.ListenConfig{AuthenticationDisabled: true}.Listen(sessiontest.Network, "")
+	if err != nil {
+		panic(err)
+	}
+	defer listener.Close()
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		s := session.NewSession(c.(*minecraft.Conn), logger, session.NewRegistry(), server.NewStaticDiscovery("lobby", ""), *util.DefaultOpts(), transport)
+		if err := s.Login(); err != nil {
+			s.Disconnect(err.Error())
+		}
+	}()
+
+	client, err := minecraft.Dialer{}.DialContext(ctx, sessiontest.Network, listener.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+	if err := client.DoSpawnContext(ctx); err != nil {
+		panic(err)
+	}
+
+	conn, err := backend.Accept(ctx)
+	if err != nil {
+		panic(err)
+	}
+	// The proxy finishes logging in once the backend has read the packet spawning the player.
+	for {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			panic(err)
+		}
+		if _, ok := pk.(*packet.SetLocalPlayerAsInitialised); ok {
+			break
+		}
+	}
+
+	if err := conn.WritePacket(&packet.Text{TextType: packet.TextTypeRaw, Message: "hello from the backend"}); err != nil {
+		panic(err)
+	}
+	for {
+		pk, err := client.ReadPacket()
+		if err != nil {
+			panic(err)
+		}
+		if text, ok := pk.(*packet.Text); ok {
+			fmt.Println("client received:", text.Message)
+			break
+		}
+	}
+
+	if err := client.WritePacket(&packet.Text{TextType: packet.TextTypeChat, Message: "hello from the client"}); err != nil {
+		panic(err)
+	}
+	_ = client.Flush()
+	for {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			panic(err)
+		}
+		if text, ok := pk.(*packet.Text); ok {
+			fmt.Println("backend received:", text.Message)
+			break
+		}
+	}
+
+	// Output:
+	// client received: hello from the backend
+	// backend received: hello from the client
+}
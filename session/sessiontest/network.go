@@ -0,0 +1,325 @@
+package sessiontest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Network is the name of the in-memory network registered with minecraft.RegisterNetwork, which may be passed to
+// minecraft.ListenConfig.Listen and minecraft.Dialer.DialContext to connect clients to sessions without any
+// sockets. Listening on an empty address picks an unused address, which is returned by the listener's Addr.
+// Writes never block and every read returns a single write, like the datagrams of RakNet.
+const Network = "sessiontest"
+
+// Latency is the latency reported by the connections of Network, which is returned by minecraft.Conn.Latency.
+// It is constant, so that tests relying on the latency of a session are deterministic.
+const Latency = 25 * time.Millisecond
+
+// network is the minecraft.Network registered as Network.
+var network = &memoryNetwork{listeners: make(map[string]*memoryListener)}
+
+func init() {
+	minecraft.RegisterNetwork(Network, func(*slog.Logger) minecraft.Network {
+		return network
+	})
+}
+
+// memoryNetwork implements the minecraft.Network interface using in-memory connections.
+type memoryNetwork struct {
+	listeners map[string]*memoryListener
+	ids       atomic.Int64
+	mu        sync.Mutex
+}
+
+// DialContext ...
+func (n *memoryNetwork) DialContext(ctx context.Context, address string) (net.Conn, error) {
+	n.mu.Lock()
+	listener, ok := n.listeners[address]
+	n.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no listener on %s", address)
+	}
+	return listener.dial(ctx, addr(fmt.Sprintf("client-%d", n.ids.Add(1))))
+}
+
+// PingContext always fails, so that minecraft.Dialer dials the address as is instead of replacing its port with
+// the port found in the pong data.
+func (n *memoryNetwork) PingContext(context.Context, string) ([]byte, error) {
+	return nil, errors.New("pinging is not supported")
+}
+
+// Listen ...
+func (n *memoryNetwork) Listen(address string) (minecraft.NetworkListener, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if address == "" {
+		address = fmt.Sprintf("listener-%d", n.ids.Add(1))
+	}
+	if _, ok := n.listeners[address]; ok {
+		return nil, fmt.Errorf("address %s already in use", address)
+	}
+
+	listener := &memoryListener{
+		network: n,
+		addr:    addr(address),
+		id:      n.ids.Add(1),
+		conns:   make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+	n.listeners[address] = listener
+	return listener, nil
+}
+
+// Compression ...
+func (n *memoryNetwork) Compression(net.Conn) packet.Compression {
+	return packet.FlateCompression
+}
+
+// memoryListener is a listener of Network.
+type memoryListener struct {
+	network *memoryNetwork
+	addr    addr
+	id      int64
+
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+// dial connects a new client with the address passed to the listener, returning the client's side of the
+// connection once the listener accepted it.
+func (l *memoryListener) dial(ctx context.Context, client addr) (net.Conn, error) {
+	toListener, toClient := newQueue(), newQueue()
+	clientConn := &memoryConn{local: client, remote: l.addr, in: toClient, out: toListener}
+	listenerConn := &memoryConn{local: l.addr, remote: client, in: toListener, out: toClient}
+	select {
+	case l.conns <- listenerConn:
+		return clientConn, nil
+	case <-l.closed:
+		return nil, fmt.Errorf("listener on %s closed", l.addr)
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// Accept ...
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close ...
+func (l *memoryListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+		l.network.mu.Lock()
+		delete(l.network.listeners, string(l.addr))
+		l.network.mu.Unlock()
+	})
+	return nil
+}
+
+// Addr ...
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+// ID ...
+func (l *memoryListener) ID() int64 {
+	return l.id
+}
+
+// PongData ...
+func (l *memoryListener) PongData([]byte) {}
+
+// addr is the address of a listener or client of Network.
+type addr string
+
+// Network ...
+func (a addr) Network() string {
+	return Network
+}
+
+// String ...
+func (a addr) String() string {
+	return string(a)
+}
+
+// memoryConn is one side of a connection of Network.
+type memoryConn struct {
+	local  addr
+	remote addr
+	in     *queue
+	out    *queue
+}
+
+// Read ...
+func (c *memoryConn) Read(b []byte) (int, error) {
+	data, err := c.ReadPacket()
+	if err != nil {
+		return 0, err
+	}
+	if len(data) > len(b) {
+		return 0, io.ErrShortBuffer
+	}
+	return copy(b, data), nil
+}
+
+// ReadPacket reads the data of the next write of the other side of the connection.
+func (c *memoryConn) ReadPacket() ([]byte, error) {
+	return c.in.pop()
+}
+
+// Write ...
+func (c *memoryConn) Write(b []byte) (int, error) {
+	if err := c.out.push(b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the connection. The other side may still read the data written before.
+func (c *memoryConn) Close() error {
+	c.in.close(net.ErrClosed)
+	c.out.close(io.EOF)
+	return nil
+}
+
+// LocalAddr ...
+func (c *memoryConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr ...
+func (c *memoryConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// SetDeadline ...
+func (c *memoryConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline ...
+func (c *memoryConn) SetReadDeadline(t time.Time) error {
+	c.in.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline does nothing, since writes never block.
+func (c *memoryConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// Latency returns Latency.
+func (c *memoryConn) Latency() time.Duration {
+	return Latency
+}
+
+// queue holds the data written to one direction of a connection of Network until it is read.
+type queue struct {
+	data     [][]byte
+	deadline time.Time
+	err      error
+	mu       sync.Mutex
+
+	// signal is notified whenever data is pushed, the queue is closed or the deadline is changed.
+	signal chan struct{}
+}
+
+// newQueue creates a new empty queue.
+func newQueue() *queue {
+	return &queue{signal: make(chan struct{}, 1)}
+}
+
+// push appends a copy of the data to the queue.
+func (q *queue) push(b []byte) error {
+	q.mu.Lock()
+	if q.err != nil {
+		q.mu.Unlock()
+		return net.ErrClosed
+	}
+	q.data = append(q.data, slices.Clone(b))
+	q.mu.Unlock()
+	q.notify()
+	return nil
+}
+
+// pop removes the oldest data of the queue and returns it, blocking until data is available, the queue is closed
+// or the deadline passed.
+func (q *queue) pop() ([]byte, error) {
+	for {
+		q.mu.Lock()
+		if len(q.data) > 0 {
+			data := q.data[0]
+			q.data = q.data[1:]
+			q.mu.Unlock()
+			return data, nil
+		}
+		if q.err != nil {
+			q.mu.Unlock()
+			return nil, q.err
+		}
+		deadline := q.deadline
+		q.mu.Unlock()
+
+		if deadline.IsZero() {
+			<-q.signal
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-q.signal:
+			timer.Stop()
+		case <-timer.C:
+			return nil, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// close closes the queue, after which pop returns err once the data left was read. Closing the queue with
+// net.ErrClosed discards the data left.
+func (q *queue) close(err error) {
+	q.mu.Lock()
+	if q.err == nil || err == net.ErrClosed {
+		q.err = err
+	}
+	if err == net.ErrClosed {
+		q.data = nil
+	}
+	q.mu.Unlock()
+	q.notify()
+}
+
+// setDeadline sets the time after which pop fails with os.ErrDeadlineExceeded. A zero time disables the deadline.
+func (q *queue) setDeadline(t time.Time) {
+	q.mu.Lock()
+	q.deadline = t
+	q.mu.Unlock()
+	q.notify()
+}
+
+// notify wakes up a pop blocked on the queue.
+func (q *queue) notify() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,64 @@
+// Package sessiontest provides an in-memory transport, an in-memory client network and a fake downstream server
+// for driving sessions through their packet handling loops without any network setup.
+//
+// The *minecraft.Conn of the client side is obtained by listening and dialing on Network. The proxy only finishes
+// logging a session in once the Backend has read the SetLocalPlayerAsInitialised packet, since connections to
+// backends are synchronous pipes. See the package example for a complete setup.
+package sessiontest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/cooldogedev/spectrum/transport"
+)
+
+// Transport implements the transport.Transport interface using in-memory connections. Every dialed connection
+// is served by the Backend registered for the dialed address.
+type Transport struct {
+	backends map[string]*Backend
+	mu       sync.RWMutex
+}
+
+// Ensure that Transport satisfies the transport.Transport interface.
+var _ transport.Transport = &Transport{}
+
+// NewTransport creates a new Transport without any registered backends.
+func NewTransport() *Transport {
+	return &Transport{backends: make(map[string]*Backend)}
+}
+
+// Register registers the backend that serves connections dialed to the address.
+func (t *Transport) Register(addr string, backend *Backend) {
+	t.mu.Lock()
+	t.backends[addr] = backend
+	t.mu.Unlock()
+}
+
+// Unregister removes the backend registered for the address, causing subsequent dials to fail.
+func (t *Transport) Unregister(addr string) {
+	t.mu.Lock()
+	delete(t.backends, addr)
+	t.mu.Unlock()
+}
+
+// Dial ...
+func (t *Transport) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	t.mu.RLock()
+	backend, ok := t.backends[addr]
+	t.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no backend registered for %s", addr)
+	}
+
+	proxySide, backendSide := net.Pipe()
+	if err := backend.serve(ctx, backendSide); err != nil {
+		_ = proxySide.Close()
+		_ = backendSide.Close()
+		return nil, err
+	}
+	return proxySide, nil
+}
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"encoding/binary"
+	"maps"
+	"sync"
+)
+
+// PacketStats holds the amount of packets with a single ID that were read, and their total size in bytes.
+type PacketStats struct {
+	Count uint64 `json:"count"`
+	Bytes uint64 `json:"bytes"`
+}
+
+// SessionStats holds the statistics of the packets read by a session, keyed by packet ID.
+type SessionStats struct {
+	// Client holds the statistics of the packets read from the client.
+	Client map[uint32]PacketStats `json:"client"`
+	// Server holds the statistics of the packets read from servers. Packets the server sends decoded are
+	// counted without their size, since they are never encoded by the proxy.
+	Server map[uint32]PacketStats `json:"server"`
+}
+
+// packetStats tracks the statistics returned by Session.Stats.
+type packetStats struct {
+	client map[uint32]PacketStats
+	server map[uint32]PacketStats
+	mu     sync.Mutex
+}
+
+// Stats returns the statistics of the packets read by the session since it was created or since ResetStats
+// was last called. Statistics are only tracked if opts.TrackPacketStats is enabled.
+func (s *Session) Stats() SessionStats {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	return SessionStats{
+		Client: maps.Clone(s.stats.client),
+		Server: maps.Clone(s.stats.server),
+	}
+}
+
+// ResetStats resets the statistics of the packets read by the session.
+func (s *Session) ResetStats() {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	s.stats.client = nil
+	s.stats.server = nil
+}
+
+// countPacket adds a packet read from the client or server to the statistics of the session.
+func (s *Session) countPacket(client bool, id uint32, size int) {
+	if !s.opts.TrackPacketStats {
+		return
+	}
+
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	stats := &s.stats.server
+	if client {
+		stats = &s.stats.client
+	}
+	if *stats == nil {
+		*stats = make(map[uint32]PacketStats)
+	}
+	entry := (*stats)[id]
+	entry.Count++
+	entry.Bytes += uint64(size)
+	(*stats)[id] = entry
+}
+
+// countRawPacket adds a raw packet payload read from the client or server to the statistics of the session,
+// reading the packet ID from the payload's header.
+func (s *Session) countRawPacket(client bool, payload []byte) {
+	if !s.opts.TrackPacketStats {
+		return
+	}
+
+	if header, n := binary.Uvarint(payload); n > 0 {
+		s.countPacket(client, uint32(header&0x3ff), len(payload))
+	}
+}
@@ -0,0 +1,113 @@
+package session
+
+import "encoding/binary"
+
+// PacketSubscriber may be implemented by a Processor to only be passed the packets it is interested in. Packets
+// the processor did not subscribe to skip ProcessClient and ProcessServer entirely and are forwarded as is.
+// The subscriptions are read once when the processor is set using Session.SetProcessor.
+type PacketSubscriber interface {
+	// SubscribedClientPackets returns the IDs of the client packets passed to ProcessClient. Client packets
+	// with other IDs are not decoded, even if they are in opts.ClientDecode, unless they need to be upgraded from
+	// a legacy protocol. A nil slice subscribes to every packet.
+	SubscribedClientPackets() []uint32
+	// SubscribedServerPackets returns the IDs of the server packets passed to ProcessServer and ProcessServerBatch.
+	// A nil slice subscribes to every packet.
+	SubscribedServerPackets() []uint32
+}
+
+// subscriptions holds the packet IDs the processor of a session subscribed to. A nil set subscribes to every packet.
+type subscriptions struct {
+	client map[uint32]struct{}
+	server map[uint32]struct{}
+}
+
+// newSubscriptions returns the subscriptions of the processor, subscribing to every packet if the processor
+// does not implement PacketSubscriber.
+func newSubscriptions(processor Processor) subscriptions {
+	subscriber, ok := processor.(PacketSubscriber)
+	if !ok {
+		return subscriptions{}
+	}
+	return subscriptions{
+		client: subscriptionSet(subscriber.SubscribedClientPackets()),
+		server: subscriptionSet(subscriber.SubscribedServerPackets()),
+	}
+}
+
+// subscriptionSet converts a list of packet IDs into a set, keeping nil as nil.
+func subscriptionSet(ids []uint32) map[uint32]struct{} {
+	if ids == nil {
+		return nil
+	}
+
+	set := make(map[uint32]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+// subscribed returns whether the packet ID is in the set.
+func subscribed(set map[uint32]struct{}, id uint32) bool {
+	if set == nil {
+		return true
+	}
+	_, ok := set[id]
+	return ok
+}
+
+// subscribedBatch returns the packets of the client batch whose IDs are in the set, or the batch itself if the
+// set is nil.
+func subscribedBatch(set map[uint32]struct{}, batch []*PacketContext) []*PacketContext {
+	if set == nil {
+		return batch
+	}
+
+	subscribedBatch := make([]*PacketContext, 0, len(batch))
+	for _, ctx := range batch {
+		if subscribed(set, ctx.id) {
+			subscribedBatch = append(subscribedBatch, ctx)
+		}
+	}
+	return subscribedBatch
+}
+
+// subscribedServer returns whether the ID of the server packet of the context is in the set.
+func subscribedServer(set map[uint32]struct{}, ctx *PacketContext) bool {
+	if pk := ctx.Packet(); pk != nil {
+		return subscribed(set, pk.ID())
+	}
+	return subscribedRaw(set, ctx.Payload())
+}
+
+// subscribedServerBatch returns the server packets of the batch whose IDs are in the set, or the batch itself if the
+// set is nil.
+func subscribedServerBatch(set map[uint32]struct{}, batch []*PacketContext) []*PacketContext {
+	if set == nil {
+		return batch
+	}
+
+	subscribedBatch := make([]*PacketContext, 0, len(batch))
+	for _, ctx := range batch {
+		if subscribedServer(set, ctx) {
+			subscribedBatch = append(subscribedBatch, ctx)
+		}
+	}
+	return subscribedBatch
+}
+
+// subscribedRaw returns whether the ID in the header of the raw packet payload is in the set.
+func subscribedRaw(set map[uint32]struct{}, payload []byte) bool {
+	if set == nil {
+		return true
+	}
+
+	header, n := binary.Uvarint(payload)
+	return n > 0 && subscribed(set, uint32(header&0x3ff))
+}
+
+// rawPacketID returns the ID in the header of the payload passed, along with whether the header could be read.
+func rawPacketID(payload []byte) (uint32, bool) {
+	header, n := binary.Uvarint(payload)
+	return uint32(header & 0x3ff), n > 0
+}
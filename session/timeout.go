@@ -0,0 +1,297 @@
+package session
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/resource"
+)
+
+// timeoutProcessor wraps a Processor and runs each of its hooks with a deadline. Hooks operate on copies
+// of the values passed to them, which are only applied if the hook returns before the deadline. A hook that
+// times out is treated as a no-op, although it keeps running in the background and may still mutate state
+// that is shared by reference, such as decoded packets. Calls to a hook are skipped, and treated as a no-op
+// too, until its timed-out call returns, so that a hook that never returns does not leak a goroutine per call.
+type timeoutProcessor struct {
+	Processor
+
+	s       *Session
+	timeout time.Duration
+
+	// stalled holds the done channel of the timed-out call of each hook that is still running by the hook's name.
+	stalled sync.Map
+}
+
+// Ensure that timeoutProcessor satisfies the Processor interface.
+var _ Processor = &timeoutProcessor{}
+
+// ProcessLogin ...
+func (p *timeoutProcessor) ProcessLogin(ctx *Context, identity login.IdentityData, client login.ClientData) {
+	p.runContext("ProcessLogin", ctx, func(ctx *Context) {
+		p.Processor.ProcessLogin(ctx, identity, client)
+	}, nil)
+}
+
+// ProcessResourcePacks ...
+func (p *timeoutProcessor) ProcessResourcePacks(ctx *Context, packs *[]*resource.Pack) {
+	resourcePacks := slices.Clone(*packs)
+	p.runContext("ProcessResourcePacks", ctx, func(ctx *Context) {
+		p.Processor.ProcessResourcePacks(ctx, &resourcePacks)
+	}, func() {
+		*packs = resourcePacks
+	})
+}
+
+// ProcessStartGame ...
+func (p *timeoutProcessor) ProcessStartGame(ctx *Context, data *minecraft.GameData) {
+	gameData := *data
+	p.runContext("ProcessStartGame", ctx, func(ctx *Context) {
+		p.Processor.ProcessStartGame(ctx, &gameData)
+	}, func() {
+		*data = gameData
+	})
+}
+
+// ProcessServer ...
+func (p *timeoutProcessor) ProcessServer(ctx *PacketContext) {
+	shadow := shadowPacketContext(ctx)
+	if p.run("ProcessServer", func() { p.Processor.ProcessServer(shadow) }) {
+		applyPacketContext(ctx, shadow)
+	}
+}
+
+// ProcessClient ...
+func (p *timeoutProcessor) ProcessClient(batch []*PacketContext) {
+	shadows := make([]*PacketContext, len(batch))
+	for i, ctx := range batch {
+		shadows[i] = shadowPacketContext(ctx)
+	}
+
+	if p.run("ProcessClient", func() { p.Processor.ProcessClient(shadows) }) {
+		for i, ctx := range batch {
+			applyPacketContext(ctx, shadows[i])
+		}
+	}
+}
+
+// ProcessServerBatch ...
+func (p *timeoutProcessor) ProcessServerBatch(batch []*PacketContext) {
+	shadows := make([]*PacketContext, len(batch))
+	for i, ctx := range batch {
+		shadows[i] = shadowPacketContext(ctx)
+	}
+
+	if p.run("ProcessServerBatch", func() { p.Processor.ProcessServerBatch(shadows) }) {
+		for i, ctx := range batch {
+			applyPacketContext(ctx, shadows[i])
+		}
+	}
+}
+
+// ProcessServerSent ...
+func (p *timeoutProcessor) ProcessServerSent(ctx *PacketContext, latency time.Duration) {
+	shadow := shadowPacketContext(ctx)
+	p.run("ProcessServerSent", func() { p.Processor.ProcessServerSent(shadow, latency) })
+}
+
+// ProcessClientSent ...
+func (p *timeoutProcessor) ProcessClientSent(batch []*PacketContext, latency time.Duration) {
+	shadows := make([]*PacketContext, len(batch))
+	for i, ctx := range batch {
+		shadows[i] = shadowPacketContext(ctx)
+	}
+	p.run("ProcessClientSent", func() { p.Processor.ProcessClientSent(shadows, latency) })
+}
+
+// ProcessLatency ...
+func (p *timeoutProcessor) ProcessLatency(ctx *Context, latency *int64, timestamp *int64) {
+	latencyValue, timestampValue := *latency, *timestamp
+	p.runContext("ProcessLatency", ctx, func(ctx *Context) {
+		p.Processor.ProcessLatency(ctx, &latencyValue, &timestampValue)
+	}, func() {
+		*latency, *timestamp = latencyValue, timestampValue
+	})
+}
+
+// ProcessFlush ...
+func (p *timeoutProcessor) ProcessFlush(ctx *Context) {
+	p.runContext("ProcessFlush", ctx, p.Processor.ProcessFlush, nil)
+}
+
+// ProcessPreTransfer ...
+func (p *timeoutProcessor) ProcessPreTransfer(ctx *Context, origin *string, target *string) {
+	o, t := *origin, *target
+	p.runContext("ProcessPreTransfer", ctx, func(ctx *Context) {
+		p.Processor.ProcessPreTransfer(ctx, &o, &t)
+	}, func() {
+		*origin, *target = o, t
+	})
+}
+
+// ProcessTransferFailure ...
+func (p *timeoutProcessor) ProcessTransferFailure(ctx *Context, origin *string, target *string) {
+	o, t := *origin, *target
+	p.runContext("ProcessTransferFailure", ctx, func(ctx *Context) {
+		p.Processor.ProcessTransferFailure(ctx, &o, &t)
+	}, func() {
+		*origin, *target = o, t
+	})
+}
+
+// ProcessTransferRejected ...
+func (p *timeoutProcessor) ProcessTransferRejected(ctx *Context, target string, err error) {
+	p.runContext("ProcessTransferRejected", ctx, func(ctx *Context) {
+		p.Processor.ProcessTransferRejected(ctx, target, err)
+	}, nil)
+}
+
+// ProcessPostTransfer ...
+func (p *timeoutProcessor) ProcessPostTransfer(ctx *Context, origin *string, target *string) {
+	o, t := *origin, *target
+	p.runContext("ProcessPostTransfer", ctx, func(ctx *Context) {
+		p.Processor.ProcessPostTransfer(ctx, &o, &t)
+	}, func() {
+		*origin, *target = o, t
+	})
+}
+
+// ProcessDimensionChange ...
+func (p *timeoutProcessor) ProcessDimensionChange(ctx *Context, from int32, to int32) {
+	p.runContext("ProcessDimensionChange", ctx, func(ctx *Context) {
+		p.Processor.ProcessDimensionChange(ctx, from, to)
+	}, nil)
+}
+
+// ProcessCache ...
+func (p *timeoutProcessor) ProcessCache(ctx *Context, new *[]byte) {
+	cache := *new
+	p.runContext("ProcessCache", ctx, func(ctx *Context) {
+		p.Processor.ProcessCache(ctx, &cache)
+	}, func() {
+		*new = cache
+	})
+}
+
+// ProcessDisconnection ...
+func (p *timeoutProcessor) ProcessDisconnection(ctx *Context, message *string) {
+	m := *message
+	p.runContext("ProcessDisconnection", ctx, func(ctx *Context) {
+		p.Processor.ProcessDisconnection(ctx, &m)
+	}, func() {
+		*message = m
+	})
+}
+
+// ProcessProtocolMismatch ...
+func (p *timeoutProcessor) ProcessProtocolMismatch(ctx *Context, failures int, err error) {
+	p.runContext("ProcessProtocolMismatch", ctx, func(ctx *Context) {
+		p.Processor.ProcessProtocolMismatch(ctx, failures, err)
+	}, nil)
+}
+
+// ProcessServerRemoved ...
+func (p *timeoutProcessor) ProcessServerRemoved(ctx *Context, addr string) {
+	p.runContext("ProcessServerRemoved", ctx, func(ctx *Context) {
+		p.Processor.ProcessServerRemoved(ctx, addr)
+	}, nil)
+}
+
+// shadowPacketContext returns a copy of the context that a hook may operate on without affecting the original.
+func shadowPacketContext(ctx *PacketContext) *PacketContext {
+	return &PacketContext{
+		id:        ctx.id,
+		headerLen: ctx.headerLen,
+		raw:       ctx.raw,
+		decoded:   ctx.decoded,
+		values:    slices.Clone(ctx.values),
+		before:    slices.Clone(ctx.before),
+		after:     slices.Clone(ctx.after),
+	}
+}
+
+// applyPacketContext applies the state of a shadow context created using shadowPacketContext to the original.
+func applyPacketContext(ctx, shadow *PacketContext) {
+	ctx.canceled = shadow.canceled
+	ctx.modified = shadow.modified
+	ctx.decoded = shadow.decoded
+	ctx.values = append(ctx.values[:0], shadow.values...)
+	ctx.before = append(ctx.before[:0], shadow.before...)
+	ctx.after = append(ctx.after[:0], shadow.after...)
+}
+
+// runContext runs a hook with a fresh Context, applying its cancellation and calling apply only if the
+// hook returned before the deadline.
+func (p *timeoutProcessor) runContext(hook string, ctx *Context, fn func(ctx *Context), apply func()) {
+	shadow := &Context{values: slices.Clone(ctx.values)}
+	if !p.run(hook, func() { fn(shadow) }) {
+		return
+	}
+	ctx.values = shadow.values
+
+	if apply != nil {
+		apply()
+	}
+
+	if shadow.Cancelled() {
+		ctx.Cancel()
+	}
+}
+
+// run runs fn in a separate goroutine and waits for it to return or for the deadline to pass, returning
+// whether fn returned in time. fn is not run at all, and false is returned, while an earlier call of the same
+// hook that timed out is still running. Panics in fn are propagated to the caller.
+func (p *timeoutProcessor) run(hook string, fn func()) bool {
+	if _, ok := p.stalled.Load(hook); ok {
+		return false
+	}
+
+	done := make(chan any, 1)
+	go func() {
+		defer func() {
+			done <- recover()
+			p.stalled.CompareAndDelete(hook, done)
+		}()
+		fn()
+	}()
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		if r != nil {
+			panic(r)
+		}
+		return true
+	case <-timer.C:
+		p.stalled.Store(hook, done)
+		if len(done) > 0 {
+			// fn returned after the deadline passed, but before the hook was marked as stalled.
+			p.stalled.CompareAndDelete(hook, done)
+		}
+		p.s.processorTimedOut(p, hook)
+		return false
+	}
+}
+
+// processorTimedOut handles a processor hook that exceeded opts.ProcessorTimeout, disabling the processor
+// or disconnecting the session if configured to do so.
+func (s *Session) processorTimedOut(p *timeoutProcessor, hook string) {
+	s.logger.Warn("processor hook timed out", "hook", hook, "timeout", p.timeout)
+	if !s.opts.DisableProcessorOnTimeout && !s.opts.DisconnectOnProcessorTimeout {
+		return
+	}
+
+	s.processorMu.Lock()
+	if s.processor == p {
+		s.processor = NopProcessor{}
+		s.subscriptions = subscriptions{}
+	}
+	s.processorMu.Unlock()
+	if s.opts.DisconnectOnProcessorTimeout {
+		go s.CloseWithError(fmt.Errorf("processor hook %s timed out after %s", hook, p.timeout))
+	}
+}
@@ -1,8 +1,11 @@
 package session
 
 import (
+	"maps"
+	"slices"
 	"sync"
 
+	"github.com/sandertv/gophertunnel/minecraft"
 	"github.com/sandertv/gophertunnel/minecraft/protocol"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 	"github.com/scylladb/go-set/b16set"
@@ -11,26 +14,101 @@ import (
 	"github.com/scylladb/go-set/strset"
 )
 
-type tracker struct {
+// Tracker tracks the state servers create on the client of a session, such as entities, boss bars and scoreboards,
+// so that it can be removed once the session is transferred to another server. Only packets the server sent decoded
+// are tracked.
+type Tracker struct {
 	bossBars    *i64set.Set
 	effects     *i32set.Set
 	entities    *i64set.Set
 	players     *b16set.Set
 	scoreboards *strset.Set
-	mu          sync.Mutex
+	// chunks holds the most recent LevelChunk packet sent for each chunk position. It is nil if chunk caching
+	// is disabled.
+	chunks map[protocol.ChunkPos]*packet.LevelChunk
+	// loaded holds the positions of the chunks the client holds.
+	loaded map[protocol.ChunkPos]struct{}
+	// stale holds the positions of the chunks the client still holds from the server it was seamlessly transferred
+	// from, which are unloaded by unloadStaleChunks unless the new server sent them first. It is nil if no chunks
+	// are stale.
+	stale map[protocol.ChunkPos]struct{}
+	// gameData is the game data of the client, updated by the packets changing it after StartGame. It is nil until
+	// setGameData was called.
+	gameData *minecraft.GameData
+	// runtimeID is the runtime ID of the player in the packets written to the client, which is the ID used by the
+	// server unless entity IDs are translated.
+	runtimeID uint64
+	// dimension is the dimension the client is in.
+	dimension int32
+	// blobs holds the blob hashes of the chunks the current server sent with the client cache enabled, whose
+	// status the client has not reported yet.
+	blobs map[uint64]struct{}
+	// staleBlobs holds the blob hashes the previous server sent whose status the client has not reported yet.
+	// Their status is never forwarded to the current server, which does not know them.
+	staleBlobs map[uint64]struct{}
+	// retained holds the packets that created the tracked state, which are replayed to a client resuming the
+	// session. It is nil if resuming is disabled.
+	retained *retainedState
+	mu       sync.Mutex
 }
 
-func newTracker() *tracker {
-	return &tracker{
+// retainedState holds the most recent packets that created each piece of state tracked by a tracker.
+type retainedState struct {
+	bossBars    map[int64]*packet.BossEvent
+	effects     map[int32]*packet.MobEffect
+	entities    map[int64]packet.Packet
+	players     map[[16]byte]protocol.PlayerListEntry
+	scoreboards map[string]*packet.SetDisplayObjective
+	// scores holds the score entries of every objective by their entry ID.
+	scores map[string]map[int64]protocol.ScoreboardEntry
+}
+
+func newTracker(cacheChunks bool, retain bool) *Tracker {
+	t := &Tracker{
 		bossBars:    i64set.New(),
 		effects:     i32set.New(),
 		entities:    i64set.New(),
 		players:     b16set.New(),
 		scoreboards: strset.New(),
+		loaded:      make(map[protocol.ChunkPos]struct{}),
+		blobs:       make(map[uint64]struct{}),
+	}
+	if cacheChunks {
+		t.chunks = make(map[protocol.ChunkPos]*packet.LevelChunk)
+	}
+	if retain {
+		t.retained = &retainedState{
+			bossBars:    make(map[int64]*packet.BossEvent),
+			effects:     make(map[int32]*packet.MobEffect),
+			entities:    make(map[int64]packet.Packet),
+			players:     make(map[[16]byte]protocol.PlayerListEntry),
+			scoreboards: make(map[string]*packet.SetDisplayObjective),
+			scores:      make(map[string]map[int64]protocol.ScoreboardEntry),
+		}
 	}
+	return t
+}
+
+// trackedPackets holds the IDs of the server packets handled by the tracker, which must be decoded to be tracked.
+var trackedPackets = map[uint32]struct{}{
+	packet.IDAddActor:                    {},
+	packet.IDAddItemActor:                {},
+	packet.IDAddPainting:                 {},
+	packet.IDAddPlayer:                   {},
+	packet.IDBossEvent:                   {},
+	packet.IDChangeDimension:             {},
+	packet.IDLevelChunk:                  {},
+	packet.IDMobEffect:                   {},
+	packet.IDNetworkChunkPublisherUpdate: {},
+	packet.IDPlayerList:                  {},
+	packet.IDRemoveActor:                 {},
+	packet.IDRemoveObjective:             {},
+	packet.IDSetDisplayObjective:         {},
+	packet.IDSetScore:                    {},
+	packet.IDSubChunk:                    {},
 }
 
-func (t *tracker) handlePacket(pk packet.Packet) {
+func (t *Tracker) handlePacket(pk packet.Packet) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	switch pk := pk.(type) {
@@ -43,13 +121,40 @@ func (t *tracker) handlePacket(pk packet.Packet) {
 	case *packet.AddPlayer:
 		t.entities.Add(pk.AbilityData.EntityUniqueID)
 	case *packet.BossEvent:
-		t.bossBars.Add(pk.BossEntityUniqueID)
+		if pk.EventType == packet.BossEventShow {
+			t.bossBars.Add(pk.BossEntityUniqueID)
+		} else if pk.EventType == packet.BossEventHide {
+			t.bossBars.Remove(pk.BossEntityUniqueID)
+		}
+	case *packet.ChangeDimension:
+		t.dimension = pk.Dimension
+		clear(t.loaded)
+		t.stale = nil
+		if t.chunks != nil {
+			clear(t.chunks)
+		}
+	case *packet.LevelChunk:
+		t.loadChunk(pk.Position)
+		if pk.CacheEnabled {
+			for _, hash := range pk.BlobHashes {
+				t.blobs[hash] = struct{}{}
+			}
+		}
+		if t.chunks != nil {
+			t.chunks[pk.Position] = pk
+		}
 	case *packet.MobEffect:
-		if pk.Operation == packet.MobEffectAdd {
+		if pk.EntityRuntimeID != t.runtimeID {
+			// Effects of other entities are removed along with the entities.
+			return
+		}
+		if pk.Operation == packet.MobEffectAdd || pk.Operation == packet.MobEffectModify {
 			t.effects.Add(pk.EffectType)
 		} else if pk.Operation == packet.MobEffectRemove {
 			t.effects.Remove(pk.EffectType)
 		}
+	case *packet.NetworkChunkPublisherUpdate:
+		t.unloadOutOfRange(pk)
 	case *packet.PlayerList:
 		for _, entry := range pk.Entries {
 			if pk.ActionType == packet.PlayerListActionAdd {
@@ -59,49 +164,227 @@ func (t *tracker) handlePacket(pk packet.Packet) {
 			}
 		}
 	case *packet.RemoveActor:
+		// The client removes the boss bar of an entity along with the entity.
+		t.bossBars.Remove(pk.EntityUniqueID)
 		t.entities.Remove(pk.EntityUniqueID)
 	case *packet.RemoveObjective:
 		t.scoreboards.Remove(pk.ObjectiveName)
 	case *packet.SetDisplayObjective:
-		t.scoreboards.Add(pk.ObjectiveName)
+		if pk.ObjectiveName != "" {
+			t.scoreboards.Add(pk.ObjectiveName)
+		}
+	case *packet.SubChunk:
+		for _, entry := range pk.SubChunkEntries {
+			t.loadChunk(protocol.ChunkPos{pk.Position[0] + int32(entry.Offset[0]), pk.Position[2] + int32(entry.Offset[2])})
+			if pk.CacheEnabled {
+				t.blobs[entry.BlobHash] = struct{}{}
+			}
+		}
+	case *packet.SetScore:
+		// Scores may be set for objectives that were never displayed, which linger on the client all the same.
+		if pk.ActionType == packet.ScoreboardActionModify {
+			for _, entry := range pk.Entries {
+				t.scoreboards.Add(entry.ObjectiveName)
+			}
+		}
+	}
+	if t.gameData != nil {
+		switch pk := pk.(type) {
+		case *packet.GameRulesChanged:
+			t.gameData.GameRules = mergeGameRules(t.gameData.GameRules, pk.GameRules)
+		case *packet.SetDefaultGameType:
+			t.gameData.WorldGameMode = pk.GameType
+		case *packet.SetDifficulty:
+			t.gameData.Difficulty = int32(pk.Difficulty)
+		case *packet.SetPlayerGameType:
+			t.gameData.PlayerGameMode = pk.GameType
+		case *packet.SetTime:
+			t.gameData.Time = int64(pk.Time)
+		}
+	}
+	if t.retained != nil {
+		t.retained.handlePacket(pk)
+	}
+}
+
+// setGameData sets the game data the client was sent and the runtime ID of the player in the packets written to the
+// client, after which the packets changing the game data and the effects of the player are tracked.
+func (t *Tracker) setGameData(gameData minecraft.GameData, runtimeID uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.gameData = &gameData
+	t.runtimeID = runtimeID
+	t.dimension = gameData.Dimension
+}
+
+// Dimension returns the dimension the client is currently in, which is updated by ChangeDimension packets sent by
+// the server and by transfers to servers in another dimension. It is not updated if opts.DisableTracker is enabled.
+func (t *Tracker) Dimension() int32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dimension
+}
+
+// clientGameData returns the game data of the client including the changes tracked since setGameData was called,
+// and whether it was set.
+func (t *Tracker) clientGameData() (minecraft.GameData, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.gameData == nil {
+		return minecraft.GameData{}, false
 	}
+	return *t.gameData, true
 }
 
-func (t *tracker) clearBossBars(s *Session) {
+// handlePacket retains the packet passed if it creates tracked state, or forgets the packets of the state it
+// removes.
+func (r *retainedState) handlePacket(pk packet.Packet) {
+	switch pk := pk.(type) {
+	case *packet.AddActor:
+		r.entities[pk.EntityUniqueID] = pk
+	case *packet.AddItemActor:
+		r.entities[pk.EntityUniqueID] = pk
+	case *packet.AddPainting:
+		r.entities[pk.EntityUniqueID] = pk
+	case *packet.AddPlayer:
+		r.entities[pk.AbilityData.EntityUniqueID] = pk
+	case *packet.BossEvent:
+		if pk.EventType == packet.BossEventShow {
+			r.bossBars[pk.BossEntityUniqueID] = pk
+		} else if pk.EventType == packet.BossEventHide {
+			delete(r.bossBars, pk.BossEntityUniqueID)
+		}
+	case *packet.MobEffect:
+		if pk.Operation == packet.MobEffectAdd || pk.Operation == packet.MobEffectModify {
+			r.effects[pk.EffectType] = pk
+		} else if pk.Operation == packet.MobEffectRemove {
+			delete(r.effects, pk.EffectType)
+		}
+	case *packet.PlayerList:
+		for _, entry := range pk.Entries {
+			if pk.ActionType == packet.PlayerListActionAdd {
+				r.players[entry.UUID] = entry
+			} else {
+				delete(r.players, entry.UUID)
+			}
+		}
+	case *packet.RemoveActor:
+		delete(r.bossBars, pk.EntityUniqueID)
+		delete(r.entities, pk.EntityUniqueID)
+	case *packet.RemoveObjective:
+		delete(r.scoreboards, pk.ObjectiveName)
+		delete(r.scores, pk.ObjectiveName)
+	case *packet.SetDisplayObjective:
+		if pk.ObjectiveName != "" {
+			r.scoreboards[pk.ObjectiveName] = pk
+		}
+	case *packet.SetScore:
+		for _, entry := range pk.Entries {
+			scores, ok := r.scores[entry.ObjectiveName]
+			if pk.ActionType == packet.ScoreboardActionRemove {
+				delete(scores, entry.EntryID)
+				continue
+			}
+			if !ok {
+				scores = make(map[int64]protocol.ScoreboardEntry)
+				r.scores[entry.ObjectiveName] = scores
+			}
+			scores[entry.EntryID] = entry
+		}
+	}
+}
+
+// replay writes the retained packets to the client of the session, recreating the tracked state on a client that
+// resumed the session. Chunks are written first so that entities are added within loaded chunks.
+func (t *Tracker) replay(s *Session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, chunk := range t.chunks {
+		_ = s.Client().WritePacket(chunk)
+	}
+	if t.retained == nil {
+		return
+	}
+
+	if len(t.retained.players) > 0 {
+		entries := make([]protocol.PlayerListEntry, 0, len(t.retained.players))
+		for _, entry := range t.retained.players {
+			entries = append(entries, entry)
+		}
+		_ = s.Client().WritePacket(&packet.PlayerList{ActionType: packet.PlayerListActionAdd, Entries: entries})
+	}
+	for _, pk := range t.retained.entities {
+		_ = s.Client().WritePacket(pk)
+	}
+	for _, pk := range t.retained.bossBars {
+		_ = s.Client().WritePacket(pk)
+	}
+	for _, pk := range t.retained.effects {
+		_ = s.Client().WritePacket(pk)
+	}
+	for _, pk := range t.retained.scoreboards {
+		_ = s.Client().WritePacket(pk)
+	}
+
+	var entries []protocol.ScoreboardEntry
+	for _, scores := range t.retained.scores {
+		for _, entry := range scores {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) > 0 {
+		_ = s.Client().WritePacket(&packet.SetScore{ActionType: packet.ScoreboardActionModify, Entries: entries})
+	}
+}
+
+func (t *Tracker) clearBossBars(s *Session) {
 	t.bossBars.Each(func(i int64) bool {
-		_ = s.client.WritePacket(&packet.BossEvent{
+		_ = s.Client().WritePacket(&packet.BossEvent{
 			BossEntityUniqueID: i,
 			EventType:          packet.BossEventHide,
 		})
 		return true
 	})
 	t.bossBars.Clear()
+	if t.retained != nil {
+		clear(t.retained.bossBars)
+	}
 }
 
-func (t *tracker) clearEffects(s *Session) {
+func (t *Tracker) clearEffects(s *Session) {
 	t.effects.Each(func(i int32) bool {
-		_ = s.client.WritePacket(&packet.MobEffect{
-			EntityRuntimeID: s.client.GameData().EntityRuntimeID,
+		_ = s.Client().WritePacket(&packet.MobEffect{
+			EntityRuntimeID: t.runtimeID,
 			EffectType:      i,
 			Operation:       packet.MobEffectRemove,
 		})
 		return true
 	})
 	t.effects.Clear()
+	if t.retained != nil {
+		clear(t.retained.effects)
+	}
 }
 
-func (t *tracker) clearEntities(s *Session) {
+func (t *Tracker) clearEntities(s *Session) {
 	t.entities.Each(func(i int64) bool {
-		_ = s.client.WritePacket(&packet.RemoveActor{
+		_ = s.Client().WritePacket(&packet.RemoveActor{
 			EntityUniqueID: i,
 		})
 		return true
 	})
 	t.entities.Clear()
+	if t.retained != nil {
+		clear(t.retained.entities)
+	}
 }
 
-func (t *tracker) clearPlayers(s *Session) {
-	entries := make([]protocol.PlayerListEntry, 0)
+func (t *Tracker) clearPlayers(s *Session) {
+	if t.players.IsEmpty() {
+		return
+	}
+
+	entries := make([]protocol.PlayerListEntry, 0, t.players.Size())
 	t.players.Each(func(i [16]byte) bool {
 		entries = append(entries, protocol.PlayerListEntry{
 			UUID: i,
@@ -109,19 +392,128 @@ func (t *tracker) clearPlayers(s *Session) {
 		return true
 	})
 	t.players.Clear()
+	if t.retained != nil {
+		clear(t.retained.players)
+	}
 
-	_ = s.client.WritePacket(&packet.PlayerList{
+	_ = s.Client().WritePacket(&packet.PlayerList{
 		ActionType: packet.PlayerListActionRemove,
 		Entries:    entries,
 	})
 }
 
-func (t *tracker) clearScoreboards(s *Session) {
+func (t *Tracker) clearScoreboards(s *Session) {
 	t.scoreboards.Each(func(i string) bool {
-		_ = s.client.WritePacket(&packet.RemoveObjective{
+		_ = s.Client().WritePacket(&packet.RemoveObjective{
 			ObjectiveName: i,
 		})
 		return true
 	})
 	t.scoreboards.Clear()
+	if t.retained != nil {
+		clear(t.retained.scoreboards)
+		clear(t.retained.scores)
+	}
+}
+
+// loadChunk marks the chunk at the position passed as held by the client. The chunk is no longer stale, since the
+// new server overwrote it.
+func (t *Tracker) loadChunk(pos protocol.ChunkPos) {
+	t.loaded[pos] = struct{}{}
+	delete(t.stale, pos)
+}
+
+// unloadOutOfRange forgets the chunks out of the range of the chunk publisher passed, which the client unloads.
+func (t *Tracker) unloadOutOfRange(pk *packet.NetworkChunkPublisherUpdate) {
+	radius := int32(pk.Radius>>4) + 1
+	centerX, centerZ := pk.Position.X()>>4, pk.Position.Z()>>4
+	outOfRange := func(pos protocol.ChunkPos) bool {
+		return abs(pos.X()-centerX) > radius || abs(pos.Z()-centerZ) > radius
+	}
+	maps.DeleteFunc(t.loaded, func(pos protocol.ChunkPos, _ struct{}) bool { return outOfRange(pos) })
+	maps.DeleteFunc(t.stale, func(pos protocol.ChunkPos, _ struct{}) bool { return outOfRange(pos) })
+	if t.chunks != nil {
+		maps.DeleteFunc(t.chunks, func(pos protocol.ChunkPos, _ *packet.LevelChunk) bool { return outOfRange(pos) })
+	}
+}
+
+// clearChunks forgets the chunks the client holds from the server it is transferred from. If publisher is not nil,
+// the transfer is seamless and the chunks in the range of the publisher remain visible on the client, so they are
+// marked stale to be unloaded by unloadStaleChunks unless the new server overwrites them first. Otherwise, the
+// dimension change of the transfer unloads all chunks and none need to be unloaded.
+func (t *Tracker) clearChunks(publisher *packet.NetworkChunkPublisherUpdate) {
+	if t.chunks != nil {
+		clear(t.chunks)
+	}
+	if publisher == nil {
+		clear(t.loaded)
+		t.stale = nil
+		return
+	}
+
+	t.stale, t.loaded = t.loaded, make(map[protocol.ChunkPos]struct{})
+	t.unloadOutOfRange(publisher)
+}
+
+// unloadStaleChunks overwrites the chunks that are still stale with empty chunks of the dimension passed, unloading
+// the chunks of the previous server that the new server did not send.
+func (t *Tracker) unloadStaleChunks(s *Session, dimension int32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.stale) == 0 {
+		return
+	}
+
+	chunk := emptyChunk(dimension)
+	for pos := range t.stale {
+		_ = s.Client().WritePacket(&packet.LevelChunk{
+			Dimension:     dimension,
+			Position:      pos,
+			SubChunkCount: 1,
+			RawPayload:    chunk,
+		})
+	}
+	s.logger.Debug("unloaded stale chunks", "count", len(t.stale))
+	t.stale = nil
+}
+
+// clearBlobs marks the blob hashes sent by the server the client is transferred from as stale, forgetting the
+// hashes of the servers before it.
+func (t *Tracker) clearBlobs() {
+	t.staleBlobs, t.blobs = t.blobs, make(map[uint64]struct{})
+}
+
+// hasStaleBlobs returns whether the client may still report the status of blob hashes of the previous server.
+func (t *Tracker) hasStaleBlobs() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.staleBlobs) > 0
+}
+
+// filterBlobStatus removes the hashes only known by the previous server from the status passed. It returns
+// whether any hashes remain, and whether any hashes were removed. Hashes not sent decoded by any server are
+// unknown to the tracker and always kept.
+func (t *Tracker) filterBlobStatus(pk *packet.ClientCacheBlobStatus) (keep bool, modified bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stale := func(hash uint64) bool {
+		_, current := t.blobs[hash]
+		_, previous := t.staleBlobs[hash]
+		delete(t.blobs, hash)
+		delete(t.staleBlobs, hash)
+		return previous && !current
+	}
+
+	count := len(pk.MissHashes) + len(pk.HitHashes)
+	pk.MissHashes = slices.DeleteFunc(pk.MissHashes, stale)
+	pk.HitHashes = slices.DeleteFunc(pk.HitHashes, stale)
+	remaining := len(pk.MissHashes) + len(pk.HitHashes)
+	return remaining > 0, remaining != count
+}
+
+func abs(x int32) int32 {
+	if x < 0 {
+		return -x
+	}
+	return x
 }
@@ -0,0 +1,150 @@
+package session
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/cooldogedev/spectrum/util"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// ValidationDisconnect disconnects sessions whose client sent a packet violating opts.Validation.
+const ValidationDisconnect = "disconnect"
+
+// validatedPackets holds the IDs of the client packets that are decoded to be validated if opts.Validation is set,
+// since they carry NBT, items or strings that are commonly abused to crash servers.
+var validatedPackets = map[uint32]struct{}{
+	packet.IDBlockActorData:       {},
+	packet.IDBookEdit:             {},
+	packet.IDCommandRequest:       {},
+	packet.IDEditorNetwork:        {},
+	packet.IDInventoryTransaction: {},
+	packet.IDItemStackRequest:     {},
+	packet.IDMobEquipment:         {},
+	packet.IDModalFormResponse:    {},
+	packet.IDNPCRequest:           {},
+	packet.IDPlayerAuthInput:      {},
+	packet.IDPlayerSkin:           {},
+	packet.IDText:                 {},
+}
+
+var (
+	itemStackType = reflect.TypeFor[protocol.ItemStack]()
+	nbtType       = reflect.TypeFor[map[string]any]()
+	nbtListType   = reflect.TypeFor[[]any]()
+)
+
+// validatePackets validates the packets of the batch against opts.Validation. Packets violating the limits are
+// dropped, or the session is closed if the action of the limits is ValidationDisconnect.
+func validatePackets(p *clientPipeline, batch []*PacketContext) ([]*PacketContext, error) {
+	limits := p.s.opts.Validation
+	if !limits.Enabled() {
+		return batch, nil
+	}
+
+	kept := batch[:0]
+	for _, ctx := range batch {
+		err := validatePacket(limits, ctx)
+		if err == nil {
+			kept = append(kept, ctx)
+			continue
+		}
+
+		ReturnPacketContext(ctx)
+		p.s.countValidationFailure()
+		if limits.Action == ValidationDisconnect {
+			err = fmt.Errorf("invalid packet: %w", err)
+			p.s.CloseWithError(err)
+			return nil, err
+		}
+		p.s.logger.Debug("dropped invalid packet", "err", err)
+	}
+	return kept, nil
+}
+
+// validatePacket validates the packet of the context against the limits passed. The size of the packet is always
+// validated, while its fields are only validated if it was decoded.
+func validatePacket(limits util.ValidationLimits, ctx *PacketContext) error {
+	if limits.MaxPacketSize > 0 && len(ctx.raw) > limits.MaxPacketSize {
+		return fmt.Errorf("packet %d is %d bytes, maximum is %d", ctx.id, len(ctx.raw), limits.MaxPacketSize)
+	}
+	if ctx.decoded == nil {
+		return nil
+	}
+	if err := validateValue(limits, reflect.ValueOf(ctx.decoded), 0); err != nil {
+		return fmt.Errorf("%T: %w", ctx.decoded, err)
+	}
+	return nil
+}
+
+// validateValue validates a value of a decoded packet and the values it holds against the limits passed. depth is
+// the NBT nesting depth the value is at.
+func validateValue(limits util.ValidationLimits, v reflect.Value, depth int) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return validateValue(limits, v.Elem(), depth)
+	case reflect.String:
+		if limits.MaxStringLength > 0 && v.Len() > limits.MaxStringLength {
+			return fmt.Errorf("string of %d bytes, maximum is %d", v.Len(), limits.MaxStringLength)
+		}
+	case reflect.Struct:
+		if v.Type() == itemStackType && limits.MaxItemCount > 0 {
+			if count := v.FieldByName("Count").Uint(); count > uint64(limits.MaxItemCount) {
+				return fmt.Errorf("item count of %d, maximum is %d", count, limits.MaxItemCount)
+			}
+		}
+		for i := range v.NumField() {
+			if err := validateValue(limits, v.Field(i), depth); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if v.Kind() != reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices are only bound by the size of the packet.
+			return nil
+		}
+		if v.Kind() != reflect.Array && limits.MaxArrayLength > 0 && v.Len() > limits.MaxArrayLength {
+			return fmt.Errorf("%s of %d elements, maximum is %d", v.Type(), v.Len(), limits.MaxArrayLength)
+		}
+		if v.Type() == nbtType || v.Type() == nbtListType {
+			depth++
+			if limits.MaxNBTDepth > 0 && depth > limits.MaxNBTDepth {
+				return fmt.Errorf("nbt nested %d levels deep, maximum is %d", depth, limits.MaxNBTDepth)
+			}
+		}
+		if !holdsValidatedValues(v.Type().Elem()) {
+			return nil
+		}
+
+		if v.Kind() == reflect.Map {
+			for iter := v.MapRange(); iter.Next(); {
+				if err := validateValue(limits, iter.Value(), depth); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for i := range v.Len() {
+			if err := validateValue(limits, v.Index(i), depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// holdsValidatedValues returns whether values of the type passed may hold values that are validated, so that
+// slices of numbers, such as positions, are not walked element by element.
+func holdsValidatedValues(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return false
+	default:
+		return true
+	}
+}
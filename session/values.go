@@ -0,0 +1,39 @@
+package session
+
+// values is a list of key-value pairs attached to a Context or PacketContext. A slice is used rather than a map,
+// since contexts usually hold only a handful of values and the slice can be reused once a context is returned to
+// its pool.
+type values []valueEntry
+
+// valueEntry is a single key-value pair of values.
+type valueEntry struct {
+	key   any
+	value any
+}
+
+// set sets the value of the key, replacing the previous value if the key was already set.
+func (v *values) set(key, value any) {
+	for i, entry := range *v {
+		if entry.key == key {
+			(*v)[i].value = value
+			return
+		}
+	}
+	*v = append(*v, valueEntry{key: key, value: value})
+}
+
+// get returns the value of the key, or nil if the key was not set.
+func (v values) get(key any) any {
+	for _, entry := range v {
+		if entry.key == key {
+			return entry.value
+		}
+	}
+	return nil
+}
+
+// reset removes all values while keeping the capacity of the slice.
+func (v *values) reset() {
+	clear(*v)
+	*v = (*v)[:0]
+}
@@ -2,14 +2,26 @@ package spectrum
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"expvar"
 	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"slices"
+	"sync"
+	"sync/atomic"
 
+	"github.com/cooldogedev/spectrum/metrics"
 	"github.com/cooldogedev/spectrum/server"
 	"github.com/cooldogedev/spectrum/session"
 	tr "github.com/cooldogedev/spectrum/transport"
 	"github.com/cooldogedev/spectrum/util"
 	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/resource"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // Spectrum represents a proxy server managing server discovery,
@@ -18,8 +30,19 @@ type Spectrum struct {
 	discovery server.Discovery
 	transport tr.Transport
 
-	listener *minecraft.Listener
-	registry *session.Registry
+	listener      *minecraft.Listener
+	debugServer   *http.Server
+	metricsServer *http.Server
+	processor     session.Processor
+	processorFunc func(s *session.Session) session.Processor
+	registry      *session.Registry
+	tracer        trace.TracerProvider
+	tokenProvider server.TokenProvider
+	eventBus      *session.EventBus
+	migration     session.MigrationStore
+
+	serverRegistry *server.Registry
+	draining       atomic.Bool
 
 	logger *slog.Logger
 	opts   util.Opts
@@ -40,7 +63,9 @@ func NewSpectrum(discovery server.Discovery, logger *slog.Logger, opts *util.Opt
 		discovery: discovery,
 		transport: transport,
 
-		registry: session.NewRegistry(),
+		processor: session.NopProcessor{},
+		registry:  session.NewRegistry(),
+		tracer:    noop.NewTracerProvider(),
 
 		logger: logger,
 		opts:   *opts,
@@ -51,6 +76,21 @@ func NewSpectrum(discovery server.Discovery, logger *slog.Logger, opts *util.Opt
 // The listener is then used by the Accept() method for accepting incoming connections.
 func (s *Spectrum) Listen(config minecraft.ListenConfig) (err error) {
 	config.EnableBatchReading = true
+	config.Compression = session.ObserveCompression(config.Compression)
+	fetchResourcePacks := config.FetchResourcePacks
+	config.FetchResourcePacks = func(identityData login.IdentityData, clientData login.ClientData, current []*resource.Pack) []*resource.Pack {
+		if fetchResourcePacks != nil {
+			current = fetchResourcePacks(identityData, clientData, current)
+		}
+
+		packs := slices.Clone(current)
+		ctx := session.NewContext()
+		s.processor.ProcessResourcePacks(ctx, &packs)
+		if ctx.Cancelled() {
+			return current
+		}
+		return packs
+	}
 	listener, err := config.Listen("raknet", s.opts.Addr)
 	if err != nil {
 		s.logger.Error("failed to listen", "err", err)
@@ -58,22 +98,95 @@ func (s *Spectrum) Listen(config minecraft.ListenConfig) (err error) {
 	}
 	s.listener = listener
 	s.logger.Info("started listening", "addr", listener.Addr())
+	if s.opts.DebugAddr != "" {
+		s.debugServer = s.serveHTTP("debug", s.opts.DebugAddr, s.debugHandler())
+	}
+	if s.opts.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		s.metricsServer = s.serveHTTP("metrics", s.opts.MetricsAddr, mux)
+	}
 	return nil
 }
 
+// debugHandler returns the handler of the debug listener, serving pprof profiles at /debug/pprof/, expvar
+// variables at /debug/vars and the state of all sessions at /debug/sessions.
+func (s *Spectrum) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/sessions", func(w http.ResponseWriter, _ *http.Request) {
+		sessions := s.registry.GetSessions()
+		states := make([]session.DebugState, 0, len(sessions))
+		for _, activeSession := range sessions {
+			states = append(states, activeSession.DebugState())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(states)
+	})
+	return mux
+}
+
+// serveHTTP starts an HTTP listener serving handler on addr in the background.
+func (s *Spectrum) serveHTTP(name string, addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("failed to serve "+name, "err", err)
+		}
+	}()
+	s.logger.Info("started serving "+name, "addr", addr)
+	return srv
+}
+
 // Accept accepts an incoming minecraft.Conn and creates a new session for it.
 // This method should be called in a loop to continuously accept new connections.
+// Clients rejected while draining and clients resuming a detached session do not get a new session, in which case
+// Accept waits for the next connection.
 func (s *Spectrum) Accept() (*session.Session, error) {
-	c, err := s.listener.Accept()
-	if err != nil {
-		s.logger.Error("failed to accept session", "err", err)
-		return nil, err
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			s.logger.Error("failed to accept session", "err", err)
+			return nil, err
+		}
+
+		conn := c.(*minecraft.Conn)
+		if s.draining.Load() {
+			_ = s.listener.Disconnect(conn, s.opts.ShutdownMessage)
+			continue
+		}
+
+		identityData := conn.IdentityData()
+		logger := s.logger.With("username", identityData.DisplayName)
+		if existing := s.registry.GetSession(identityData.XUID); existing != nil && s.opts.ResumeWindow > 0 && existing.Detached() {
+			go func() {
+				if err := existing.Reattach(conn); err != nil {
+					logger.Error("failed to resume session", "err", err)
+					_ = s.listener.Disconnect(conn, err.Error())
+				}
+			}()
+			continue
+		}
+		return s.startSession(conn, logger), nil
 	}
+}
 
-	conn := c.(*minecraft.Conn)
-	identityData := conn.IdentityData()
-	logger := s.logger.With("username", identityData.DisplayName)
+// startSession creates a new session for the connection and logs it in if opts.AutoLogin is enabled.
+func (s *Spectrum) startSession(conn *minecraft.Conn, logger *slog.Logger) *session.Session {
 	newSession := session.NewSession(conn, logger, s.registry, s.discovery, s.opts, s.transport)
+	newSession.SetTracerProvider(s.tracer)
+	newSession.SetTokenProvider(s.tokenProvider)
+	newSession.SetServerRegistry(s.serverRegistry)
+	newSession.SetEventBus(s.eventBus)
+	newSession.SetMigrationStore(s.migration)
+	if s.processorFunc != nil {
+		newSession.SetProcessor(s.processorFunc(newSession))
+	}
 	if s.opts.AutoLogin {
 		go func() {
 			if err := newSession.Login(); err != nil {
@@ -85,7 +198,52 @@ func (s *Spectrum) Accept() (*session.Session, error) {
 		}()
 	}
 	logger.Info("accepted session")
-	return newSession, nil
+	return newSession
+}
+
+// SetListenerProcessor sets the processor whose hooks are called for clients that are still logging in to the
+// listener and do not have a session yet, which is currently limited to ProcessResourcePacks. It must be called
+// before Listen. Processors of sessions are set using session.Session.SetProcessor instead.
+func (s *Spectrum) SetListenerProcessor(processor session.Processor) {
+	s.processor = processor
+}
+
+// SetSessionProcessor sets the function called for every session accepted afterwards to create its processor. The
+// processor is set before the session logs in, so unlike processors set using session.Session.SetProcessor after
+// Accept returns, its ProcessLogin hook is always called if opts.AutoLogin is enabled.
+func (s *Spectrum) SetSessionProcessor(fn func(s *session.Session) session.Processor) {
+	s.processorFunc = fn
+}
+
+// SetTracerProvider sets the OpenTelemetry tracer provider passed to every session accepted afterwards, whose
+// tracer records spans for the login, transfer and fallback flows of the sessions.
+func (s *Spectrum) SetTracerProvider(provider trace.TracerProvider) {
+	s.tracer = provider
+}
+
+// SetServerRegistry sets the registry of servers passed to every session accepted afterwards, which refuse to
+// transfer to servers while they are unhealthy.
+func (s *Spectrum) SetServerRegistry(registry *server.Registry) {
+	s.serverRegistry = registry
+}
+
+// SetEventBus sets the event bus passed to every session accepted afterwards, which the sessions publish their
+// lifecycle events to.
+func (s *Spectrum) SetEventBus(bus *session.EventBus) {
+	s.eventBus = bus
+}
+
+// SetMigrationStore sets the migration store passed to every session accepted afterwards. Sessions migrated to
+// this proxy by another proxy sharing the store are resumed on the server they were on, and Drain migrates the
+// sessions of this proxy instead of only transferring them.
+func (s *Spectrum) SetMigrationStore(store session.MigrationStore) {
+	s.migration = store
+}
+
+// SetTokenProvider sets the token provider passed to every session accepted afterwards, which provides the tokens
+// the proxy authenticates itself to servers with.
+func (s *Spectrum) SetTokenProvider(provider server.TokenProvider) {
+	s.tokenProvider = provider
 }
 
 // Discovery returns the server discovery instance.
@@ -113,10 +271,83 @@ func (s *Spectrum) Transport() tr.Transport {
 	return s.transport
 }
 
+// Drain stops accepting new sessions and evacuates all active sessions before closing Spectrum, so that restarting
+// the proxy does not kick every player. If target is not empty, clients are sent to the proxy at target, such as
+// another instance of Spectrum, using Session.TransferProxy, or using Session.Migrate if a migration store was set,
+// which resumes the sessions on the servers they were on. Otherwise, sessions are moved to their fallback servers
+// using Session.Fallback and stay there until they are closed. Sessions that cannot be evacuated are disconnected
+// gracefully with opts.ShutdownMessage. Drain waits for all sessions to be closed or for the context to be
+// canceled, after which Spectrum is closed, disconnecting any sessions that are left.
+func (s *Spectrum) Drain(ctx context.Context, target string) error {
+	s.draining.Store(true)
+	s.logger.Info("draining sessions", "target", target)
+	var wg sync.WaitGroup
+	for _, activeSession := range s.registry.GetSessions() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if target == "" {
+				if err := activeSession.Fallback(); err != nil {
+					s.logger.Debug("failed to fall back session", "err", err)
+					activeSession.Disconnect(s.opts.ShutdownMessage)
+					return
+				}
+
+				select {
+				case <-activeSession.Context().Done():
+				case <-ctx.Done():
+				}
+			} else if err := s.evacuate(ctx, activeSession, target); err != nil {
+				s.logger.Debug("failed to evacuate session", "err", err)
+				activeSession.Disconnect(s.opts.ShutdownMessage)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = context.Cause(ctx)
+	}
+
+	if closeErr := s.Close(); closeErr != nil {
+		return errors.Join(err, closeErr)
+	}
+	return err
+}
+
+// evacuate sends the session passed to the proxy at target, migrating it if a migration store was set. Sessions
+// that cannot be migrated, such as those of players without an XUID, are transferred without their state.
+func (s *Spectrum) evacuate(ctx context.Context, activeSession *session.Session, target string) error {
+	if s.migration == nil {
+		return activeSession.TransferProxy(target)
+	}
+
+	if err := activeSession.Migrate(ctx, target); err != nil {
+		s.logger.Debug("failed to migrate session, transferring instead", "err", err)
+		return activeSession.TransferProxy(target)
+	}
+	return nil
+}
+
 // Close closes the listener and stops listening for incoming connections.
 func (s *Spectrum) Close() error {
 	for _, activeSession := range s.registry.GetSessions() {
 		activeSession.Disconnect(s.opts.ShutdownMessage)
 	}
+
+	if s.debugServer != nil {
+		_ = s.debugServer.Close()
+	}
+	if s.metricsServer != nil {
+		_ = s.metricsServer.Close()
+	}
 	return s.listener.Close()
 }
@@ -0,0 +1,30 @@
+// Package tracing holds the helpers Spectrum uses to record OpenTelemetry spans for the login, transfer and
+// fallback flows of sessions. Spans are recorded using the tracer of the trace.TracerProvider passed to
+// Spectrum.SetTracerProvider.
+package tracing
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Name is the instrumentation name of the tracer Spectrum obtains from a trace.TracerProvider.
+const Name = "github.com/cooldogedev/spectrum"
+
+// Tracer returns the tracer of the provider passed, or a tracer that records nothing if the provider is nil.
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = noop.NewTracerProvider()
+	}
+	return provider.Tracer(Name)
+}
+
+// End ends the span, recording err first and marking the span as failed if it is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,102 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+// KCP implements the ListenTransport interface to establish connections to servers using KCP, a reliable protocol
+// on top of UDP. KCP retransmits lost segments sooner than TCP and does not stall every stream behind a single lost
+// segment, which shortens logins and transfers to servers across high-latency or lossy links at the cost of using
+// more bandwidth. Every connection uses its own KCP session.
+type KCP struct{}
+
+// NewKCP creates a new KCP transport instance.
+func NewKCP() *KCP {
+	return &KCP{}
+}
+
+// Dial ...
+func (k *KCP) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, context.Cause(ctx)
+	}
+
+	conn, err := kcp.DialWithOptions(addr, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	configureKCP(conn)
+	return conn, nil
+}
+
+// Listen ...
+func (k *KCP) Listen(ctx context.Context, addr string) (Listener, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, context.Cause(ctx)
+	}
+
+	listener, err := kcp.ListenWithOptions(addr, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &kcpListener{listener: listener}, nil
+}
+
+// configureKCP configures a KCP session for the low latency gameplay traffic requires, acknowledging and
+// retransmitting segments without delay.
+func configureKCP(conn *kcp.UDPSession) {
+	conn.SetStreamMode(true)
+	conn.SetWriteDelay(false)
+	conn.SetNoDelay(1, 10, 2, 1)
+	conn.SetWindowSize(1024, 1024)
+	conn.SetACKNoDelay(true)
+}
+
+// kcpListener implements the Listener interface for the KCP transport.
+type kcpListener struct {
+	listener *kcp.Listener
+}
+
+// Accept ...
+func (l *kcpListener) Accept(ctx context.Context) (io.ReadWriteCloser, error) {
+	type result struct {
+		conn *kcp.UDPSession
+		err  error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := l.listener.AcceptKCP()
+		ch <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return nil, r.err
+		}
+		configureKCP(r.conn)
+		return r.conn, nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.conn != nil {
+				_ = r.conn.Close()
+			}
+		}()
+		return nil, context.Cause(ctx)
+	}
+}
+
+// Addr ...
+func (l *kcpListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Close ...
+func (l *kcpListener) Close() error {
+	return l.listener.Close()
+}
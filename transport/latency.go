@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// latencySmoothing is the weight of a new measurement in the smoothed round-trip time of a server.
+const latencySmoothing = 0.25
+
+// Latency implements the Transport interface by measuring the duration of every dial made using another
+// transport, which serves as an estimate of the round-trip time (RTT) between the proxy and the server dialed.
+// The estimate includes handshakes of the transport, such as those of TLS or QUIC, so it is only comparable
+// between servers dialed using the same transport. Measurements are smoothed, so that a single slow dial does
+// not skew the estimate. Dialing servers periodically, such as using a server.HealthChecker, keeps the
+// estimates of all servers up to date.
+type Latency struct {
+	transport Transport
+	rtt       map[string]time.Duration
+	mu        sync.RWMutex
+}
+
+// NewLatency creates a new Latency transport measuring dials made using the transport passed.
+func NewLatency(transport Transport) *Latency {
+	return &Latency{
+		transport: transport,
+		rtt:       make(map[string]time.Duration),
+	}
+}
+
+// Dial ...
+func (l *Latency) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	start := time.Now()
+	conn, err := l.transport.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	l.record(addr, time.Since(start))
+	return conn, nil
+}
+
+// RTT returns the estimated round-trip time to the server with the address passed, and whether the server was
+// dialed successfully before.
+func (l *Latency) RTT(addr string) (time.Duration, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	rtt, ok := l.rtt[addr]
+	return rtt, ok
+}
+
+// Forget removes the estimate of the server with the address passed, such as after it was removed.
+func (l *Latency) Forget(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.rtt, addr)
+}
+
+// record adds a measurement to the smoothed round-trip time of the server with the address passed.
+func (l *Latency) record(addr string, rtt time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if previous, ok := l.rtt[addr]; ok {
+		rtt = previous + time.Duration(float64(rtt-previous)*latencySmoothing)
+	}
+	l.rtt[addr] = rtt
+}
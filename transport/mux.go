@@ -0,0 +1,395 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+const (
+	muxFrameOpen byte = iota
+	muxFrameData
+	muxFrameClose
+
+	muxHeaderSize      = 9
+	muxMaxFrameSize    = 1024 * 1024 * 16 // 16MB
+	muxAcceptQueueSize = 64
+)
+
+// Mux implements the ListenTransport interface by multiplexing the connections to a server as streams over a
+// single connection established using another transport, such as TCP or TLS. Like QUIC and Spectral, it
+// maintains a single connection per server, so thousands of sessions on the same server do not each hold a
+// connection and transfers only need to open a stream instead of dialing. Servers must listen using a Mux
+// transport wrapping the same transport.
+//
+// Streams do not use flow control, so data read from the connection is buffered until the stream it belongs to
+// is read from.
+type Mux struct {
+	transport Transport
+	sessions  map[string]*muxSession
+	logger    *slog.Logger
+	mu        sync.Mutex
+}
+
+// NewMux creates a new Mux transport multiplexing streams over connections established using the transport
+// passed. The transport must implement ListenTransport for Listen to be used.
+func NewMux(transport Transport, logger *slog.Logger) *Mux {
+	return &Mux{
+		transport: transport,
+		sessions:  make(map[string]*muxSession),
+		logger:    logger,
+	}
+}
+
+// Dial ...
+func (m *Mux) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[addr]
+	if !ok {
+		conn, err := m.transport.Dial(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		session = newMuxSession(conn, nil)
+		m.sessions[addr] = session
+		m.logger.Debug("established connection", "addr", addr)
+		go func(session *muxSession, addr string) {
+			<-session.closed
+			m.mu.Lock()
+			if found, ok := m.sessions[addr]; ok && found == session {
+				delete(m.sessions, addr)
+			}
+			m.mu.Unlock()
+			m.logger.Debug("closed connection", "addr", addr, "cause", session.err)
+		}(session, addr)
+	}
+
+	stream, err := session.open()
+	if err != nil {
+		delete(m.sessions, addr)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Listen ...
+func (m *Mux) Listen(ctx context.Context, addr string) (Listener, error) {
+	transport, ok := m.transport.(ListenTransport)
+	if !ok {
+		return nil, fmt.Errorf("transport %T cannot listen", m.transport)
+	}
+
+	listener, err := transport.Listen(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &muxListener{
+		listener: listener,
+		streams:  make(chan *muxStream, muxAcceptQueueSize),
+		closed:   make(chan struct{}),
+	}
+	go l.acceptConns()
+	return l, nil
+}
+
+// muxListener implements the Listener interface for the Mux transport, accepting the streams opened on any
+// connection accepted by the underlying listener.
+type muxListener struct {
+	listener Listener
+	streams  chan *muxStream
+
+	closed chan struct{}
+	once   sync.Once
+}
+
+// Accept ...
+func (l *muxListener) Accept(ctx context.Context) (io.ReadWriteCloser, error) {
+	select {
+	case stream := <-l.streams:
+		return stream, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// Addr ...
+func (l *muxListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Close ...
+func (l *muxListener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.closed)
+		err = l.listener.Close()
+	})
+	return err
+}
+
+// acceptConns accepts connections from the underlying listener until it is closed, starting a session for
+// each of them that passes the streams opened on it to the listener.
+func (l *muxListener) acceptConns() {
+	for {
+		conn, err := l.listener.Accept(context.Background())
+		if err != nil {
+			_ = l.Close()
+			return
+		}
+		newMuxSession(conn, l)
+	}
+}
+
+// muxSession multiplexes streams over a single connection. Streams are opened by the dialing side.
+type muxSession struct {
+	conn     io.ReadWriteCloser
+	listener *muxListener
+
+	streams map[uint32]*muxStream
+	nextID  uint32
+	mu      sync.Mutex
+	writeMu sync.Mutex
+
+	closed chan struct{}
+	err    error
+	once   sync.Once
+}
+
+// newMuxSession creates a new muxSession over the connection passed and starts reading from it. listener is
+// the listener streams opened by the other side are passed to, which is nil for dialed connections.
+func newMuxSession(conn io.ReadWriteCloser, listener *muxListener) *muxSession {
+	s := &muxSession{
+		conn:     conn,
+		listener: listener,
+		streams:  make(map[uint32]*muxStream),
+		closed:   make(chan struct{}),
+	}
+	go s.read()
+	return s
+}
+
+// open opens a new stream on the session.
+func (s *muxSession) open() (*muxStream, error) {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return nil, s.err
+	default:
+	}
+	s.nextID++
+	stream := newMuxStream(s, s.nextID)
+	s.streams[stream.id] = stream
+	s.mu.Unlock()
+
+	if err := s.writeFrame(muxFrameOpen, stream.id, nil); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// read reads frames from the connection and dispatches them to their streams until the connection fails.
+func (s *muxSession) read() {
+	header := make([]byte, muxHeaderSize)
+	for {
+		if _, err := io.ReadFull(s.conn, header); err != nil {
+			s.close(err)
+			return
+		}
+
+		frame, id, length := header[0], binary.BigEndian.Uint32(header[1:5]), binary.BigEndian.Uint32(header[5:9])
+		if length > muxMaxFrameSize {
+			s.close(fmt.Errorf("frame of %d bytes exceeds maximum of %d", length, muxMaxFrameSize))
+			return
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(s.conn, payload); err != nil {
+			s.close(err)
+			return
+		}
+
+		s.mu.Lock()
+		stream, ok := s.streams[id]
+		if frame == muxFrameOpen && !ok && s.listener != nil {
+			stream = newMuxStream(s, id)
+			s.streams[id] = stream
+		}
+		s.mu.Unlock()
+
+		switch frame {
+		case muxFrameOpen:
+			if s.listener == nil || ok {
+				s.close(fmt.Errorf("unexpected open frame for stream %d", id))
+				return
+			}
+
+			select {
+			case s.listener.streams <- stream:
+			case <-s.listener.closed:
+				s.close(net.ErrClosed)
+				return
+			}
+		case muxFrameData:
+			if ok {
+				stream.push(payload)
+			}
+		case muxFrameClose:
+			if ok {
+				s.remove(id)
+				stream.closeRead(io.EOF)
+			}
+		default:
+			s.close(fmt.Errorf("unknown frame type %d", frame))
+			return
+		}
+	}
+}
+
+// writeFrame writes a single frame to the connection.
+func (s *muxSession) writeFrame(frame byte, id uint32, payload []byte) error {
+	if len(payload) > muxMaxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds maximum of %d", len(payload), muxMaxFrameSize)
+	}
+
+	buf := make([]byte, muxHeaderSize+len(payload))
+	buf[0] = frame
+	binary.BigEndian.PutUint32(buf[1:5], id)
+	binary.BigEndian.PutUint32(buf[5:9], uint32(len(payload)))
+	copy(buf[muxHeaderSize:], payload)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	select {
+	case <-s.closed:
+		return s.err
+	default:
+	}
+
+	if _, err := s.conn.Write(buf); err != nil {
+		s.close(err)
+		return err
+	}
+	return nil
+}
+
+// remove removes the stream with the ID passed from the session.
+func (s *muxSession) remove(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
+
+// close closes the session and all of its streams with the error passed.
+func (s *muxSession) close(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.err = fmt.Errorf("mux session closed: %w", err)
+		close(s.closed)
+		streams := s.streams
+		s.streams = make(map[uint32]*muxStream)
+		s.mu.Unlock()
+
+		_ = s.conn.Close()
+		for _, stream := range streams {
+			stream.closeRead(s.err)
+		}
+	})
+}
+
+// muxStream is a single stream of a muxSession.
+type muxStream struct {
+	id      uint32
+	session *muxSession
+
+	buf  bytes.Buffer
+	err  error
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	once sync.Once
+}
+
+// newMuxStream creates a new stream with the ID passed on the session.
+func newMuxStream(session *muxSession, id uint32) *muxStream {
+	stream := &muxStream{id: id, session: session}
+	stream.cond = sync.NewCond(&stream.mu)
+	return stream
+}
+
+// Read ...
+func (s *muxStream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.buf.Len() == 0 && s.err == nil {
+		s.cond.Wait()
+	}
+
+	if s.buf.Len() > 0 {
+		return s.buf.Read(p)
+	}
+	return 0, s.err
+}
+
+// Write ...
+func (s *muxStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	err := s.err
+	s.mu.Unlock()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	for written := 0; written < len(p); {
+		n := min(len(p)-written, muxMaxFrameSize)
+		if err := s.session.writeFrame(muxFrameData, s.id, p[written:written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return len(p), nil
+}
+
+// Close ...
+func (s *muxStream) Close() error {
+	var err error
+	s.once.Do(func() {
+		s.session.remove(s.id)
+		s.closeRead(net.ErrClosed)
+		err = s.session.writeFrame(muxFrameClose, s.id, nil)
+	})
+	return err
+}
+
+// push appends data read from the connection to the buffer of the stream.
+func (s *muxStream) push(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.buf.Write(data)
+		s.cond.Broadcast()
+	}
+}
+
+// closeRead closes the read side of the stream, returning the error passed from Read once the buffered data
+// was read.
+func (s *muxStream) closeRead(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+		s.cond.Broadcast()
+	}
+}
@@ -0,0 +1,202 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// poolRetryDelay is the delay before a Pool dials a server again after dialing it failed.
+const poolRetryDelay = time.Second
+
+// Pool implements the Transport interface by keeping a number of connections to frequently used servers, such
+// as lobbies, dialed in advance using another transport. Dialing such a server takes a connection from the pool
+// instead of dialing, which saves the round trips of establishing the connection, including TCP and TLS
+// handshakes, when transferring many players at once. The spectrum connection sequence itself depends on the
+// player and still takes place once a connection is taken. Servers that are not warmed are dialed directly.
+type Pool struct {
+	transport Transport
+	size      int
+	maxIdle   time.Duration
+	logger    *slog.Logger
+
+	servers map[string]*poolServer
+	mu      sync.Mutex
+}
+
+// NewPool creates a new Pool keeping up to size connections per warmed server ready using the transport passed.
+// Connections that were not taken within maxIdle are closed and replaced, so that they are not timed out by
+// the server. A maxIdle of zero keeps connections indefinitely.
+func NewPool(transport Transport, size int, maxIdle time.Duration, logger *slog.Logger) *Pool {
+	return &Pool{
+		transport: transport,
+		size:      size,
+		maxIdle:   maxIdle,
+		logger:    logger,
+		servers:   make(map[string]*poolServer),
+	}
+}
+
+// Warm starts keeping connections to the server with the address passed ready. It has no effect if the server
+// is already warmed.
+func (p *Pool) Warm(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.servers[addr]; ok {
+		return
+	}
+
+	server := &poolServer{
+		conns:  make(chan pooledConn, p.size),
+		closed: make(chan struct{}),
+	}
+	p.servers[addr] = server
+	go p.fill(addr, server)
+}
+
+// Cool stops keeping connections to the server with the address passed ready and closes the connections
+// that are ready.
+func (p *Pool) Cool(addr string) {
+	p.mu.Lock()
+	server, ok := p.servers[addr]
+	delete(p.servers, addr)
+	p.mu.Unlock()
+	if ok {
+		server.close()
+	}
+}
+
+// Close cools all warmed servers.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	servers := p.servers
+	p.servers = make(map[string]*poolServer)
+	p.mu.Unlock()
+	for _, server := range servers {
+		server.close()
+	}
+	return nil
+}
+
+// Dial ...
+func (p *Pool) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	p.mu.Lock()
+	server, ok := p.servers[addr]
+	p.mu.Unlock()
+	for ok {
+		select {
+		case conn := <-server.conns:
+			if !p.expired(conn) {
+				return conn.ReadWriteCloser, nil
+			}
+			_ = conn.Close()
+		default:
+			ok = false
+		}
+	}
+	return p.transport.Dial(ctx, addr)
+}
+
+// fill keeps the connections of a warmed server topped up until it is cooled, closing the connections that
+// are ready once it is.
+func (p *Pool) fill(addr string, server *poolServer) {
+	defer server.drain()
+	var ticker <-chan time.Time
+	if p.maxIdle > 0 {
+		t := time.NewTicker(p.maxIdle / 2)
+		defer t.Stop()
+		ticker = t.C
+	}
+
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-server.closed:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		conn, err := p.transport.Dial(ctx, addr)
+		cancel()
+		if err != nil {
+			p.logger.Debug("failed to dial pooled connection", "addr", addr, "err", err)
+			select {
+			case <-server.closed:
+				return
+			case <-time.After(poolRetryDelay):
+				continue
+			}
+		}
+
+		pooled := pooledConn{ReadWriteCloser: conn, created: time.Now()}
+		for {
+			select {
+			case server.conns <- pooled:
+			case <-ticker:
+				// Replace expired connections that are ready, so that only fresh connections are taken.
+				p.evict(server)
+				continue
+			case <-server.closed:
+				_ = conn.Close()
+				return
+			}
+			break
+		}
+	}
+}
+
+// evict closes the expired connections that are ready for the server passed.
+func (p *Pool) evict(server *poolServer) {
+	for range len(server.conns) {
+		select {
+		case conn := <-server.conns:
+			if !p.expired(conn) {
+				server.conns <- conn
+				continue
+			}
+			_ = conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// expired returns whether the pooled connection passed exceeded the maximum idle duration.
+func (p *Pool) expired(conn pooledConn) bool {
+	return p.maxIdle > 0 && time.Since(conn.created) > p.maxIdle
+}
+
+// poolServer holds the connections that are ready for a warmed server.
+type poolServer struct {
+	conns  chan pooledConn
+	closed chan struct{}
+	once   sync.Once
+}
+
+// close stops filling the server's connections.
+func (s *poolServer) close() {
+	s.once.Do(func() {
+		close(s.closed)
+	})
+}
+
+// drain closes the connections that are ready.
+func (s *poolServer) drain() {
+	for {
+		select {
+		case conn := <-s.conns:
+			_ = conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// pooledConn is a connection held by a Pool along with the time it was established at.
+type pooledConn struct {
+	io.ReadWriteCloser
+	created time.Time
+}
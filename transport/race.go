@@ -0,0 +1,85 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Race implements the Transport interface by dialing every address configured for a server at once using
+// another transport, returning the connection established first. Dials that lose the race are canceled and
+// their connections closed. This allows servers reachable through several addresses, such as replicas behind
+// different links, to be connected to through whichever responds first, so that a single hung address does not
+// stall transfers. Servers without configured addresses are dialed as is.
+type Race struct {
+	transport Transport
+	addrs     map[string][]string
+	mu        sync.RWMutex
+}
+
+// NewRace creates a new Race transport dialing addresses using the transport passed.
+func NewRace(transport Transport) *Race {
+	return &Race{
+		transport: transport,
+		addrs:     make(map[string][]string),
+	}
+}
+
+// Set sets the addresses dialed for the server with the address passed. Passing no addresses removes the
+// addresses configured for the server, so that it is dialed as is again.
+func (r *Race) Set(addr string, addrs ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(addrs) == 0 {
+		delete(r.addrs, addr)
+		return
+	}
+	r.addrs[addr] = addrs
+}
+
+// Dial ...
+func (r *Race) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	r.mu.RLock()
+	addrs, ok := r.addrs[addr]
+	r.mu.RUnlock()
+	if !ok {
+		return r.transport.Dial(ctx, addr)
+	}
+
+	type result struct {
+		conn io.ReadWriteCloser
+		err  error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, len(addrs))
+	for _, addr := range addrs {
+		go func() {
+			conn, err := r.transport.Dial(ctx, addr)
+			results <- result{conn: conn, err: err}
+		}()
+	}
+
+	var errs []error
+	for remaining := len(addrs); remaining > 0; remaining-- {
+		res := <-results
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+
+		cancel()
+		go func(remaining int) {
+			for range remaining {
+				if res := <-results; res.conn != nil {
+					_ = res.conn.Close()
+				}
+			}
+		}(remaining - 1)
+		return res.conn, nil
+	}
+	return nil, errors.Join(errs...)
+}
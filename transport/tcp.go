@@ -0,0 +1,88 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+)
+
+// TCP implements the ListenTransport interface to establish connections to servers using plain TCP. Every
+// connection uses its own TCP connection, which makes it the simplest transport to run servers with, at the cost
+// of a TCP handshake for every dial.
+type TCP struct {
+	dialer       net.Dialer
+	listenConfig net.ListenConfig
+}
+
+// NewTCP creates a new TCP transport instance.
+func NewTCP() *TCP {
+	return &TCP{}
+}
+
+// Dial ...
+func (t *TCP) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	conn, err := t.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetNoDelay(true)
+	}
+	return conn, nil
+}
+
+// Listen ...
+func (t *TCP) Listen(ctx context.Context, addr string) (Listener, error) {
+	listener, err := t.listenConfig.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &tcpListener{listener: listener}, nil
+}
+
+// tcpListener implements the Listener interface for the TCP transport.
+type tcpListener struct {
+	listener net.Listener
+}
+
+// Accept ...
+func (l *tcpListener) Accept(ctx context.Context) (io.ReadWriteCloser, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := l.listener.Accept()
+		ch <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return nil, r.err
+		}
+		if tcpConn, ok := r.conn.(*net.TCPConn); ok {
+			_ = tcpConn.SetNoDelay(true)
+		}
+		return r.conn, nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.conn != nil {
+				_ = r.conn.Close()
+			}
+		}()
+		return nil, context.Cause(ctx)
+	}
+}
+
+// Addr ...
+func (l *tcpListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Close ...
+func (l *tcpListener) Close() error {
+	return l.listener.Close()
+}
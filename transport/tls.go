@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// TLS implements the ListenTransport interface to establish connections to servers using TLS over TCP. With a
+// configuration returned by LoadMutualTLSConfig, both sides authenticate each other using certificates signed by
+// a shared CA, which encrypts traffic crossing untrusted networks and verifies the identity of servers and proxies.
+// Different certificates may be used for different servers by setting the Transport of servers in a server.Registry.
+type TLS struct {
+	config *tls.Config
+	tcp    *TCP
+}
+
+// NewTLS creates a new TLS transport instance using the configuration passed for both dialing and listening.
+func NewTLS(config *tls.Config) *TLS {
+	return &TLS{config: config, tcp: NewTCP()}
+}
+
+// Dial ...
+func (t *TLS) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	conn, err := t.tcp.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	config := t.config.Clone()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		config.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn.(net.Conn), config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("tls handshake failed: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// Listen ...
+func (t *TLS) Listen(ctx context.Context, addr string) (Listener, error) {
+	listener, err := t.tcp.Listen(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsListener{Listener: listener, config: t.config}, nil
+}
+
+// tlsListener implements the Listener interface for the TLS transport, performing the TLS handshake of every
+// connection before it is returned by Accept.
+type tlsListener struct {
+	Listener
+	config *tls.Config
+}
+
+// Accept ...
+func (l *tlsListener) Accept(ctx context.Context) (io.ReadWriteCloser, error) {
+	conn, err := l.Listener.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Server(conn.(net.Conn), l.config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("tls handshake failed: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// LoadMutualTLSConfig loads a configuration for mutual TLS from PEM encoded files. The certificate and key
+// identify this side of the connection, while the CA is used to verify the certificate of the other side,
+// which is required in both directions.
+func LoadMutualTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("failed to parse CA")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"spectrum"},
+	}, nil
+}
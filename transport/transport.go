@@ -3,6 +3,7 @@ package transport
 import (
 	"context"
 	"io"
+	"net"
 )
 
 // Transport defines an interface for establishing server connections.
@@ -12,3 +13,22 @@ type Transport interface {
 	// timeouts and cancellations.
 	Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error)
 }
+
+// ListenTransport is a Transport that can also accept connections, which is used by servers to accept
+// connections from proxies dialing them using the same transport.
+type ListenTransport interface {
+	Transport
+	// Listen starts listening for connections on the specified address. The provided context is only used
+	// while setting up the listener.
+	Listen(ctx context.Context, addr string) (Listener, error)
+}
+
+// Listener accepts connections dialed using a Transport.
+type Listener interface {
+	// Accept waits for and returns the next connection. The provided context is used for cancellation.
+	Accept(ctx context.Context) (io.ReadWriteCloser, error)
+	// Addr returns the address the listener is listening on.
+	Addr() net.Addr
+	// Close closes the listener, unblocking any calls to Accept.
+	Close() error
+}
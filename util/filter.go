@@ -0,0 +1,34 @@
+package util
+
+// FilterRule is a packet filter rule as configured in Opts.FilterRules. Rules match the packets sent in a
+// direction with a specific ID and, optionally, field conditions, and drop, log or rate-limit the packets
+// matched, without requiring a processor.
+type FilterRule struct {
+	// Name is the name of the rule, which is logged for the packets it matches.
+	Name string `yaml:"name"`
+	// Direction is the side that sent the packets the rule applies to, either "client" or "server".
+	Direction string `yaml:"direction"`
+	// ID is the ID of the packets the rule applies to.
+	ID uint32 `yaml:"id"`
+	// Action is what is done with the packets matched, either "drop", "log" or "rate_limit".
+	Action string `yaml:"action"`
+	// Rate is the maximum amount of matched packets per second that are forwarded if Action is "rate_limit". The
+	// packets exceeding it are dropped.
+	Rate int64 `yaml:"rate"`
+	// Fields are conditions on the fields of the packets that must all be met for a packet to be matched. Rules
+	// with conditions only match decoded packets, which is why the client packets they apply to are always
+	// decoded.
+	Fields []FieldCondition `yaml:"fields"`
+}
+
+// FieldCondition is a condition on a field of a packet matched by a FilterRule.
+type FieldCondition struct {
+	// Field is the name of the field, such as "Message". Fields of nested structs are separated by dots, such as
+	// "AbilityData.EntityUniqueID".
+	Field string `yaml:"field"`
+	// Op is the comparison applied to the field, either "eq", "ne", "lt", "gt", "len_lt", "len_gt" or "contains".
+	// The length comparisons apply to strings, slices and maps, and contains applies to strings.
+	Op string `yaml:"op"`
+	// Value is the value the field is compared with.
+	Value string `yaml:"value"`
+}
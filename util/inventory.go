@@ -0,0 +1,24 @@
+package util
+
+// InventoryLimits are the structural checks inventory transactions and item stack requests sent by clients are
+// subject to before they are forwarded to servers, so that malformed transactions used by exploits are not relayed.
+// A limit of zero is not enforced.
+type InventoryLimits struct {
+	// MaxSlot is the highest inventory slot an action may refer to.
+	MaxSlot int `yaml:"max_slot"`
+	// MaxActions is the maximum amount of actions of a single inventory transaction or item stack request.
+	MaxActions int `yaml:"max_actions"`
+	// MaxRequests is the maximum amount of item stack requests in a single ItemStackRequest packet.
+	MaxRequests int `yaml:"max_requests"`
+	// RequestOrder determines whether the IDs of item stack requests must be lower than the ID of the previous
+	// request, as clients assign decreasing IDs to their requests.
+	RequestOrder bool `yaml:"request_order"`
+	// Action is what is done with packets failing the checks, either "drop" or "disconnect". When empty, the
+	// packets are dropped.
+	Action string `yaml:"action"`
+}
+
+// Enabled returns whether any of the checks is enforced.
+func (l InventoryLimits) Enabled() bool {
+	return l.MaxSlot > 0 || l.MaxActions > 0 || l.MaxRequests > 0 || l.RequestOrder
+}
@@ -1,33 +1,254 @@
 package util
 
+import "time"
+
 // Opts defines the configuration options for Spectrum.
 type Opts struct {
 	// Addr is the address to listen on.
 	Addr string `yaml:"addr"`
+	// AsyncProcessorWorkers is the amount of goroutines per session and direction that run the processor's
+	// ProcessClient, ProcessServer and ProcessFlush hooks, so that heavy processors do not block reading from the
+	// connections. Packets are still written in the order they were read in. Since the hooks of consecutive
+	// packets may then run concurrently, the processor must be safe for concurrent use. Zero runs the hooks on
+	// the goroutines reading the packets.
+	AsyncProcessorWorkers int `yaml:"async_processor_workers"`
 	// AutoLogin determines whether automatic login should be enabled.
 	AutoLogin bool `yaml:"auto_login"`
+	// BatchServerPackets determines whether the packets read from a server are collected up to the next Flush
+	// packet of the server and passed to the processor's ProcessServerBatch hook as a unit instead of being passed
+	// to ProcessServer one by one, so that processors can make decisions across a whole tick of the server. The
+	// collected packets are written to the client before it is flushed. Servers that do not send Flush packets
+	// have their packets forwarded in batches of 512 packets.
+	BatchServerPackets bool `yaml:"batch_server_packets"`
+	// CacheChunks determines whether the tracker keeps the most recent LevelChunk packet for every chunk around
+	// the player, allowing chunks to be sent again using Session.ResendChunk. Only LevelChunk packets the server
+	// sends decoded are cached, and the cache is cleared on transfers and dimension changes. This increases memory
+	// usage considerably and has no effect if DisableTracker is enabled.
+	CacheChunks bool `yaml:"cache_chunks"`
+	// CacheRegistries determines whether sessions cache the most recent CreativeContent, AvailableCommands and
+	// BiomeDefinitionList packets sent to the client and declare their hashes to servers that support it. Servers
+	// holding a packet with the same hash send a CachedRegistry packet instead, after which the cached packet is
+	// sent to the client by the proxy. Only packets the server sends raw are cached.
+	CacheRegistries bool `yaml:"cache_registries"`
+	// ClientBandwidthLimit is the maximum amount of bytes per second read from a client, measured as the size of
+	// the decompressed packets. Clients sending more are slowed down by delaying reads, which eventually applies
+	// back pressure to the client. Zero disables the limit.
+	ClientBandwidthLimit int64 `yaml:"client_bandwidth_limit"`
+	// ClientBatchDelay is the maximum duration the server packets written to a client are batched for before the
+	// client is flushed, counted from the first packet of the batch. Batches are flushed early once they reach
+	// ClientBatchSize or the server sends a Flush packet. Batching only has an effect if the automatic flushing of
+	// the minecraft.ListenConfig, controlled by its FlushRate, is slower or disabled. Zero disables the delay.
+	ClientBatchDelay time.Duration `yaml:"client_batch_delay"`
+	// ClientBatchSize is the amount of bytes of raw server packets written to a client after which the client is
+	// flushed. Packets the server sends decoded do not count towards the size. Zero disables the limit.
+	ClientBatchSize int `yaml:"client_batch_size"`
 	// EnableAllClientDecode is a boolean indicating if all packets should be attempted to be decoded by the proxy.
 	EnableAllClientDecode bool `yaml:"enable_all_client_decode"`
-	// ClientDecode is a list of client packet identifiers that need to be decoded by the proxy.
+	// ClientDecode is a list of client packet identifiers that need to be decoded by the proxy. It may be replaced
+	// per session using Session.SetClientDecode.
 	ClientDecode map[uint32]struct{} `yaml:"client_decode"`
+	// ClientDecodeMode determines how ClientDecode is interpreted, either "allow", "deny" or "all". Allow decodes
+	// only the listed packets, deny decodes every packet except the listed ones and all decodes every packet. When
+	// empty, allow is used.
+	ClientDecodeMode string `yaml:"client_decode_mode"`
+	// CompressCache determines whether session caches sent uncompressed by servers are compressed using zstd while
+	// held in memory, reducing the memory used by large caches at the cost of decompressing them whenever they are
+	// used. Caches servers send compressed are always kept compressed.
+	CompressCache bool `yaml:"compress_cache"`
+	// Compression is the compression offered to servers that are not listed in ServerCompression, either "snappy"
+	// or "zstd". Snappy uses the least CPU and suits servers on the same host or network, while zstd saves bandwidth
+	// on slower links. When empty, snappy is used.
+	Compression string `yaml:"compression"`
+	// CompressionLevel is the zstd level payloads written to servers using zstd are compressed with, ranging from 1
+	// for the fastest compression to 22 for the best ratio. Snappy has no levels. Zero uses the default level.
+	CompressionLevel int `yaml:"compression_level"`
+	// CompressionThreshold is the size in bytes a payload written to a server must exceed to be compressed. Smaller
+	// payloads, such as batches only holding movement, are written uncompressed since compressing them costs CPU
+	// without notably reducing their size. Zero uses the default of 256 bytes.
+	CompressionThreshold int `yaml:"compression_threshold"`
+	// DebugAddr is the address of an HTTP listener exposing pprof profiles at /debug/pprof/, expvar variables at
+	// /debug/vars and a JSON dump of the state of every session, such as goroutines and queue depths, at
+	// /debug/sessions. The listener is started by Spectrum.Listen and must never be reachable publicly. When empty,
+	// no listener is started.
+	DebugAddr string `yaml:"debug_addr"`
+	// DialTimeout is the maximum duration dialing a server may take, after which the login or transfer dialing it
+	// fails instead of waiting for the operating system to time out. The connection sequence that follows is not
+	// limited by it. Zero disables the timeout.
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+	// DisableTracker disables tracking of server state (entities, effects, boss bars, player list entries and
+	// scoreboards) sent to the client. This saves work for every packet sent by the server, but that state is
+	// no longer cleared from the client during transfers, so leftovers of the previous server remain visible.
+	DisableTracker bool `yaml:"disable_tracker"`
+	// FilterRules are packet filter rules applied to the packets of every session, which drop, log or rate-limit
+	// packets matching an ID, a direction and field conditions, such as client Text packets with messages longer
+	// than 512 characters. Invalid rules are logged and ignored. Rules may be replaced per session using
+	// Session.SetFilterRules.
+	FilterRules []FilterRule `yaml:"filter_rules"`
+	// FlushClientOnClose determines whether a client batch that was read but not yet forwarded to the server is
+	// still forwarded when the session is closed using Session.Disconnect or Session.Close, so that no input of the
+	// client is lost. The server connection is then closed once the batch was written. Closes caused by errors
+	// close the server connection immediately.
+	FlushClientOnClose bool `yaml:"flush_client_on_close"`
+	// FlushCoalesceWindow is the duration within which the Flush packets sent by the server are coalesced into a
+	// single flush of the client, which is done once the window that started with the first Flush packet elapsed.
+	// This reduces the amount of small datagrams sent to clients by servers that flush frequently, at the cost of
+	// delaying flushes by up to the window. Zero flushes the client for every Flush packet.
+	FlushCoalesceWindow time.Duration `yaml:"flush_coalesce_window"`
+	// ForwardQueuePolicy is what is done when a forwarding queue is full because the side packets are written to
+	// cannot keep up, either "block", "drop" or "disconnect". Block stops reading until the queue has room again.
+	// Drop discards server packets listed in DroppablePackets and blocks for all others. Disconnect closes the
+	// session. When empty, block is used.
+	ForwardQueuePolicy string `yaml:"forward_queue_policy"`
+	// ForwardQueueSize is the maximum amount of packets or batches per session and direction that are read but
+	// not yet written, so that reading continues while the other side briefly falls behind. Once the queue is
+	// full, ForwardQueuePolicy applies. Zero uses a queue of 256 if AsyncProcessorWorkers is set and writes
+	// packets on the goroutines reading them otherwise.
+	ForwardQueueSize int `yaml:"forward_queue_size"`
+	// DroppablePackets is a list of server packet identifiers, such as those of sounds or particles, that may be
+	// discarded instead of forwarded to the client if ForwardQueuePolicy is "drop" and the queue is full.
+	DroppablePackets map[uint32]struct{} `yaml:"droppable_packets"`
+	// HandshakeMetadata is a set of key-value pairs, such as the proxy's version, region or a trace ID, sent to
+	// servers in a HandshakeMetadata packet right after the ConnectionRequest. It may hold up to 32 entries with
+	// keys of up to 64 bytes and values of up to 256 bytes. When empty, no HandshakeMetadata packet is sent, which
+	// keeps the proxy compatible with servers that do not expect one.
+	HandshakeMetadata map[string]string `yaml:"handshake_metadata"`
+	// InventoryChecks are the structural checks inventory transactions and item stack requests are subject to, such
+	// as slot ranges, action counts and the order of request IDs. Packets failing them never reach the server.
+	InventoryChecks InventoryLimits `yaml:"inventory_checks"`
 	// LatencyInterval is the interval at which the latency of the connection is updated in milliseconds.
 	// Lower intervals provide more accurate latency but use more bandwidth.
 	LatencyInterval int64 `yaml:"latency_interval"`
+	// LatencyMultiplier is the factor the client's latency reported by the connection is multiplied by. RakNet
+	// reports half of the round-trip time (RTT) as the latency, so the default of 2 yields the full RTT. Transports
+	// that report latency differently may need a different factor. Values of zero or less use the default.
+	LatencyMultiplier float64 `yaml:"latency_multiplier"`
+	// MetricsAddr is the address of an HTTP listener serving the metrics of the metrics package at /metrics in the
+	// Prometheus text exposition format. The listener is started by Spectrum.Listen. When empty, no listener is started.
+	MetricsAddr string `yaml:"metrics_addr"`
+	// MigrationTTL is the duration the state of a session migrated using Session.Migrate is kept for, within which
+	// the client must reconnect to the proxy it was migrated to for the session to be resumed. Zero uses the
+	// default of 30 seconds.
+	MigrationTTL time.Duration `yaml:"migration_ttl"`
+	// PriorityLanes determines whether latency-critical packets, such as movement, input, Disconnect and Transfer,
+	// are written ahead of bulk traffic, such as chunks, that is still queued. This keeps gameplay responsive on
+	// congested sessions while large payloads drain. Client batches are only written ahead if they hold nothing but
+	// movement and input. Since the player leaves the server once a Disconnect or Transfer arrives, the server
+	// packets queued before them are discarded instead. It has no effect unless ForwardQueueSize or
+	// AsyncProcessorWorkers is set.
+	PriorityLanes bool `yaml:"priority_lanes"`
+	// ProcessorTimeout is the maximum duration a single processor hook may run for. A hook that exceeds it is
+	// treated as a no-op and the session carries on without waiting for it. The hook keeps running in the
+	// background however, so it may have partially mutated state shared by reference, such as decoded packets.
+	// Further calls to the hook are skipped until it returns. Zero disables the timeout.
+	ProcessorTimeout time.Duration `yaml:"processor_timeout"`
+	// DisableProcessorOnTimeout determines whether the session's processor is replaced with a no-op processor
+	// once one of its hooks exceeds ProcessorTimeout.
+	DisableProcessorOnTimeout bool `yaml:"disable_processor_on_timeout"`
+	// DisconnectOnProcessorTimeout determines whether the session is disconnected once one of its processor's
+	// hooks exceeds ProcessorTimeout. The processor is disabled before disconnecting.
+	DisconnectOnProcessorTimeout bool `yaml:"disconnect_on_processor_timeout"`
+	// ProtocolMismatchThreshold is the amount of client packets that may fail to decode before the processor's
+	// ProcessProtocolMismatch hook is called. Packets that fail to decode are dropped until the threshold is reached.
+	// When zero, the session is disconnected as soon as a single packet fails to decode.
+	ProtocolMismatchThreshold int `yaml:"protocol_mismatch_threshold"`
+	// ResumeWindow is the duration a session is kept alive for after its client connection was lost, such as after
+	// a timeout, with the server connection still open. A client of the same XUID connecting within the window
+	// resumes the session, spawning with the tracked state of the session replayed instead of logging in to the
+	// server again. Since a client leaving on purpose cannot be told apart from a lost client, players that quit
+	// also remain on the server until the window elapsed. Players without an XUID cannot resume their session.
+	// Zero disables resuming.
+	ResumeWindow time.Duration `yaml:"resume_window"`
+	// SeamlessTransfer determines whether transfers between servers whose worlds share the dimension skip the
+	// animation and keep the player in the world, teleporting them to the spawn position of the new server while
+	// the chunks the client holds remain visible until the new server overwrites them. Transfers to a server in
+	// another dimension still play the animation. Since the dimension of the target is only known once connected,
+	// the screen of ShowTransferScreen is still shown if enabled.
+	SeamlessTransfer bool `yaml:"seamless_transfer"`
+	// ServerBandwidthLimit is the maximum amount of bytes per second read from the server of a session on the
+	// wire. Servers sending more are slowed down by delaying reads. Zero disables the limit.
+	ServerBandwidthLimit int64 `yaml:"server_bandwidth_limit"`
+	// ServerCompression maps server addresses to the compression offered to them in addition to snappy, either
+	// "snappy" or "zstd". The compression is only used once the server sent a packet compressed with it, so servers
+	// that do not support it keep using snappy. Servers that are not listed use Compression.
+	ServerCompression map[string]string `yaml:"server_compression"`
+	// ServerDecode is a list of server packet identifiers that are decoded by the proxy once the player spawned.
+	// Other server packets are forwarded to the client as raw payloads and passed to the processor undecoded, even
+	// if the server marks them as to be decoded. Packets the proxy needs itself, such as those tracked for
+	// transfers, are always decoded. When nil, every packet the server marks as to be decoded is decoded. It may be
+	// replaced per session using Session.SetServerDecode.
+	ServerDecode map[uint32]struct{} `yaml:"server_decode"`
+	// ServerDecodeMode determines how ServerDecode is interpreted, either "allow", "deny" or "all". Allow decodes
+	// only the listed packets, deny decodes every packet except the listed ones and all decodes every packet the
+	// server marks as to be decoded. When empty, allow is used. ServerDecode being nil always decodes every packet.
+	ServerDecodeMode string `yaml:"server_decode_mode"`
+	// ShowTransferScreen determines whether the dimension change loading screen is shown to the client as soon as a
+	// transfer starts, hiding the transition until the player spawned on the target server or the transfer failed.
+	// Since the screen is a dimension change, it is best combined with an animation that does not change the
+	// dimension itself, such as animation.NopAnimation.
+	ShowTransferScreen bool `yaml:"show_transfer_screen"`
 	// ShutdownMessage is the message displayed to clients when Spectrum shuts down.
 	ShutdownMessage string `yaml:"shutdown_message"`
+	// SupportedProtocols is a list of client protocol versions that are allowed to log in. Clients on a protocol
+	// outside of this list are disconnected during login with UnsupportedProtocolMessage, before any server is
+	// dialed. When empty, every protocol supported by the listener is accepted.
+	SupportedProtocols []int32 `yaml:"supported_protocols"`
+	// UnsupportedProtocolMessage is the message displayed to clients whose protocol is not in SupportedProtocols.
+	UnsupportedProtocolMessage string `yaml:"unsupported_protocol_message"`
 	// SyncProtocol determines the protocol version the proxy should use when communicating with servers.
 	// When enabled, the proxy uses the client's protocol version (minecraft.Protocol) for reading and
 	// writing packets. If disabled, the proxy defaults to using the latest protocol version (minecraft.DefaultProtocol).
 	SyncProtocol bool `yaml:"sync_protocol"`
+	// TrackPacketStats determines whether sessions count the packets read from the client and servers, and their
+	// sizes, per packet ID. The statistics are returned by Session.Stats.
+	TrackPacketStats bool `yaml:"track_packet_stats"`
+	// TransferCooldown is the minimum duration between the starts of two transfers of a session, which prevents a
+	// misbehaving server or plugin from bouncing a player between servers many times per second. Transfers
+	// requested within the cooldown fail with a *session.TransferCooldownError, which is passed to the processor's
+	// ProcessTransferRejected hook. Retries of failed transfers and fallbacks are not subject to the cooldown. Zero
+	// disables the cooldown.
+	TransferCooldown time.Duration `yaml:"transfer_cooldown"`
+	// TransferDebounce is the window within which rapid transfer requests made through Session.Transfer are
+	// coalesced. Only the last target requested within the window is dialed. Zero disables debouncing.
+	TransferDebounce time.Duration `yaml:"transfer_debounce"`
+	// TransferRetries is the amount of times a failed transfer is retried automatically before giving up, calling the
+	// processor's ProcessTransferFailure hook for every failed attempt. A retry is dropped if another transfer is
+	// started before it. Zero disables retries, leaving it to the server to request the transfer again.
+	TransferRetries int `yaml:"transfer_retries"`
+	// TransferRetryBackoff is the delay before the first retry of a failed transfer, which doubles for every
+	// following retry up to ten seconds. Zero uses the default of 500 milliseconds.
+	TransferRetryBackoff time.Duration `yaml:"transfer_retry_backoff"`
+	// TranslateEntityIDs determines whether the entity IDs of servers are translated to IDs that are unique on the
+	// client, so that entities of a server the player transferred to never share their IDs with entities the client
+	// still holds from a previous server. The client packets holding entity IDs are always decoded to translate them
+	// back. Only server packets that are sent decoded are translated, so servers must send every packet holding an
+	// entity ID decoded. Processors see the IDs used by the server.
+	TranslateEntityIDs bool `yaml:"translate_entity_ids"`
+	// TwoPhaseTransfer determines whether transfers complete the connection sequence with the target server while the
+	// player keeps playing on the current server, buffering the packets the target sends meanwhile. The current
+	// server connection is only replaced once the target is ready to spawn the player, which shortens the freeze
+	// during transfers to the time it takes to spawn.
+	TwoPhaseTransfer bool `yaml:"two_phase_transfer"`
+	// Validation are the limits client packets are validated against before they are forwarded to servers, such
+	// as the maximum NBT depth or string length. Packets commonly abused to crash servers, such as inventory
+	// transactions and block actor data, are always decoded to be validated if any limit is set. All other packets
+	// are only validated if they are decoded anyway.
+	Validation ValidationLimits `yaml:"validation"`
+	// ZstdDictionary is the path of a zstd dictionary trained on Minecraft packet data, which improves the
+	// compression ratio of small packets. Servers using zstd must use the same dictionary. When empty, no
+	// dictionary is used.
+	ZstdDictionary string `yaml:"zstd_dictionary"`
 }
 
 // DefaultOpts returns the default configuration options for Spectrum.
 func DefaultOpts() *Opts {
 	return &Opts{
-		Addr:            ":19132",
-		AutoLogin:       true,
-		LatencyInterval: 3000,
-		ShutdownMessage: "Spectrum closed.",
-		SyncProtocol:    false,
+		Addr:              ":19132",
+		AutoLogin:         true,
+		LatencyInterval:   3000,
+		LatencyMultiplier: 2,
+		ShutdownMessage:   "Spectrum closed.",
+		SyncProtocol:      false,
+
+		UnsupportedProtocolMessage: "Your game version is not supported, please update your game.",
 	}
 }
@@ -0,0 +1,25 @@
+package util
+
+// ValidationLimits are the bounds client packets are validated against before they are forwarded to servers, so
+// that malformed packets crafted to crash servers are not relayed. A limit of zero is not enforced.
+type ValidationLimits struct {
+	// MaxPacketSize is the maximum size of a single packet in bytes.
+	MaxPacketSize int `yaml:"max_packet_size"`
+	// MaxStringLength is the maximum length of a string in a packet in bytes.
+	MaxStringLength int `yaml:"max_string_length"`
+	// MaxArrayLength is the maximum amount of elements of a slice or map in a packet, other than byte slices,
+	// which are bound by MaxPacketSize.
+	MaxArrayLength int `yaml:"max_array_length"`
+	// MaxNBTDepth is the maximum nesting depth of NBT compounds and lists in a packet.
+	MaxNBTDepth int `yaml:"max_nbt_depth"`
+	// MaxItemCount is the maximum count of an item stack in a packet.
+	MaxItemCount int `yaml:"max_item_count"`
+	// Action is what is done with packets violating the limits, either "drop" or "disconnect". When empty, the
+	// packets are dropped.
+	Action string `yaml:"action"`
+}
+
+// Enabled returns whether any of the limits is enforced.
+func (l ValidationLimits) Enabled() bool {
+	return l.MaxPacketSize > 0 || l.MaxStringLength > 0 || l.MaxArrayLength > 0 || l.MaxNBTDepth > 0 || l.MaxItemCount > 0
+}